@@ -0,0 +1,833 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/silence"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"gopkg.in/yaml.v2"
+)
+
+// adminPath is the path prefix of the admin API.
+const adminPath = "/admin/api/v1"
+
+// maxAdminBodyBytes caps the request bodies of the admin API.
+const maxAdminBodyBytes = 1 << 20
+
+// reservedPathPrefixes and reservedPaths are served by other handlers, managed connectors cannot use them.
+var (
+	reservedPathPrefixes = []string{"/admin/", "/debug/", "/t/", "/_dynamicwebhook/"}
+	reservedPaths        = []string{"/metrics", "/config", silence.Path}
+)
+
+// AdminConfig enables the admin API, which manages connectors and templates at runtime.
+type AdminConfig struct {
+	// Token or TokenFile is the bearer token the API requires, at least 16 characters.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+	// StoreDir is the directory the managed connectors and templates are stored in.
+	StoreDir string `yaml:"store_dir"`
+	// AuditLog is the file the changes are appended to as JSON lines, the log if empty.
+	AuditLog string `yaml:"audit_log"`
+}
+
+// adminAPI manages the connectors with custom templates of the store, served by a route table.
+type adminAPI struct {
+	// mu serializes the changes.
+	mu     sync.Mutex
+	token  []byte
+	store  adminStore
+	audit  log.Logger
+	logger log.Logger
+	rb     routeBuilder
+	// base has the mentions and shared templates of the config file.
+	base PromTeamsConfig
+	// static are the routes of the config file and the tenants.
+	static     []transport.Route
+	table      *transport.RouteTable
+	connectors map[string]ConnectorWithCustomTemplate
+	// flushers are those of the served connectors, by request path.
+	flushers map[string]*flushers
+}
+
+// managedRoute is the route of a managed connector with its services keeping messages in memory.
+type managedRoute struct {
+	transport.Route
+	flushers *flushers
+}
+
+// newAdminAPI creates the admin API and serves the connectors of its store, nil if not configured.
+// A stored connector failing to build is logged and not served, so it can be fixed through the API.
+func newAdminAPI(
+	ac *AdminConfig, logger log.Logger, rb routeBuilder, tc PromTeamsConfig, static []transport.Route,
+) (*adminAPI, error) {
+	if ac == nil {
+		return nil, nil
+	}
+	token := ac.Token
+	if ac.TokenFile != "" {
+		b, err := os.ReadFile(ac.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if len(token) < 16 {
+		return nil, fmt.Errorf("the admin token must have at least 16 characters")
+	}
+	if ac.StoreDir == "" {
+		return nil, fmt.Errorf("the admin store_dir is required")
+	}
+	store, err := newFileAdminStore(ac.StoreDir)
+	if err != nil {
+		return nil, err
+	}
+
+	logger = log.With(logger, "component", "admin")
+	audit := log.With(logger, "msg", "admin audit")
+	if ac.AuditLog != "" {
+		f, err := os.OpenFile(ac.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		audit = log.With(log.NewJSONLogger(log.NewSyncWriter(f)), "ts", log.DefaultTimestampUTC)
+	}
+
+	a := &adminAPI{
+		token:  []byte(token),
+		store:  store,
+		audit:  audit,
+		logger: logger,
+		rb:     rb,
+		base: PromTeamsConfig{
+			TemplateDirs:     tc.TemplateDirs,
+			TemplateIncludes: tc.TemplateIncludes,
+			Mentions:         tc.Mentions,
+		},
+		static:     static,
+		table:      transport.NewRouteTable(),
+		connectors: map[string]ConnectorWithCustomTemplate{},
+		flushers:   map[string]*flushers{},
+	}
+
+	cs, err := store.Connectors()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cs {
+		a.connectors[c.RequestPath] = c
+		if err := a.checkRequestPath(c); err != nil {
+			level.Error(logger).Log("msg", "failed to load a managed connector", "request_path", c.RequestPath, "err", err)
+			continue
+		}
+		r, err := a.build(c)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to load a managed connector", "request_path", c.RequestPath, "err", err)
+			continue
+		}
+		a.serve(r)
+	}
+	return a, nil
+}
+
+// register adds the admin API and the routes of the managed connectors to the server.
+func (a *adminAPI) register(e *echo.Echo) {
+	transport.AddRouteTable(e, a.table, a.logger)
+
+	g := e.Group(adminPath, transport.RequestIDMiddleware(), a.authenticate)
+	g.GET("/connectors", a.listConnectors)
+	g.POST("/connectors", a.createConnector)
+	g.GET("/connectors/*", a.getConnector)
+	g.PUT("/connectors/*", a.putConnector)
+	g.DELETE("/connectors/*", a.deleteConnector)
+	g.GET("/templates", a.listTemplates)
+	g.GET("/templates/:name", a.getTemplate)
+	g.PUT("/templates/:name", a.putTemplate)
+	g.DELETE("/templates/:name", a.deleteTemplate)
+	g.POST("/test-send", a.testSend)
+	g.POST("/preview", a.preview)
+}
+
+// authenticate requires the bearer token.
+func (a *adminAPI) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+			c.Response().Header().Set("WWW-Authenticate", "Bearer")
+			return adminError(c, http.StatusUnauthorized, fmt.Errorf("invalid or missing bearer token"))
+		}
+		return next(c)
+	}
+}
+
+func (a *adminAPI) listConnectors(c echo.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	paths := make([]string, 0, len(a.connectors))
+	for p := range a.connectors {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	cs := make([]interface{}, 0, len(paths))
+	for _, p := range paths {
+		v, err := connectorJSON(a.connectors[p])
+		if err != nil {
+			return adminError(c, http.StatusInternalServerError, err)
+		}
+		cs = append(cs, v)
+	}
+	return c.JSON(http.StatusOK, cs)
+}
+
+func (a *adminAPI) getConnector(c echo.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	conn, ok := a.connectors["/"+c.Param("*")]
+	if !ok {
+		return adminError(c, http.StatusNotFound, fmt.Errorf("no managed connector with request path '/%s'", c.Param("*")))
+	}
+	v, err := connectorJSON(conn)
+	if err != nil {
+		return adminError(c, http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, v)
+}
+
+func (a *adminAPI) createConnector(c echo.Context) error {
+	conn, err := readConnector(c)
+	if err != nil {
+		return adminError(c, http.StatusBadRequest, err)
+	}
+	return a.saveConnector(c, conn, true)
+}
+
+func (a *adminAPI) putConnector(c echo.Context) error {
+	conn, err := readConnector(c)
+	if err != nil {
+		return adminError(c, http.StatusBadRequest, err)
+	}
+	path := "/" + c.Param("*")
+	if conn.RequestPath == "" {
+		conn.RequestPath = path
+	}
+	if conn.RequestPath != path {
+		return adminError(c, http.StatusBadRequest, fmt.Errorf("the request_path '%s' is not the one of the URL '%s'", conn.RequestPath, path))
+	}
+	return a.saveConnector(c, conn, false)
+}
+
+// saveConnector validates, builds, stores and serves the connector, create fails if it exists.
+func (a *adminAPI) saveConnector(c echo.Context, conn ConnectorWithCustomTemplate, create bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	old, exists := a.connectors[conn.RequestPath]
+	action := "connector.update"
+	if !exists {
+		action = "connector.create"
+	}
+	if create && exists {
+		return a.auditError(c, action, conn.RequestPath, http.StatusConflict,
+			fmt.Errorf("a managed connector with request path '%s' exists", conn.RequestPath))
+	}
+	if err := a.checkRequestPath(conn); err != nil {
+		return a.auditError(c, action, conn.RequestPath, http.StatusBadRequest, err)
+	}
+	r, err := a.build(conn)
+	if err != nil {
+		return a.auditError(c, action, conn.RequestPath, http.StatusBadRequest, err)
+	}
+
+	a.connectors[conn.RequestPath] = conn
+	if err := a.save(); err != nil {
+		if exists {
+			a.connectors[conn.RequestPath] = old
+		} else {
+			delete(a.connectors, conn.RequestPath)
+		}
+		return a.auditError(c, action, conn.RequestPath, http.StatusInternalServerError, err)
+	}
+	a.serve(r)
+	a.auditOK(c, action, conn.RequestPath, connectorChange(old, exists, conn)...)
+
+	v, err := connectorJSON(conn)
+	if err != nil {
+		return adminError(c, http.StatusInternalServerError, err)
+	}
+	if exists {
+		return c.JSON(http.StatusOK, v)
+	}
+	return c.JSON(http.StatusCreated, v)
+}
+
+func (a *adminAPI) deleteConnector(c echo.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	path := "/" + c.Param("*")
+	old, ok := a.connectors[path]
+	if !ok {
+		return a.auditError(c, "connector.delete", path, http.StatusNotFound,
+			fmt.Errorf("no managed connector with request path '%s'", path))
+	}
+	delete(a.connectors, path)
+	if err := a.save(); err != nil {
+		a.connectors[path] = old
+		return a.auditError(c, "connector.delete", path, http.StatusInternalServerError, err)
+	}
+	a.unserve(path)
+	a.auditOK(c, "connector.delete", path, auditChange(connectorYAML(old), nil)...)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (a *adminAPI) listTemplates(c echo.Context) error {
+	names, err := a.store.Templates()
+	if err != nil {
+		return adminError(c, http.StatusInternalServerError, err)
+	}
+	if names == nil {
+		names = []string{}
+	}
+	return c.JSON(http.StatusOK, names)
+}
+
+func (a *adminAPI) getTemplate(c echo.Context) error {
+	text, err := a.store.Template(c.Param("name"))
+	if errors.Is(err, errNotFound) {
+		return adminError(c, http.StatusNotFound, fmt.Errorf("no template '%s'", c.Param("name")))
+	}
+	if err != nil {
+		return adminError(c, http.StatusBadRequest, err)
+	}
+	return c.Blob(http.StatusOK, "text/plain; charset=utf-8", text)
+}
+
+// putTemplate validates and stores the template, and rebuilds the connectors using it.
+// The previous template is restored if a connector fails to build.
+func (a *adminAPI) putTemplate(c echo.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	name := c.Param("name")
+	if !validTemplateName.MatchString(name) {
+		return a.auditError(c, "template.put", name, http.StatusBadRequest,
+			fmt.Errorf("invalid template name '%s', must match %s", name, validTemplateName))
+	}
+	text, err := io.ReadAll(io.LimitReader(c.Request().Body, maxAdminBodyBytes))
+	if err != nil {
+		return a.auditError(c, "template.put", name, http.StatusBadRequest, err)
+	}
+	if err := a.parseTemplate(name, text); err != nil {
+		return a.auditError(c, "template.put", name, http.StatusBadRequest, err)
+	}
+
+	old, err := a.store.Template(name)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return a.auditError(c, "template.put", name, http.StatusInternalServerError, err)
+	}
+	existed := err == nil
+	if err := a.store.SaveTemplate(name, text); err != nil {
+		return a.auditError(c, "template.put", name, http.StatusInternalServerError, err)
+	}
+
+	var routes []managedRoute
+	for _, conn := range a.connectors {
+		if !usesTemplate(conn, name) {
+			continue
+		}
+		r, err := a.build(conn)
+		if err != nil {
+			if existed {
+				err = errors.Join(err, a.store.SaveTemplate(name, old))
+			} else {
+				err = errors.Join(err, a.store.DeleteTemplate(name))
+			}
+			return a.auditError(c, "template.put", name, http.StatusBadRequest,
+				fmt.Errorf("connector '%s': %w", conn.RequestPath, err))
+		}
+		routes = append(routes, r)
+	}
+	for _, r := range routes {
+		a.serve(r)
+	}
+	var oldText []byte
+	if existed {
+		oldText = old
+	}
+	a.auditOK(c, "template.put", name, auditChange(oldText, text)...)
+	if existed {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.NoContent(http.StatusCreated)
+}
+
+func (a *adminAPI) deleteTemplate(c echo.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	name := c.Param("name")
+	for _, conn := range a.connectors {
+		if usesTemplate(conn, name) {
+			return a.auditError(c, "template.delete", name, http.StatusConflict,
+				fmt.Errorf("the template is used by the connector '%s'", conn.RequestPath))
+		}
+	}
+	old, err := a.store.Template(name)
+	if err == nil {
+		err = a.store.DeleteTemplate(name)
+	}
+	if errors.Is(err, errNotFound) {
+		return a.auditError(c, "template.delete", name, http.StatusNotFound, fmt.Errorf("no template '%s'", name))
+	}
+	if err != nil {
+		return a.auditError(c, "template.delete", name, http.StatusBadRequest, err)
+	}
+	a.auditOK(c, "template.delete", name, auditChange(old, nil)...)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// adminSendRequest is the body of the test-send and preview requests.
+type adminSendRequest struct {
+	RequestPath string `json:"request_path"`
+	// Connector is previewed instead of the connector of the request path, in the format of the config file.
+	Connector json.RawMessage `json:"connector"`
+	// Message is the Alertmanager webhook message, a sample alert if not set.
+	Message *webhook.Message `json:"message"`
+}
+
+// testSend posts the message through the route of the request path, with all its services.
+func (a *adminAPI) testSend(c echo.Context) error {
+	var req adminSendRequest
+	if err := json.NewDecoder(io.LimitReader(c.Request().Body, maxAdminBodyBytes)).Decode(&req); err != nil {
+		return adminError(c, http.StatusBadRequest, err)
+	}
+	s, ok := a.service(req.RequestPath)
+	if !ok {
+		return adminError(c, http.StatusNotFound, fmt.Errorf("no route with request path '%s'", req.RequestPath))
+	}
+
+	wm := sampleMessage()
+	if req.Message != nil {
+		wm = *req.Message
+	}
+	prs, err := s.Post(c.Request().Context(), wm)
+	if err != nil {
+		return a.auditError(c, "test_send", req.RequestPath, http.StatusBadGateway, err)
+	}
+	a.auditOK(c, "test_send", req.RequestPath)
+	return c.JSON(http.StatusOK, prs)
+}
+
+// preview renders the card of a connector without sending it.
+func (a *adminAPI) preview(c echo.Context) error {
+	var req adminSendRequest
+	if err := json.NewDecoder(io.LimitReader(c.Request().Body, maxAdminBodyBytes)).Decode(&req); err != nil {
+		return adminError(c, http.StatusBadRequest, err)
+	}
+
+	var conn ConnectorWithCustomTemplate
+	if len(req.Connector) > 0 {
+		var err error
+		if conn, err = decodeConnector(req.Connector); err != nil {
+			return adminError(c, http.StatusBadRequest, err)
+		}
+	} else {
+		a.mu.Lock()
+		var ok bool
+		conn, ok = a.connectors[req.RequestPath]
+		a.mu.Unlock()
+		if !ok {
+			return adminError(c, http.StatusNotFound, fmt.Errorf("no managed connector with request path '%s'", req.RequestPath))
+		}
+	}
+
+	wm := sampleMessage()
+	if req.Message != nil {
+		wm = *req.Message
+	}
+	v, err := a.render(c.Request().Context(), conn, wm)
+	if err != nil {
+		return adminError(c, http.StatusBadRequest, err)
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return c.JSONBlob(http.StatusOK, raw)
+	}
+	return c.JSON(http.StatusOK, v)
+}
+
+// render converts the message with the templates of the connector, like its delivery would.
+func (a *adminAPI) render(ctx context.Context, conn ConnectorWithCustomTemplate, wm webhook.Message) (interface{}, error) {
+	conn, err := a.resolveTemplates(conn)
+	if err != nil {
+		return nil, err
+	}
+	connectorType := a.rb.webhookType
+	if conn.WebhookType != "" {
+		if connectorType, err = service.ParseWebhookType(conn.WebhookType); err != nil {
+			return nil, err
+		}
+	}
+	includes, err := a.base.templateIncludes()
+	if err != nil {
+		return nil, err
+	}
+	converter, err := newConverter(conn.TemplateConfig, includes, a.rb.templateFuncs)
+	if err != nil {
+		return nil, err
+	}
+	converter = card.NewMentionMiddleware(a.base.cardMentions(), converter)
+
+	switch connectorType {
+	case service.O365:
+		return converter.Convert(ctx, wm)
+	case service.Workflow:
+		return converter.ConvertWorkflow(ctx, wm)
+	default:
+		return converter.ConvertRaw(ctx, wm)
+	}
+}
+
+// build creates the route of a managed connector with the validation of the config file.
+func (a *adminAPI) build(conn ConnectorWithCustomTemplate) (managedRoute, error) {
+	conn, err := a.resolveTemplates(conn)
+	if err != nil {
+		return managedRoute{}, err
+	}
+	tc := a.base
+	tc.ConnectorsWithCustomTemplates = []ConnectorWithCustomTemplate{conn}
+	rb := a.rb
+	rb.flushers = &flushers{}
+	routes, err := rb.routes(tc)
+	if err != nil {
+		return managedRoute{}, err
+	}
+	return managedRoute{routes[0], rb.flushers}, nil
+}
+
+// serve serves the route. The messages kept by the route it replaces, e.g. a digest, are posted at once.
+func (a *adminAPI) serve(r managedRoute) {
+	a.table.Set(r.Route)
+	if old := a.flushers[r.RequestPath]; old != nil {
+		go old.flush(context.Background())
+	}
+	a.flushers[r.RequestPath] = r.flushers
+}
+
+// unserve stops serving the route of the request path and posts the messages it keeps at once.
+func (a *adminAPI) unserve(requestPath string) {
+	a.table.Delete(requestPath)
+	if old := a.flushers[requestPath]; old != nil {
+		go old.flush(context.Background())
+	}
+	delete(a.flushers, requestPath)
+}
+
+// flush flushes the managed connectors, e.g. at shutdown.
+func (a *adminAPI) flush(ctx context.Context) {
+	a.mu.Lock()
+	fs := make([]*flushers, 0, len(a.flushers))
+	for _, f := range a.flushers {
+		fs = append(fs, f)
+	}
+	a.mu.Unlock()
+	for _, f := range fs {
+		f.flush(ctx)
+	}
+}
+
+// checkRequestPath rejects the request paths served by other handlers or connectors.
+func (a *adminAPI) checkRequestPath(conn ConnectorWithCustomTemplate) error {
+	p := conn.RequestPath
+	if !strings.HasPrefix(p, "/") {
+		return fmt.Errorf("the request_path '%s' must start with '/'", p)
+	}
+	for _, prefix := range reservedPathPrefixes {
+		if strings.HasPrefix(p, prefix) {
+			return fmt.Errorf("the request_path '%s' is reserved", p)
+		}
+	}
+	for _, reserved := range reservedPaths {
+		if p == reserved {
+			return fmt.Errorf("the request_path '%s' is reserved", p)
+		}
+	}
+
+	routes := append([]transport.Route{}, a.static...)
+	for path := range a.connectors {
+		if path != p {
+			routes = append(routes, transport.Route{RequestPath: path})
+		}
+	}
+	return checkDuplicateRequestPath(append(routes, transport.Route{RequestPath: p}))
+}
+
+// resolveTemplates replaces the names of the managed templates by their files.
+// Managed connectors only use the templates of the store, they cannot name other files of the server.
+func (a *adminAPI) resolveTemplates(conn ConnectorWithCustomTemplate) (ConnectorWithCustomTemplate, error) {
+	if conn.LayoutFile != "" {
+		return conn, fmt.Errorf("managed connectors do not support layout_file, use a template of the store")
+	}
+	if hc := conn.HTTPConfig; hc != nil && (hc.TLSConfig.CAFile != "" || hc.TLSConfig.CertFile != "" || hc.TLSConfig.KeyFile != "") {
+		return conn, fmt.Errorf("managed connectors do not support the files of the http_config tls_config")
+	}
+	resolve := func(f string) (string, error) {
+		if !validTemplateName.MatchString(f) {
+			return f, fmt.Errorf("the template '%s' is not a template of the store", f)
+		}
+		path, err := a.store.TemplateFile(f)
+		if errors.Is(err, errNotFound) {
+			return f, fmt.Errorf("the template '%s' is not a template of the store", f)
+		}
+		return path, err
+	}
+
+	var err error
+	if conn.TemplateFile != "" {
+		if conn.TemplateFile, err = resolve(conn.TemplateFile); err != nil {
+			return conn, err
+		}
+	}
+	files := make([]string, len(conn.TemplateFiles))
+	for i, f := range conn.TemplateFiles {
+		if files[i], err = resolve(f); err != nil {
+			return conn, err
+		}
+	}
+	conn.TemplateFiles = files
+	return conn, nil
+}
+
+// parseTemplate checks the template loads like the templates of the connectors.
+func (a *adminAPI) parseTemplate(name string, text []byte) error {
+	dir, err := os.MkdirTemp("", "prometheus-msteams-admin-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	f := filepath.Join(dir, name)
+	if err := os.WriteFile(f, text, 0o600); err != nil {
+		return err
+	}
+	includes, err := a.base.templateIncludes()
+	if err != nil {
+		return err
+	}
+	_, err = card.NewTemplateLoader().Funcs(a.rb.templateFuncs).Include(includes...).Load(f)
+	return err
+}
+
+// service returns the service of a managed connector or of a route of the config.
+func (a *adminAPI) service(requestPath string) (service.Service, bool) {
+	if r, ok := a.table.Get(requestPath); ok {
+		return r.Service, true
+	}
+	for _, r := range a.static {
+		if r.RequestPath == requestPath {
+			return r.Service, true
+		}
+	}
+	return nil, false
+}
+
+// save stores the managed connectors.
+func (a *adminAPI) save() error {
+	cs := make([]ConnectorWithCustomTemplate, 0, len(a.connectors))
+	for _, conn := range a.connectors {
+		cs = append(cs, conn)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].RequestPath < cs[j].RequestPath })
+	return a.store.SaveConnectors(cs)
+}
+
+// auditOK records the change, keyvals describe it, see auditChange.
+func (a *adminAPI) auditOK(c echo.Context, action, target string, keyvals ...interface{}) {
+	a.audit.Log(append(a.auditKeyvals(c, action, target, "ok"), keyvals...)...)
+}
+
+// auditError records the failed change and responds with the error.
+func (a *adminAPI) auditError(c echo.Context, action, target string, status int, err error) error {
+	a.audit.Log(append(a.auditKeyvals(c, action, target, "error"), "err", err)...)
+	return adminError(c, status, err)
+}
+
+func (a *adminAPI) auditKeyvals(c echo.Context, action, target, result string) []interface{} {
+	return []interface{}{
+		"action", action,
+		"target", target,
+		"result", result,
+		"remote_addr", c.RealIP(),
+		"request_id", requestid.FromContext(c.Request().Context()),
+	}
+}
+
+// auditChange returns the SHA-256 of the content before and after a change as audit key values,
+// the content itself may hold secrets like webhook URLs. A missing content has no hash.
+func auditChange(before, after []byte) []interface{} {
+	hash := func(b []byte) string {
+		if b == nil {
+			return ""
+		}
+		return fmt.Sprintf("%x", sha256.Sum256(b))
+	}
+	return []interface{}{"old_sha256", hash(before), "new_sha256", hash(after)}
+}
+
+// connectorChange returns the audit key values of the change of a connector, with the fields which changed.
+func connectorChange(old ConnectorWithCustomTemplate, existed bool, conn ConnectorWithCustomTemplate) []interface{} {
+	var oldYAML []byte
+	oldFields := map[string]interface{}{}
+	if existed {
+		oldYAML = connectorYAML(old)
+		if v, err := connectorJSON(old); err == nil {
+			oldFields, _ = v.(map[string]interface{})
+		}
+	}
+	newFields := map[string]interface{}{}
+	if v, err := connectorJSON(conn); err == nil {
+		newFields, _ = v.(map[string]interface{})
+	}
+
+	var changed []string
+	for k, v := range newFields {
+		if !reflect.DeepEqual(oldFields[k], v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range oldFields {
+		if _, ok := newFields[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return append(auditChange(oldYAML, connectorYAML(conn)), "changed", strings.Join(changed, ","))
+}
+
+// connectorYAML returns the connector in the format of the config file, nil if it cannot be encoded.
+func connectorYAML(conn ConnectorWithCustomTemplate) []byte {
+	b, err := yaml.Marshal(conn)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func adminError(c echo.Context, status int, err error) error {
+	return c.JSON(status, map[string]string{"error": err.Error()})
+}
+
+func usesTemplate(conn ConnectorWithCustomTemplate, name string) bool {
+	if conn.TemplateFile == name {
+		return true
+	}
+	for _, f := range conn.TemplateFiles {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readConnector reads a connector in the format of the config file, as JSON or YAML.
+func readConnector(c echo.Context) (ConnectorWithCustomTemplate, error) {
+	b, err := io.ReadAll(io.LimitReader(c.Request().Body, maxAdminBodyBytes))
+	if err != nil {
+		return ConnectorWithCustomTemplate{}, err
+	}
+	return decodeConnector(b)
+}
+
+func decodeConnector(b []byte) (ConnectorWithCustomTemplate, error) {
+	var conn ConnectorWithCustomTemplate
+	if json.Valid(b) {
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return conn, err
+		}
+		var err error
+		if b, err = yaml.Marshal(v); err != nil {
+			return conn, err
+		}
+	}
+	err := yaml.UnmarshalStrict(b, &conn)
+	return conn, err
+}
+
+// connectorJSON converts a connector to a JSON value with the keys of the config file.
+func connectorJSON(conn ConnectorWithCustomTemplate) (interface{}, error) {
+	b, err := yaml.Marshal(conn)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return jsonValue(v), nil
+}
+
+// jsonValue converts the maps decoded by yaml to maps with string keys.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	}
+	return v
+}
+
+// sampleMessage is the message of the test-send and preview requests without message.
+func sampleMessage() webhook.Message {
+	labels := template.KV{"alertname": "PrometheusMSTeamsTest", "severity": "info"}
+	annotations := template.KV{
+		"summary":     "Test alert",
+		"description": "This alert was sent by the admin API of prometheus-msteams.",
+	}
+	return webhook.Message{
+		Data: &template.Data{
+			Receiver: "prometheus-msteams",
+			Status:   "firing",
+			Alerts: template.Alerts{{
+				Status:      "firing",
+				Labels:      labels,
+				Annotations: annotations,
+				StartsAt:    time.Now().UTC(),
+			}},
+			GroupLabels:       template.KV{"alertname": labels["alertname"]},
+			CommonLabels:      labels,
+			CommonAnnotations: annotations,
+		},
+		Version:  "4",
+		GroupKey: `{}:{alertname="PrometheusMSTeamsTest"}`,
+	}
+}
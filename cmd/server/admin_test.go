@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
+)
+
+func Test_adminAPI(t *testing.T) {
+	teams := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("1"))
+	}))
+	defer teams.Close()
+
+	tmpl, err := os.ReadFile("../../default-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alert, err := os.ReadFile("../../pkg/card/testdata/prom_post_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const token = "0123456789abcdef"
+	dir := t.TempDir()
+	auditLog := filepath.Join(dir, "audit.log")
+	ac := &AdminConfig{Token: token, StoreDir: filepath.Join(dir, "store"), AuditLog: auditLog}
+	rb := testRouteBuilder(t)
+	static, err := rb.routes(PromTeamsConfig{Connectors: []map[string]string{{"/static": teams.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newServer := func() http.Handler {
+		a, err := newAdminAPI(ac, log.NewNopLogger(), rb, PromTeamsConfig{}, static)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := transport.NewServer(log.NewNopLogger(), static, nil)
+		a.register(e)
+		return e
+	}
+	srv := newServer()
+
+	do := func(method, path, auth string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		return do(method, adminPath+path, token, []byte(body))
+	}
+	expect := func(rec *httptest.ResponseRecorder, want int) {
+		t.Helper()
+		if rec.Code != want {
+			t.Fatalf("want status %d, got %d: %s", want, rec.Code, rec.Body.String())
+		}
+	}
+
+	expect(do(http.MethodGet, adminPath+"/connectors", "", nil), http.StatusUnauthorized)
+	expect(do(http.MethodGet, adminPath+"/connectors", "wrong-token-wrong", nil), http.StatusUnauthorized)
+
+	expect(admin(http.MethodPut, "/templates/card.tmpl", `{{ define "teams.card" }}{{ .Missing`), http.StatusBadRequest)
+	expect(admin(http.MethodPut, "/templates/card.tmpl", string(tmpl)), http.StatusCreated)
+	expect(admin(http.MethodPut, "/templates/..%2Fcard.tmpl", string(tmpl)), http.StatusBadRequest)
+	expect(admin(http.MethodGet, "/templates", ""), http.StatusOK)
+
+	connector := `{"request_path": "/managed", "webhook_url": "` + teams.URL + `", "template_file": "card.tmpl"}`
+	expect(admin(http.MethodPost, "/connectors", connector), http.StatusCreated)
+	expect(admin(http.MethodPost, "/connectors", connector), http.StatusConflict)
+	for _, path := range []string{"/static", "/metrics", "/t/x/alerts", "managed2"} {
+		c := strings.Replace(connector, "/managed", path, 1)
+		expect(admin(http.MethodPost, "/connectors", c), http.StatusBadRequest)
+	}
+	expect(admin(http.MethodPost, "/connectors", `{"request_path": "/typo", "webhook_url": "`+teams.URL+`", "templte_file": "x"}`), http.StatusBadRequest)
+	// Managed connectors cannot read other files of the server.
+	for _, files := range []string{
+		`"template_file": "../../default-message-card.tmpl"`,
+		`"template_files": ["card.tmpl", "/etc/passwd"]`,
+		`"layout_file": "../../examples/layouts/default-layout.yaml"`,
+		`"template_file": "card.tmpl", "http_config": {"tls_config": {"ca_file": "/etc/ssl/ca.pem"}}`,
+	} {
+		expect(admin(http.MethodPost, "/connectors", `{"request_path": "/files", "webhook_url": "`+teams.URL+`", `+files+`}`), http.StatusBadRequest)
+	}
+	expect(admin(http.MethodPost, "/preview", `{"connector": {"request_path": "/p", "webhook_url": "`+teams.URL+`", "template_file": "../../default-message-card.tmpl"}}`), http.StatusBadRequest)
+	expect(do(http.MethodPost, "/managed", "", alert), http.StatusOK)
+
+	// YAML updates the connector, the URL and the body must agree on the request path.
+	rec := admin(http.MethodPut, "/connectors/managed", "webhook_url: "+teams.URL+"\ntemplate_file: card.tmpl\nwebhook_type: slack\n")
+	expect(rec, http.StatusOK)
+	if rec.Header().Get(requestid.Header) == "" {
+		t.Fatal("want the request ID of the admin request in the response")
+	}
+	expect(admin(http.MethodPut, "/connectors/managed", `{"request_path": "/other", "webhook_url": "`+teams.URL+`"}`), http.StatusBadRequest)
+	rec = admin(http.MethodGet, "/connectors/managed", "")
+	expect(rec, http.StatusOK)
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["webhook_type"] != "slack" || got["template_file"] != "card.tmpl" {
+		t.Fatalf("want the updated connector, got %v", got)
+	}
+
+	rec = admin(http.MethodPost, "/preview", `{"connector": {"request_path": "/p", "webhook_url": "`+teams.URL+`", "template_file": "card.tmpl"}}`)
+	expect(rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), "PrometheusMSTeamsTest") {
+		t.Fatalf("want the card of the sample alert, got %s", rec.Body.String())
+	}
+	expect(admin(http.MethodPost, "/test-send", `{"request_path": "/managed"}`), http.StatusOK)
+	expect(admin(http.MethodPost, "/test-send", `{"request_path": "/static"}`), http.StatusOK)
+	expect(admin(http.MethodPost, "/test-send", `{"request_path": "/none"}`), http.StatusNotFound)
+
+	// An invalid template does not replace the stored one.
+	expect(admin(http.MethodPut, "/templates/card.tmpl", `{{ define "teams.card" }}{{ missingFunc }}{{ end }}`), http.StatusBadRequest)
+	rec = admin(http.MethodGet, "/templates/card.tmpl", "")
+	expect(rec, http.StatusOK)
+	if rec.Body.String() != string(tmpl) {
+		t.Fatal("want the template unchanged")
+	}
+	expect(admin(http.MethodDelete, "/templates/card.tmpl", ""), http.StatusConflict)
+
+	// The managed connectors are loaded on start.
+	srv = newServer()
+	expect(do(http.MethodPost, "/managed", "", alert), http.StatusOK)
+
+	expect(admin(http.MethodDelete, "/connectors/managed", ""), http.StatusNoContent)
+	expect(admin(http.MethodDelete, "/connectors/managed", ""), http.StatusNotFound)
+	expect(do(http.MethodPost, "/managed", "", alert), http.StatusNotFound)
+	expect(admin(http.MethodDelete, "/templates/card.tmpl", ""), http.StatusNoContent)
+
+	audit, err := os.ReadFile(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"action":"connector.create"`, `"action":"template.put"`, `"action":"connector.delete"`, `"result":"error"`, `"changed":"webhook_type"`} {
+		if !strings.Contains(string(audit), want) {
+			t.Errorf("want %s in the audit log, got %s", want, audit)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(audit)), "\n") {
+		var entry map[string]string
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["request_id"] == "" {
+			t.Errorf("want a request ID in %s", line)
+		}
+		if entry["result"] == "ok" && entry["action"] != "test_send" && entry["old_sha256"] == "" && entry["new_sha256"] == "" {
+			t.Errorf("want the hashes of the change in %s", line)
+		}
+		if strings.Contains(line, teams.URL) {
+			t.Errorf("want no connector content in %s", line)
+		}
+	}
+}
+
+func Test_newAdminAPI(t *testing.T) {
+	rb := testRouteBuilder(t)
+	if a, err := newAdminAPI(nil, log.NewNopLogger(), rb, PromTeamsConfig{}, nil); a != nil || err != nil {
+		t.Fatalf("want no admin API, got %v, %v", a, err)
+	}
+	if _, err := newAdminAPI(&AdminConfig{Token: "short", StoreDir: t.TempDir()}, log.NewNopLogger(), rb, PromTeamsConfig{}, nil); err == nil {
+		t.Fatal("want an error with a short token")
+	}
+	if _, err := newAdminAPI(&AdminConfig{Token: "0123456789abcdef"}, log.NewNopLogger(), rb, PromTeamsConfig{}, nil); err == nil {
+		t.Fatal("want an error without store_dir")
+	}
+}
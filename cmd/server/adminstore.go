@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// errNotFound is returned by an adminStore for an unknown template.
+var errNotFound = errors.New("not found")
+
+// validTemplateName restricts the names of the managed templates, they are file names.
+var validTemplateName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*\.tmpl$`)
+
+// adminStore persists the connectors and templates managed through the admin API.
+type adminStore interface {
+	Connectors() ([]ConnectorWithCustomTemplate, error)
+	// SaveConnectors replaces all connectors.
+	SaveConnectors([]ConnectorWithCustomTemplate) error
+	// Templates returns the names of the templates.
+	Templates() ([]string, error)
+	Template(name string) ([]byte, error)
+	// TemplateFile returns a local file with the template, for the template loader.
+	TemplateFile(name string) (string, error)
+	SaveTemplate(name string, text []byte) error
+	DeleteTemplate(name string) error
+}
+
+// fileAdminStore stores the connectors in connectors.yml and the templates in the templates directory of dir.
+// connectors.yml has the format of the config file, so its connectors can be moved to the config file.
+type fileAdminStore struct {
+	dir string
+}
+
+type fileAdminStoreConnectors struct {
+	ConnectorsWithCustomTemplates []ConnectorWithCustomTemplate `yaml:"connectors_with_custom_templates"`
+}
+
+func newFileAdminStore(dir string) (*fileAdminStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "templates"), 0o750); err != nil {
+		return nil, err
+	}
+	return &fileAdminStore{dir: dir}, nil
+}
+
+func (s *fileAdminStore) Connectors() ([]ConnectorWithCustomTemplate, error) {
+	b, err := os.ReadFile(filepath.Join(s.dir, "connectors.yml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c fileAdminStoreConnectors
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return c.ConnectorsWithCustomTemplates, nil
+}
+
+func (s *fileAdminStore) SaveConnectors(cs []ConnectorWithCustomTemplate) error {
+	b, err := yaml.Marshal(fileAdminStoreConnectors{cs})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, "connectors.yml"), b)
+}
+
+func (s *fileAdminStore) Templates() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "templates"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && validTemplateName.MatchString(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *fileAdminStore) Template(name string) ([]byte, error) {
+	f, err := s.TemplateFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(f) //nolint:gosec
+}
+
+func (s *fileAdminStore) TemplateFile(name string) (string, error) {
+	f, err := s.templatePath(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(f); errors.Is(err, fs.ErrNotExist) {
+		return "", errNotFound
+	}
+	return f, nil
+}
+
+func (s *fileAdminStore) SaveTemplate(name string, text []byte) error {
+	f, err := s.templatePath(name)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f, text)
+}
+
+func (s *fileAdminStore) DeleteTemplate(name string) error {
+	f, err := s.TemplateFile(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(f)
+}
+
+func (s *fileAdminStore) templatePath(name string) (string, error) {
+	if !validTemplateName.MatchString(name) {
+		return "", fmt.Errorf("invalid template name '%s', must match %s", name, validTemplateName)
+	}
+	return filepath.Join(s.dir, "templates", name), nil
+}
+
+// writeFileAtomic replaces the file, so readers never see a partial file.
+func writeFileAtomic(name string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+strings.TrimPrefix(filepath.Base(name), ".")+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close() //nolint:errcheck,gosec
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/enrich"
+)
+
+// EnricherConfig adds data to the alerts of a connector, exposed to templates as `.Extra`.
+type EnricherConfig struct {
+	// Type is "prometheus_value", "prometheus_graph", "runbook" or "grafana_dashboard".
+	Type string `yaml:"type"`
+	// Name is the key of the result in `.Extra`, the type if empty.
+	Name    string        `yaml:"name"`
+	Timeout time.Duration `yaml:"timeout"`
+	// URL is the base URL of Prometheus or Grafana.
+	URL string `yaml:"url"`
+	// Graph configures the prometheus_graph enricher.
+	Graph GraphConfig `yaml:",inline"`
+	// Template renders the runbook link, the runbook_url annotation is rendered if empty.
+	Template string `yaml:"template"`
+	// DashboardUID and Variables configure the Grafana dashboard link,
+	// Variables map a dashboard variable to a label name.
+	DashboardUID string            `yaml:"dashboard_uid"`
+	Variables    map[string]string `yaml:"variables"`
+}
+
+// GraphConfig configures the size of a graph, see enrich.GraphOptions.
+type GraphConfig struct {
+	Range     time.Duration `yaml:"range"`
+	Width     int           `yaml:"width"`
+	Height    int           `yaml:"height"`
+	MaxSeries int           `yaml:"max_series"`
+	MaxBytes  int           `yaml:"max_bytes"`
+}
+
+func (ec EnricherConfig) step(client *http.Client) (enrich.Step, error) {
+	s := enrich.Step{Name: ec.Name, Timeout: ec.Timeout}
+	if s.Name == "" {
+		s.Name = ec.Type
+	}
+
+	switch ec.Type {
+	case "prometheus_value":
+		if ec.URL == "" {
+			return s, fmt.Errorf("enricher '%s' requires a url", s.Name)
+		}
+		s.Enricher = enrich.NewPrometheusValueEnricher(client, ec.URL)
+	case "prometheus_graph":
+		if ec.URL == "" {
+			return s, fmt.Errorf("enricher '%s' requires a url", s.Name)
+		}
+		s.Enricher = enrich.NewPrometheusGraphEnricher(client, ec.URL, enrich.GraphOptions{
+			Range:     ec.Graph.Range,
+			Width:     ec.Graph.Width,
+			Height:    ec.Graph.Height,
+			MaxSeries: ec.Graph.MaxSeries,
+			MaxBytes:  ec.Graph.MaxBytes,
+		})
+	case "runbook":
+		e, err := enrich.NewRunbookEnricher(ec.Template)
+		if err != nil {
+			return s, fmt.Errorf("enricher '%s': %w", s.Name, err)
+		}
+		s.Enricher = e
+	case "grafana_dashboard":
+		if ec.URL == "" || ec.DashboardUID == "" {
+			return s, fmt.Errorf("enricher '%s' requires a url and a dashboard_uid", s.Name)
+		}
+		s.Enricher = enrich.NewGrafanaDashboardEnricher(ec.URL, ec.DashboardUID, ec.Variables)
+	default:
+		return s, fmt.Errorf("unknown enricher type '%s'", ec.Type)
+	}
+	return s, nil
+}
+
+// enrichSteps converts the enricher configs of a connector.
+func enrichSteps(cfgs []EnricherConfig, client *http.Client) ([]enrich.Step, error) {
+	steps := make([]enrich.Step, 0, len(cfgs))
+	for _, ec := range cfgs {
+		s, err := ec.step(client)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, s)
+	}
+	return steps, nil
+}
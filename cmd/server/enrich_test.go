@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_enrichSteps(t *testing.T) {
+	steps, err := enrichSteps([]EnricherConfig{
+		{Type: "prometheus_value", Name: "value", URL: "http://prometheus:9090"},
+		{Type: "runbook"},
+		{Type: "prometheus_graph", URL: "http://prometheus:9090", Graph: GraphConfig{Width: 200}},
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 3 || steps[0].Name != "value" || steps[1].Name != "runbook" || steps[2].Name != "prometheus_graph" {
+		t.Fatalf("unexpected steps %+v", steps)
+	}
+
+	for _, invalid := range []EnricherConfig{
+		{Type: "prometheus_value"},
+		{Type: "prometheus_graph"},
+		{Type: "grafana_dashboard", URL: "https://grafana"},
+		{Type: "runbook", Template: "{{ .Labels"},
+		{Type: "weather"},
+	} {
+		if _, err := enrichSteps([]EnricherConfig{invalid}, http.DefaultClient); err == nil {
+			t.Errorf("enricher %+v: want error", invalid)
+		}
+	}
+}
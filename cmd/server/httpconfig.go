@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// HTTPConfig configures the HTTP client of a connector, in the style of the http_config of Alertmanager.
+type HTTPConfig struct {
+	// ProxyURL is the proxy of the requests, the HTTP_PROXY and HTTPS_PROXY environment variables if empty.
+	ProxyURL string `yaml:"proxy_url"`
+	// ProxyFromEnvironment uses the proxy environment variables when proxy_url is empty, true by default.
+	// Set it to false for a connector which must go direct.
+	ProxyFromEnvironment *bool     `yaml:"proxy_from_environment"`
+	TLSConfig            TLSConfig `yaml:"tls_config"`
+	// Headers are added to each request, e.g. the subscription key of an API Management gateway.
+	Headers map[string]string `yaml:"headers"`
+	// Timeout bounds each request attempt, DialTimeout and TLSHandshakeTimeout its connection.
+	Timeout             time.Duration `yaml:"timeout"`
+	DialTimeout         time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout time.Duration `yaml:"tls_handshake_timeout"`
+}
+
+// TLSConfig configures the TLS connections of a client.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of the CAs the server certificates are verified with, the system CAs if empty.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate and key.
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
+	// InsecureSkipVerify overrides the -insecure-skip-verify flag if set.
+	InsecureSkipVerify *bool `yaml:"insecure_skip_verify"`
+}
+
+// httpClientOptions are the settings of the Teams HTTP client from the flags.
+type httpClientOptions struct {
+	MaxIdleConns        int
+	IdleConnTimeout     time.Duration
+	TLSHandshakeTimeout time.Duration
+	InsecureSkipVerify  bool
+}
+
+// newHTTPClient creates a traced client with the options, overridden by the config if not nil.
+func newHTTPClient(o httpClientOptions, hc *HTTPConfig) (*http.Client, error) {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          o.MaxIdleConns,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		TLSHandshakeTimeout:   o.TLSHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}, //nolint: gosec
+	}
+	if hc == nil {
+		return &http.Client{Transport: instrumentedTransport(t)}, nil
+	}
+
+	switch {
+	case hc.ProxyURL != "":
+		u, err := url.Parse(hc.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	case hc.ProxyFromEnvironment != nil && !*hc.ProxyFromEnvironment:
+		t.Proxy = nil
+	}
+
+	tlsConfig, err := hc.TLSConfig.config(o.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	t.TLSClientConfig = tlsConfig
+
+	if hc.DialTimeout > 0 {
+		t.DialContext = (&net.Dialer{Timeout: hc.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if hc.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = hc.TLSHandshakeTimeout
+	}
+
+	var rt http.RoundTripper = t
+	if len(hc.Headers) > 0 {
+		rt = headerTransport{headers: hc.Headers, next: t}
+	}
+	return &http.Client{Transport: instrumentedTransport(rt), Timeout: hc.Timeout}, nil
+}
+
+// config creates the TLS config, insecure skips the verification unless the config sets insecure_skip_verify.
+func (tc TLSConfig) config(insecure bool) (*tls.Config, error) {
+	if tc.InsecureSkipVerify != nil {
+		insecure = *tc.InsecureSkipVerify
+	}
+	c := &tls.Config{
+		ServerName:         tc.ServerName,
+		InsecureSkipVerify: insecure, //nolint: gosec
+	}
+	if tc.CAFile != "" {
+		b, err := os.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the tls_config ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate found in the tls_config ca_file %s", tc.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	if (tc.CertFile == "") != (tc.KeyFile == "") {
+		return nil, fmt.Errorf("the tls_config cert_file and key_file must be set together")
+	}
+	if tc.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the tls_config client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// headerTransport sets the headers of the requests.
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.next.RoundTrip(req)
+}
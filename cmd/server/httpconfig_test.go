@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testClientOptions = httpClientOptions{MaxIdleConns: 10, IdleConnTimeout: time.Minute, TLSHandshakeTimeout: time.Second}
+
+func TestNewHTTPClient_tlsAndHeaders(t *testing.T) {
+	var gotKey string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("Ocp-Apim-Subscription-Key")
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The system CAs do not trust the test server.
+	c, err := newHTTPClient(testClientOptions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := c.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("want a certificate error without ca_file")
+	}
+
+	c, err = newHTTPClient(testClientOptions, &HTTPConfig{
+		TLSConfig: TLSConfig{CAFile: caFile},
+		Headers:   map[string]string{"Ocp-Apim-Subscription-Key": "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if gotKey != "secret" {
+		t.Fatalf("want the configured header, got %q", gotKey)
+	}
+}
+
+func TestTLSConfig_insecureSkipVerify(t *testing.T) {
+	verify, skip := false, true
+	tests := []struct {
+		name string
+		tc   TLSConfig
+		flag bool
+		want bool
+	}{
+		{"flag", TLSConfig{}, true, true},
+		{"config enables verification", TLSConfig{InsecureSkipVerify: &verify}, true, false},
+		{"config skips verification", TLSConfig{InsecureSkipVerify: &skip}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.tc.config(tt.flag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.InsecureSkipVerify != tt.want {
+				t.Fatalf("want InsecureSkipVerify %v, got %v", tt.want, c.InsecureSkipVerify)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClient_proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	c, err := newHTTPClient(testClientOptions, &HTTPConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Get("http://teams.example.com/webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied != "http://teams.example.com/webhook" {
+		t.Fatalf("want the request through the proxy, got %q", proxied)
+	}
+}
+
+func TestNewHTTPClient_invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		hc   HTTPConfig
+	}{
+		{"missing ca_file", HTTPConfig{TLSConfig: TLSConfig{CAFile: "testdata/missing.pem"}}},
+		{"cert without key", HTTPConfig{TLSConfig: TLSConfig{CertFile: "client.pem"}}},
+		{"invalid proxy", HTTPConfig{ProxyURL: "://proxy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHTTPClient(testClientOptions, &tt.hc); err == nil {
+				t.Fatal("want an error")
+			}
+		})
+	}
+}
@@ -3,33 +3,36 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"flag"
 	"fmt"
-	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/hashicorp/go-retryablehttp"
 	"github.com/pkg/errors"
 
 	ocprometheus "contrib.go.opencensus.io/exporter/prometheus"
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/decode"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/relabel"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/silence"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/version"
+	"github.com/prometheus/alertmanager/template"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 
-	"contrib.go.opencensus.io/exporter/jaeger"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
-	"go.opencensus.io/trace"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
 
 	_ "net/http/pprof" //nolint: gosec
 
@@ -47,14 +50,164 @@ type PromTeamsConfig struct {
 	// The value is the Teams webhook url.
 	Connectors                    []map[string]string           `yaml:"connectors"`
 	ConnectorsWithCustomTemplates []ConnectorWithCustomTemplate `yaml:"connectors_with_custom_templates"`
+	BotFramework                  BotFrameworkConfig            `yaml:"bot_framework"`
+	BotConnectors                 []BotConnector                `yaml:"bot_connectors"`
+	// TemplateDirs and TemplateIncludes are shared template files loaded by all connectors
+	// before their own templates, e.g. to define partials once.
+	TemplateDirs     []string `yaml:"template_dirs"`
+	TemplateIncludes []string `yaml:"template_includes"`
+	// Mentions maps the argument of the 'mention' template function, e.g. "team=payments",
+	// to the Teams user or tag to mention.
+	Mentions map[string]MentionConfig `yaml:"mentions"`
+	// Schedules drop, delay or reroute matching messages during time windows, e.g. quiet hours.
+	Schedules []ScheduleConfig `yaml:"schedules"`
+	// SilenceActions serves the endpoint behind the silence and ack buttons of the cards.
+	SilenceActions *SilenceActionsConfig `yaml:"silence_actions"`
+	// PayloadLogging is what is logged about the alerts and cards, their summary by default.
+	PayloadLogging PayloadLoggingConfig `yaml:"payload_logging"`
+	// Retry is the retry policy of all connectors, the -max-retry-count flag sets its max_retries.
+	Retry *RetryConfig `yaml:"retry"`
+	// RateLimit limits the notifications of a tenant. In the config file,
+	// it is the rate limit of each tenant whose config file has none.
+	RateLimit *RateLimitConfig `yaml:"rate_limit"`
+	// Admin serves the API managing connectors with custom templates at runtime.
+	Admin *AdminConfig `yaml:"admin"`
+}
+
+// MentionConfig is the Teams user or tag a mention resolves to.
+type MentionConfig struct {
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+}
+
+// templateIncludes returns the globs of the shared template files.
+func (tc PromTeamsConfig) templateIncludes() ([]string, error) {
+	var includes []string
+	for _, d := range tc.TemplateDirs {
+		fi, err := os.Stat(d)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("template_dirs entry '%s' is not a directory", d)
+		}
+		includes = append(includes, filepath.Join(d, "*.tmpl"))
+	}
+	return append(includes, tc.TemplateIncludes...), nil
+}
+
+func (tc PromTeamsConfig) cardMentions() card.Mentions {
+	ms := card.Mentions{}
+	for k, m := range tc.Mentions {
+		ms[k] = card.Mention{ID: m.ID, Name: m.Name, Type: m.Type}
+	}
+	return ms
 }
 
 // ConnectorWithCustomTemplate .
 type ConnectorWithCustomTemplate struct {
-	RequestPath       string `yaml:"request_path"`
-	TemplateFile      string `yaml:"template_file"`
-	WebhookURL        string `yaml:"webhook_url"`
+	RequestPath string `yaml:"request_path"`
+	WebhookURL  string `yaml:"webhook_url"`
+	// WebhookType is "o365", "microsoft-workflow", "slack", "mattermost" or "generic",
+	// the type set by the -workflow-webhook flag if empty.
+	WebhookType string `yaml:"webhook_type"`
+	// Input is the format of the alerts posted to the request_path, Alertmanager webhooks if not set.
+	Input *decode.Config `yaml:"input"`
+	// SplitMode is "group" (the default), "alert" or "by_label:<name>".
+	SplitMode string        `yaml:"split_mode"`
+	Digest    *DigestConfig `yaml:"digest"`
+	// RelabelConfigs transform and filter the alerts before the card is rendered.
+	RelabelConfigs []*relabel.Config `yaml:"relabel_configs"`
+	Enrichers      []EnricherConfig  `yaml:"enrichers"`
+	// EnrichConcurrency is the number of enrichers called at the same time, enrich.DefaultConcurrency if 0.
+	EnrichConcurrency int `yaml:"enrich_concurrency"`
+	// Retry overrides the global retry policy.
+	Retry *RetryConfig `yaml:"retry"`
+	// HTTPConfig configures the proxy, TLS, headers and timeouts of the requests to the webhook.
+	HTTPConfig     *HTTPConfig `yaml:"http_config"`
+	TemplateConfig `yaml:",inline"`
+}
+
+// DigestConfig collects the alerts of a window into a single card rendered by "teams.digest".
+type DigestConfig struct {
+	Window  time.Duration `yaml:"window"`
+	GroupBy string        `yaml:"group_by"`
+	TopN    int           `yaml:"top_n"`
+}
+
+// withDigest wraps the service with a digest service if configured.
+func (d *DigestConfig) withDigest(logger log.Logger, s service.Service) (service.Service, error) {
+	if d == nil {
+		return s, nil
+	}
+	if d.Window <= 0 {
+		return nil, fmt.Errorf("the digest window must be positive")
+	}
+	return service.NewDigestService(
+		logger,
+		service.DigestOptions{Window: d.Window, GroupBy: d.GroupBy, TopN: d.TopN},
+		s,
+	), nil
+}
+
+// TemplateConfig configures how a connector renders its card.
+type TemplateConfig struct {
+	TemplateFile string `yaml:"template_file"`
+	// TemplateFiles are additional template files or globs loaded together with the template_file,
+	// e.g. to share partials.
+	TemplateFiles []string `yaml:"template_files"`
+	// LayoutFile builds the card from a declarative layout instead of the template files.
+	LayoutFile        string `yaml:"layout_file"`
 	EscapeUnderscores bool   `yaml:"escape_underscores"`
+	// EscapeJSONStrings escapes the actions inside JSON strings of the templates, true if not set.
+	// Templates escaping their values themselves set it to false.
+	EscapeJSONStrings *bool `yaml:"escape_json_strings"`
+	// MarkdownEscapeFields are the card fields whose underscores are escaped for markdown,
+	// e.g. "facts" or "activityTitle".
+	MarkdownEscapeFields []string `yaml:"markdown_escape_fields"`
+	// DisabledTemplateFuncs are template functions the templates must not use.
+	DisabledTemplateFuncs []string `yaml:"disabled_template_funcs"`
+}
+
+// hasTemplate reports whether any template or layout is configured.
+func (c TemplateConfig) hasTemplate() bool {
+	return len(c.TemplateFile) > 0 || len(c.TemplateFiles) > 0 || len(c.LayoutFile) > 0
+}
+
+// templateName names the template in metrics.
+func (c TemplateConfig) templateName() string {
+	if len(c.LayoutFile) > 0 {
+		return c.LayoutFile
+	}
+	files := c.TemplateFiles
+	if len(c.TemplateFile) > 0 {
+		files = append([]string{c.TemplateFile}, files...)
+	}
+	return strings.Join(files, ",")
+}
+
+// BotFrameworkConfig holds the app credentials of the Bot Framework registration.
+type BotFrameworkConfig struct {
+	AppID       string `yaml:"app_id"`
+	AppPassword string `yaml:"app_password"`
+	TenantID    string `yaml:"tenant_id"`
+}
+
+// BotConnector posts proactive messages to a Teams conversation through the Bot Framework.
+type BotConnector struct {
+	RequestPath       string            `yaml:"request_path"`
+	ServiceURL        string            `yaml:"service_url"`
+	ConversationID    string            `yaml:"conversation_id"`
+	Input             *decode.Config    `yaml:"input"`
+	SplitMode         string            `yaml:"split_mode"`
+	Digest            *DigestConfig     `yaml:"digest"`
+	RelabelConfigs    []*relabel.Config `yaml:"relabel_configs"`
+	Enrichers         []EnricherConfig  `yaml:"enrichers"`
+	EnrichConcurrency int               `yaml:"enrich_concurrency"`
+	Retry             *RetryConfig      `yaml:"retry"`
+	HTTPConfig        *HTTPConfig       `yaml:"http_config"`
+	TemplateConfig    `yaml:",inline"`
 }
 
 func parseTeamsConfigFile(f string) (PromTeamsConfig, error) {
@@ -73,8 +226,17 @@ func parseTeamsConfigFile(f string) (PromTeamsConfig, error) {
 var validWebhookPatternO365 = regexp.MustCompile(`^[a-z0-9]+\.webhook\.office\.com/webhookb2/[a-z0-9\-]+@[a-z0-9\-]+/IncomingWebhook/[a-z0-9]+/[a-z0-9\-]+(/[a-zA-Z0-9\-]+)?$`)
 var validWebhookPatternWorkflow = regexp.MustCompile((`^[a-z0-9\-\.]+\.environment\.api\.powerplatform\.com/powerautomate/automations/direct/workflows/[\w]+/triggers/manual/paths/invoke\?api-version=\d+&sp=%2Ftriggers%2Fmanual%2Frun&sv=1\.0&sig=[a-zA-Z0-9\-_]+`))
 var legacyWebhookPrefix = "outlook.office.com/webhook/" // old format is only valid until 11. april '21
+var slackWebhookPrefix = "hooks.slack.com/services/"
 
 func validateWebhook(workflowType service.WebhookType, u string) error {
+	// Generic endpoints may be internal services without TLS.
+	if workflowType == service.Generic {
+		if pu, err := url.Parse(u); err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+			return fmt.Errorf("the webhook_url must be an http or https URL. url: '%s'", u)
+		}
+		return nil
+	}
+
 	path := strings.TrimPrefix(u, "https://")
 	if u == path {
 		return fmt.Errorf("the webhook_url must start with 'https://'. url: '%s'", u)
@@ -92,6 +254,14 @@ func validateWebhook(workflowType service.WebhookType, u string) error {
 			return fmt.Errorf("the webhook_url has an unexpected format '%s'", u)
 		}
 		return nil
+	case service.Slack:
+		if !strings.HasPrefix(path, slackWebhookPrefix) {
+			return fmt.Errorf("the webhook_url has an unexpected format '%s'", u)
+		}
+	case service.Mattermost:
+		if !strings.Contains(path, "/hooks/") {
+			return fmt.Errorf("the webhook_url has an unexpected format '%s'", u)
+		}
 	}
 	return nil
 }
@@ -103,14 +273,20 @@ func main() { //nolint: funlen
 		promVersion                   = fs.Bool("version", false, "Print the version")
 		logFormat                     = fs.String("log-format", "json", "json|fmt")
 		debugLogs                     = fs.Bool("debug", false, "Set log level to debug mode.")
-		jaegerTrace                   = fs.Bool("jaeger-trace", false, "Send traces to Jaeger.")
-		jaegerAgentAddr               = fs.String("jaeger-agent", "localhost:6831", "Jaeger agent endpoint")
+		tracesExporter                = fs.String("traces-exporter", "", "Send traces with OpenTelemetry: otlp-grpc|otlp-http. Disabled if empty.")
+		tracesEndpoint                = fs.String("traces-endpoint", "", "The OTLP collector host and port. Defaults to OTEL_EXPORTER_OTLP_ENDPOINT or the exporter default.")
+		tracesInsecure                = fs.Bool("traces-insecure", false, "Send traces without TLS.")
+		tracesSampleRatio             = fs.Float64("traces-sample-ratio", 1, "The ratio of traces sampled, unless continued from a sampled or not sampled parent.")
+		jaegerTrace                   = fs.Bool("jaeger-trace", false, "Deprecated: use -traces-exporter=otlp-grpc, Jaeger accepts OTLP.")
+		jaegerAgentAddr               = fs.String("jaeger-agent", "", "Deprecated: the Jaeger agent is not supported, use -traces-endpoint.")
 		httpAddr                      = fs.String("http-addr", ":2000", "HTTP listen address.")
 		requestURI                    = fs.String("teams-request-uri", "", "The default request URI path where Prometheus will post to.")
 		teamsWebhookURL               = fs.String("teams-incoming-webhook-url", "", "The default Microsoft Teams webhook connector.")
 		templateFile                  = fs.String("template-file", "", "The Microsoft Teams Message Card template file.")
 		escapeUnderscores             = fs.Bool("auto-escape-underscores", true, "Automatically replace all '_' with '\\_' from texts in the alert.")
+		escapeJSONStrings             = fs.Bool("escape-json-strings", true, "Escape the values rendered inside JSON strings of the template file.")
 		configFile                    = fs.String("config-file", "", "The connectors configuration file.")
+		configDir                     = fs.String("config-dir", "", "The directory of the tenant configuration files, served under /t/<tenant>.")
 		httpClientIdleConnTimeout     = fs.Duration("idle-conn-timeout", 90*time.Second, "The HTTP client idle connection timeout duration.")
 		httpClientTLSHandshakeTimeout = fs.Duration("tls-handshake-timeout", 30*time.Second, "The HTTP client TLS handshake timeout.")
 		httpClientMaxIdleConn         = fs.Int("max-idle-conns", 100, "The HTTP client maximum number of idle connections")
@@ -168,26 +344,36 @@ func main() { //nolint: funlen
 	)
 
 	// Tracer.
+	setTextMapPropagator()
 	if *jaegerTrace {
-		logger.Log("message", "jaeger tracing enabled")
-
-		je, err := jaeger.NewExporter(
-			jaeger.Options{
-				AgentEndpoint: *jaegerAgentAddr,
-				ServiceName:   "prometheus-msteams",
-			},
-		)
+		level.Warn(logger).Log("msg", "-jaeger-trace is deprecated, use -traces-exporter=otlp-grpc")
+		if *tracesExporter == "" {
+			*tracesExporter = otlpGRPCExporter
+		}
+	}
+	if *jaegerAgentAddr != "" {
+		level.Warn(logger).Log("msg", "-jaeger-agent is not supported anymore, use -traces-endpoint")
+	}
+	if *tracesExporter != "" {
+		tp, err := newTracerProvider(context.Background(), tracingOptions{
+			Exporter:    *tracesExporter,
+			Endpoint:    *tracesEndpoint,
+			Insecure:    *tracesInsecure,
+			SampleRatio: *tracesSampleRatio,
+		})
 		if err != nil {
 			logger.Log("err", err)
 			os.Exit(1)
 		}
-
-		trace.RegisterExporter(je)
-		trace.ApplyConfig(
-			trace.Config{
-				DefaultSampler: trace.AlwaysSample(),
-			},
-		)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tp.Shutdown(ctx); err != nil {
+				logger.Log("err", err)
+			}
+		}()
+		otel.SetTracerProvider(tp)
+		logger.Log("message", "tracing enabled", "exporter", *tracesExporter)
 	}
 
 	// Prepare the Teams config.
@@ -205,50 +391,77 @@ func main() { //nolint: funlen
 		}
 	}
 
+	templateIncludes, err := tc.templateIncludes()
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+
+	payloadLog, err := tc.PayloadLogging.options()
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+
+	// Silence actions, their template functions are available to all connectors.
+	silenceActions, err := tc.SilenceActions.actions(logger)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+	templateFuncs := template.FuncMap{}
+	if silenceActions != nil {
+		templateFuncs = silenceActions.Funcs()
+	}
+
 	// Templated card defaultConverter setup.
 	var defaultConverter card.Converter
 	{
-		tmpl, err := card.ParseTemplateFile(*templateFile)
+		tmpl, err := card.NewTemplateLoader().
+			Funcs(templateFuncs).
+			Include(templateIncludes...).
+			EscapeJSONStrings(*escapeJSONStrings).
+			Load(*templateFile)
 		if err != nil {
 			logger.Log("err", err)
 		}
 		defaultConverter = card.NewTemplatedCardCreator(tmpl, *escapeUnderscores)
+		defaultConverter = card.NewMentionMiddleware(tc.cardMentions(), defaultConverter)
 		defaultConverter = card.NewCreatorLoggingMiddleware(
 			log.With(
 				logger,
 				"template_file", *templateFile,
 				"escaped_underscores", *escapeUnderscores,
 			),
+			payloadLog,
 			defaultConverter,
 		)
+		defaultConverter = card.NewInstrumentingMiddleware(*templateFile, defaultConverter)
 	}
 
-	// Teams HTTP client setup.
-	retryClient := retryablehttp.NewClient()
-	if !*debugLogs {
-		retryClient.Logger = nil
-	}
-	retryClient.RetryMax = *retryMax
-	retryClient.HTTPClient = &http.Client{
-		Transport: &ochttp.Transport{
-			Base: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).DialContext,
-				MaxIdleConns:          *httpClientMaxIdleConn,
-				IdleConnTimeout:       *httpClientIdleConnTimeout,
-				TLSHandshakeTimeout:   *httpClientTLSHandshakeTimeout,
-				ExpectContinueTimeout: 1 * time.Second,
-				TLSClientConfig:       &tls.Config{InsecureSkipVerify: *insecureSkipVerify}, //nolint: gosec
-			},
-		},
+	// Teams HTTP client setup, retried with the policy of each connector.
+	retryPolicy := service.DefaultRetryPolicy()
+	retryPolicy.Max = *retryMax
+	retryPolicy, err = tc.Retry.policy(retryPolicy)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
 	}
+	clients, err := newTeamsClients(logger, httpClientOptions{
+		MaxIdleConns:        *httpClientMaxIdleConn,
+		IdleConnTimeout:     *httpClientIdleConnTimeout,
+		TLSHandshakeTimeout: *httpClientTLSHandshakeTimeout,
+		InsecureSkipVerify:  *insecureSkipVerify,
+	}, retryPolicy)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+	httpClient := clients.shared
 
-	httpClient := retryClient.StandardClient()
+	// Enrichers have their own timeouts and are not retried.
+	enrichClient := &http.Client{Transport: instrumentedTransport(nil)}
 
-	var routes []transport.Route
 	var dRoutes []transport.DynamicRoute
 
 	// Connectors from flags.
@@ -281,81 +494,44 @@ func main() { //nolint: funlen
 
 			var s service.Service
 			s = service.NewSimpleService(defaultConverter, httpClient, webhook, webhookType)
-			s = service.NewLoggingService(logger, s)
+			s = service.NewDeadlineService(retryPolicy.Deadline, s)
+			s = service.NewLoggingService(logger, payloadLog, s)
+			s = service.NewInstrumentingService(r.RequestPath, s)
 			return s, nil
 		}
 		dRoutes = append(dRoutes, r)
 	}
 
-	// Connectors from config file.
-	for _, c := range tc.Connectors {
-		for uri, webhook := range c {
-			err := validateWebhook(webhookType, webhook)
-			if *validateWebhookURL && err != nil {
-				logger.Log("err", err)
-				os.Exit(1)
-			}
-
-			var r transport.Route
-			r.RequestPath = uri
-			r.Service = service.NewSimpleService(defaultConverter, httpClient, webhook, webhookType)
-			r.Service = service.NewLoggingService(logger, r.Service)
-			routes = append(routes, r)
-		}
+	// Connectors from the config file.
+	rb := routeBuilder{
+		logger:             logger,
+		webhookType:        webhookType,
+		validateWebhookURL: *validateWebhookURL,
+		defaultConverter:   defaultConverter,
+		templateFuncs:      templateFuncs,
+		payloadLog:         payloadLog,
+		clients:            clients,
+		enrichClient:       enrichClient,
+		flushers:           &flushers{},
+	}
+	routes, err := rb.routes(tc)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
 	}
 
-	// Connectors with custom template files.
-	for _, c := range tc.ConnectorsWithCustomTemplates {
-		if len(c.RequestPath) == 0 {
-			logger.Log("err", "one of the 'templated_connectors' is missing a 'request_path'")
-			os.Exit(1)
-		}
-		if len(c.WebhookURL) == 0 {
-			logger.Log(
-				"err",
-				fmt.Sprintf("The webhook_url is required for request_path '%s'", c.RequestPath),
-			)
-			os.Exit(1)
-		}
-		err := validateWebhook(webhookType, c.WebhookURL)
-		if *validateWebhookURL && err != nil {
-			logger.Log("err", err)
-			os.Exit(1)
-		}
-		if len(c.TemplateFile) == 0 {
-			logger.Log(
-				"err",
-				fmt.Sprintf("The template_file is required for request_path '%s'", c.RequestPath),
-			)
-			os.Exit(1)
-		}
-
-		var converter card.Converter
-		tmpl, err := card.ParseTemplateFile(c.TemplateFile)
+	// Tenants from the config directory, a tenant failing to load does not stop the others.
+	if *configDir != "" {
+		tenantRoutes, err := loadTenants(rb, tc.RateLimit, *configDir, routes)
 		if err != nil {
 			logger.Log("err", err)
 			os.Exit(1)
 		}
-
-		// converter = card.NewTemplatedCardCreator(tmpl, c.EscapeUnderscores, c.DisableGrouping)
-		converter = card.NewTemplatedCardCreator(tmpl, c.EscapeUnderscores)
-		converter = card.NewCreatorLoggingMiddleware(
-			log.With(
-				logger,
-				"template_file", c.TemplateFile,
-				"escaped_underscores", c.EscapeUnderscores,
-			),
-			converter,
-		)
-
-		var r transport.Route
-		r.RequestPath = c.RequestPath
-		r.Service = service.NewSimpleService(converter, httpClient, c.WebhookURL, webhookType)
-		r.Service = service.NewLoggingService(logger, r.Service)
-		routes = append(routes, r)
+		routes = append(routes, tenantRoutes...)
 	}
 
-	if err := checkDuplicateRequestPath(routes); err != nil {
+	admin, err := newAdminAPI(tc.Admin, logger, rb, tc, routes)
+	if err != nil {
 		logger.Log("err", err)
 		os.Exit(1)
 	}
@@ -387,6 +563,18 @@ func main() { //nolint: funlen
 		handler.GET("/config", func(c echo.Context) error {
 			return c.JSON(200, tc.Connectors)
 		})
+		// Silence actions.
+		if silenceActions != nil {
+			handler.Match(
+				[]string{http.MethodGet, http.MethodPost},
+				silence.Path,
+				echo.WrapHandler(otelhttp.NewHandler(silenceActions, silence.Path)),
+			)
+		}
+		// Admin API and its connectors.
+		if admin != nil {
+			admin.register(handler)
+		}
 	}
 
 	var g run.Group
@@ -413,6 +601,13 @@ func main() { //nolint: funlen
 						logger.Log("err", err)
 					}
 				}
+				// The messages kept in memory, e.g. digests, are handled once no request is served anymore.
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				rb.flushers.flush(ctx)
+				if admin != nil {
+					admin.flush(ctx)
+				}
 			},
 		)
 	}
@@ -491,6 +686,48 @@ func ocviews() []*view.View {
 	}
 }
 
+// newConverter creates the converter of a connector from its layout file if set,
+// otherwise from the shared template includes and its template files with the additional funcs.
+// The template files must define the required templates, e.g. card.DigestTemplate.
+func newConverter(c TemplateConfig, includes []string, funcs template.FuncMap, required ...string) (card.Converter, error) {
+	converter, err := newCardCreator(c, includes, funcs, required)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.MarkdownEscapeFields) > 0 {
+		converter = card.NewMarkdownEscapeMiddleware(c.MarkdownEscapeFields, converter)
+	}
+	return converter, nil
+}
+
+func newCardCreator(c TemplateConfig, includes []string, funcs template.FuncMap, required []string) (card.Converter, error) {
+	if len(c.LayoutFile) > 0 {
+		l, err := card.ParseLayoutFile(c.LayoutFile)
+		if err != nil {
+			return nil, err
+		}
+		return card.NewLayoutCardCreator(l, c.EscapeUnderscores)
+	}
+
+	var files []string
+	if len(c.TemplateFile) > 0 {
+		files = append(files, c.TemplateFile)
+	}
+	files = append(files, c.TemplateFiles...)
+
+	tmpl, err := card.NewTemplateLoader().
+		Funcs(funcs).
+		Disable(c.DisabledTemplateFuncs...).
+		Include(includes...).
+		Require(required...).
+		EscapeJSONStrings(c.EscapeJSONStrings == nil || *c.EscapeJSONStrings).
+		Load(files...)
+	if err != nil {
+		return nil, err
+	}
+	return card.NewTemplatedCardCreator(tmpl, c.EscapeUnderscores), nil
+}
+
 func checkDuplicateRequestPath(routes []transport.Route) error {
 	added := map[string]bool{}
 	for _, r := range routes {
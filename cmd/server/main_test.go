@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
 )
 
@@ -26,6 +30,12 @@ func Test_validateWebhook(t *testing.T) {
 		{name: "https but invalid", webhook: service.O365, args: args{u: "https://example.com"}, wantErr: true},
 
 		{name: "workflow webhook", webhook: service.Workflow, args: args{u: "https://example.cd.environment.api.powerplatform.com/powerautomate/automations/direct/workflows/b008d545fb784/triggers/manual/paths/invoke?api-version=1&sp=%2Ftriggers%2Fmanual%2Frun&sv=1.0&sig=Ogxlm1IT-Hs"}, wantErr: false},
+
+		{name: "slack webhook", webhook: service.Slack, args: args{u: "https://hooks.slack.com/services/T000/B000/XXXX"}, wantErr: false},
+		{name: "slack but invalid", webhook: service.Slack, args: args{u: "https://example.com/services/T000"}, wantErr: true},
+		{name: "mattermost webhook", webhook: service.Mattermost, args: args{u: "https://mattermost.example.com/hooks/xxx"}, wantErr: false},
+		{name: "generic over http", webhook: service.Generic, args: args{u: "http://alerts.internal:8080/ingest"}, wantErr: false},
+		{name: "generic without scheme", webhook: service.Generic, args: args{u: "alerts.internal/ingest"}, wantErr: true},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -112,3 +122,40 @@ func newDummyRequest(urlPath, authHeader string) *http.Request {
 	}
 	return req
 }
+
+func Test_parseTeamsConfigFile(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "config.yml")
+	err := os.WriteFile(f, []byte(`
+connectors_with_custom_templates:
+- request_path: /alert
+  webhook_url: https://example.com
+  template_file: ./card.tmpl
+  template_files: [./partials/*.tmpl]
+  disabled_template_funcs: [fromYaml]
+  escape_underscores: true
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc, err := parseTeamsConfigFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ConnectorWithCustomTemplate{
+		{
+			RequestPath: "/alert",
+			WebhookURL:  "https://example.com",
+			TemplateConfig: TemplateConfig{
+				TemplateFile:          "./card.tmpl",
+				TemplateFiles:         []string{"./partials/*.tmpl"},
+				DisabledTemplateFuncs: []string{"fromYaml"},
+				EscapeUnderscores:     true,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, tc.ConnectorsWithCustomTemplates); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/relabel"
+)
+
+// PayloadLoggingConfig is what is logged about the alerts and cards.
+type PayloadLoggingConfig struct {
+	// Mode is "none", "summary" or "full", the summary if empty.
+	Mode string `yaml:"mode"`
+	// MaxBytes caps each logged alert and card of the full mode, 4096 if 0.
+	MaxBytes int `yaml:"max_bytes"`
+	// RedactLabels and RedactAnnotations are regular expressions matching the names
+	// of the labels and annotations whose values are redacted from the logs.
+	RedactLabels      []relabel.Regexp `yaml:"redact_labels"`
+	RedactAnnotations []relabel.Regexp `yaml:"redact_annotations"`
+}
+
+// options converts the config.
+func (pc PayloadLoggingConfig) options() (card.PayloadLogOptions, error) {
+	mode, err := card.ParsePayloadLogMode(pc.Mode)
+	if err != nil {
+		return card.PayloadLogOptions{}, err
+	}
+	o := card.PayloadLogOptions{Mode: mode, MaxBytes: pc.MaxBytes}
+	for _, re := range pc.RedactLabels {
+		o.RedactLabels = append(o.RedactLabels, re.Regexp)
+	}
+	for _, re := range pc.RedactAnnotations {
+		o.RedactAnnotations = append(o.RedactAnnotations, re.Regexp)
+	}
+	return o, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+)
+
+// RetryConfig is how failed deliveries are retried, unset fields keep the policy they override.
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries *int `yaml:"max_retries"`
+	// WaitMin and WaitMax bound the exponential backoff between attempts.
+	WaitMin time.Duration `yaml:"wait_min"`
+	WaitMax time.Duration `yaml:"wait_max"`
+	// Jitter randomizes the backoff between wait_min and the exponential wait.
+	Jitter *bool `yaml:"jitter"`
+	// RespectRetryAfter waits for the Retry-After header of 429 and 503 responses, true by default.
+	RespectRetryAfter *bool `yaml:"respect_retry_after"`
+	// RetryOn are the status codes which are retried, 429 and 5xx but 501 if empty.
+	RetryOn []int `yaml:"retry_on"`
+	// Deadline bounds the delivery of a notification including all retries.
+	Deadline time.Duration `yaml:"deadline"`
+}
+
+// policy overrides the base policy with the fields set in the config.
+func (rc *RetryConfig) policy(base service.RetryPolicy) (service.RetryPolicy, error) {
+	if rc == nil {
+		return base, nil
+	}
+	p := base
+	if rc.MaxRetries != nil {
+		p.Max = *rc.MaxRetries
+	}
+	if rc.WaitMin != 0 {
+		p.WaitMin = rc.WaitMin
+	}
+	if rc.WaitMax != 0 {
+		p.WaitMax = rc.WaitMax
+	}
+	if rc.Jitter != nil {
+		p.Jitter = *rc.Jitter
+	}
+	if rc.RespectRetryAfter != nil {
+		p.IgnoreRetryAfter = !*rc.RespectRetryAfter
+	}
+	if len(rc.RetryOn) > 0 {
+		p.RetryOn = rc.RetryOn
+	}
+	if rc.Deadline != 0 {
+		p.Deadline = rc.Deadline
+	}
+
+	if p.Max < 0 {
+		return p, fmt.Errorf("the retry max_retries must not be negative")
+	}
+	if p.WaitMin <= 0 || p.WaitMax < p.WaitMin {
+		return p, fmt.Errorf("the retry wait_min must be positive and not above wait_max")
+	}
+	if p.Deadline < 0 {
+		return p, fmt.Errorf("the retry deadline must not be negative")
+	}
+	for _, s := range p.RetryOn {
+		if s < 100 || s > 599 {
+			return p, fmt.Errorf("invalid retry_on status code %d", s)
+		}
+	}
+	return p, nil
+}
+
+// teamsClients creates the retrying clients of the connectors.
+type teamsClients struct {
+	logger log.Logger
+	opts   httpClientOptions
+	policy service.RetryPolicy
+	// base is the client of the connectors without http_config,
+	// shared is its retrying client for the connectors without retry either.
+	base   *http.Client
+	shared *http.Client
+}
+
+func newTeamsClients(logger log.Logger, o httpClientOptions, p service.RetryPolicy) (*teamsClients, error) {
+	c, err := newHTTPClient(o, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &teamsClients{logger, o, p, c, service.NewRetryClient(logger, p, c)}, nil
+}
+
+// forConnector returns the retry policy and the client of a connector,
+// the shared client unless the connector has its own retry or http_config.
+func (tc *teamsClients) forConnector(rc *RetryConfig, hc *HTTPConfig) (service.RetryPolicy, *http.Client, error) {
+	p, err := rc.policy(tc.policy)
+	if err != nil {
+		return p, nil, err
+	}
+	if rc == nil && hc == nil {
+		return p, tc.shared, nil
+	}
+	c := tc.base
+	if hc != nil {
+		if c, err = newHTTPClient(tc.opts, hc); err != nil {
+			return p, nil, err
+		}
+	}
+	return p, service.NewRetryClient(tc.logger, p, c), nil
+}
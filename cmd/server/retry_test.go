@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRetryConfig_policy(t *testing.T) {
+	base := service.DefaultRetryPolicy()
+	base.Deadline = 10 * time.Second
+
+	tests := []struct {
+		name    string
+		config  string
+		want    service.RetryPolicy
+		wantErr bool
+	}{
+		{
+			name:   "none keeps the base policy",
+			config: "",
+			want:   base,
+		},
+		{
+			name: "overrides the set fields",
+			config: `
+max_retries: 0
+wait_max: 5s
+jitter: true
+respect_retry_after: false
+retry_on: [502, 503]
+`,
+			want: service.RetryPolicy{
+				Max:              0,
+				WaitMin:          time.Second,
+				WaitMax:          5 * time.Second,
+				Jitter:           true,
+				IgnoreRetryAfter: true,
+				RetryOn:          []int{502, 503},
+				Deadline:         10 * time.Second,
+			},
+		},
+		{name: "wait min above max", config: "wait_min: 1m", wantErr: true},
+		{name: "invalid status", config: "retry_on: [42]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rc *RetryConfig
+			if tt.config != "" {
+				rc = &RetryConfig{}
+				if err := yaml.Unmarshal([]byte(tt.config), rc); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := rc.policy(base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected policy (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/decode"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/enrich"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/relabel"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// routeBuilder builds the routes of the connectors of a config.
+type routeBuilder struct {
+	logger             log.Logger
+	webhookType        service.WebhookType
+	validateWebhookURL bool
+	// defaultConverter renders the cards of the connectors without template.
+	defaultConverter card.Converter
+	templateFuncs    template.FuncMap
+	payloadLog       card.PayloadLogOptions
+	clients          *teamsClients
+	// enrichClient has its own timeouts and is not retried.
+	enrichClient *http.Client
+	// flushers collects the services of the routes keeping messages in memory, if not nil.
+	flushers *flushers
+}
+
+// flushers are the services keeping messages in memory, flushed when the server stops.
+type flushers struct {
+	mu sync.Mutex
+	fs []service.Flusher
+}
+
+// add records the service if it keeps messages in memory.
+func (f *flushers) add(s service.Service) {
+	fl, ok := s.(service.Flusher)
+	if f == nil || !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs = append(f.fs, fl)
+}
+
+// flush flushes the services concurrently, within the deadline of ctx.
+func (f *flushers) flush(ctx context.Context) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	fs := append([]service.Flusher{}, f.fs...)
+	f.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, fl := range fs {
+		wg.Add(1)
+		go func(fl service.Flusher) {
+			defer wg.Done()
+			fl.Flush(ctx)
+		}(fl)
+	}
+	wg.Wait()
+}
+
+// routes builds the routes of the connectors of the config, with their metrics and schedules.
+func (b routeBuilder) routes(tc PromTeamsConfig) ([]transport.Route, error) {
+	templateIncludes, err := tc.templateIncludes()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []transport.Route
+	for _, c := range tc.Connectors {
+		for uri, webhook := range c {
+			r, err := b.connectorRoute(uri, webhook)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, r)
+		}
+	}
+	for _, c := range tc.ConnectorsWithCustomTemplates {
+		r, err := b.templatedConnectorRoute(tc, templateIncludes, c)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	for _, c := range tc.BotConnectors {
+		r, err := b.botConnectorRoute(tc, templateIncludes, c)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+
+	if err := checkDuplicateRequestPath(routes); err != nil {
+		return nil, err
+	}
+
+	if err := applySchedules(b.logger, tc.Schedules, routes); err != nil {
+		return nil, err
+	}
+	for _, r := range routes {
+		b.flushers.add(r.Service)
+	}
+
+	// Route metrics, after the schedules so the messages they drop, delay or reroute are counted too.
+	for i := range routes {
+		routes[i].Service = service.NewInstrumentingService(routes[i].RequestPath, routes[i].Service)
+	}
+	return routes, nil
+}
+
+// connectorRoute creates the route of a connector using the default template.
+func (b routeBuilder) connectorRoute(uri, webhook string) (transport.Route, error) {
+	var r transport.Route
+	if err := validateWebhook(b.webhookType, webhook); b.validateWebhookURL && err != nil {
+		return r, err
+	}
+
+	r.RequestPath = uri
+	r.Service = service.NewSimpleService(b.defaultConverter, b.clients.shared, webhook, b.webhookType)
+	r.Service = service.NewDeadlineService(b.clients.policy.Deadline, r.Service)
+	r.Service = service.NewLoggingService(b.logger, b.payloadLog, r.Service)
+	return r, nil
+}
+
+func (b routeBuilder) templatedConnectorRoute(
+	tc PromTeamsConfig, templateIncludes []string, c ConnectorWithCustomTemplate,
+) (transport.Route, error) {
+	var r transport.Route
+	if len(c.RequestPath) == 0 {
+		return r, fmt.Errorf("one of the 'templated_connectors' is missing a 'request_path'")
+	}
+	if len(c.WebhookURL) == 0 {
+		return r, fmt.Errorf("the webhook_url is required for request_path '%s'", c.RequestPath)
+	}
+	connectorType := b.webhookType
+	if c.WebhookType != "" {
+		var err error
+		connectorType, err = service.ParseWebhookType(c.WebhookType)
+		if err != nil {
+			return r, fmt.Errorf("request_path '%s': %w", c.RequestPath, err)
+		}
+	}
+	if err := validateWebhook(connectorType, c.WebhookURL); b.validateWebhookURL && err != nil {
+		return r, err
+	}
+	if !c.hasTemplate() {
+		return r, fmt.Errorf("the template_file(s) or layout_file is required for request_path '%s'", c.RequestPath)
+	}
+	if len(c.LayoutFile) > 0 && (len(c.TemplateFile) > 0 || len(c.TemplateFiles) > 0) {
+		return r, fmt.Errorf("only one of template_file(s) and layout_file can be set for request_path '%s'", c.RequestPath)
+	}
+	if len(c.LayoutFile) > 0 && connectorType != service.O365 && connectorType != service.Workflow {
+		return r, fmt.Errorf("the layout_file only renders Teams cards, use template_file(s) for request_path '%s'", c.RequestPath)
+	}
+
+	splitMode, steps, converter, err := b.connectorParts(tc, templateIncludes, c.RequestPath, c.SplitMode, c.Enrichers, c.Digest, c.TemplateConfig)
+	if err != nil {
+		return r, err
+	}
+	policy, client, err := b.clients.forConnector(c.Retry, c.HTTPConfig)
+	if err != nil {
+		return r, fmt.Errorf("request_path '%s': %w", c.RequestPath, err)
+	}
+
+	r.RequestPath = c.RequestPath
+	if r.Decoder, err = decode.New(c.Input); err != nil {
+		return r, fmt.Errorf("request_path '%s': %w", c.RequestPath, err)
+	}
+	r.Service = service.NewSimpleService(converter, client, c.WebhookURL, connectorType)
+	return b.wrap(r, splitMode, steps, c.EnrichConcurrency, policy, c.Digest, c.RelabelConfigs)
+}
+
+func (b routeBuilder) botConnectorRoute(
+	tc PromTeamsConfig, templateIncludes []string, c BotConnector,
+) (transport.Route, error) {
+	var r transport.Route
+	if len(c.RequestPath) == 0 {
+		return r, fmt.Errorf("one of the 'bot_connectors' is missing a 'request_path'")
+	}
+	if len(c.ServiceURL) == 0 || len(c.ConversationID) == 0 {
+		return r, fmt.Errorf("the service_url and conversation_id are required for request_path '%s'", c.RequestPath)
+	}
+	if len(tc.BotFramework.AppID) == 0 || len(tc.BotFramework.AppPassword) == 0 {
+		return r, fmt.Errorf("the 'bot_framework' app_id and app_password are required for 'bot_connectors'")
+	}
+	if !c.hasTemplate() {
+		c.TemplateFile = "./default-message-workflow-card.tmpl"
+	}
+
+	splitMode, steps, converter, err := b.connectorParts(tc, templateIncludes, c.RequestPath, c.SplitMode, c.Enrichers, c.Digest, c.TemplateConfig)
+	if err != nil {
+		return r, err
+	}
+	policy, client, err := b.clients.forConnector(c.Retry, c.HTTPConfig)
+	if err != nil {
+		return r, fmt.Errorf("request_path '%s': %w", c.RequestPath, err)
+	}
+
+	r.RequestPath = c.RequestPath
+	if r.Decoder, err = decode.New(c.Input); err != nil {
+		return r, fmt.Errorf("request_path '%s': %w", c.RequestPath, err)
+	}
+	// The token requests are not deliveries, they use the client without retries and delivery metrics.
+	r.Service = service.NewBotFrameworkService(
+		converter,
+		client,
+		b.clients.base,
+		service.ConversationReference{
+			ServiceURL:     c.ServiceURL,
+			ConversationID: c.ConversationID,
+		},
+		service.BotCredentials{
+			AppID:       tc.BotFramework.AppID,
+			AppPassword: tc.BotFramework.AppPassword,
+			TenantID:    tc.BotFramework.TenantID,
+		},
+	)
+	return b.wrap(r, splitMode, steps, c.EnrichConcurrency, policy, c.Digest, c.RelabelConfigs)
+}
+
+// connectorParts creates the split mode, enrich steps and converter shared by the templated and bot connectors.
+// The templates of a connector with a digest must define card.DigestTemplate and its split mode must be "group".
+func (b routeBuilder) connectorParts(
+	tc PromTeamsConfig,
+	templateIncludes []string,
+	requestPath, split string,
+	enrichers []EnricherConfig,
+	digest *DigestConfig,
+	t TemplateConfig,
+) (service.SplitMode, []enrich.Step, card.Converter, error) {
+	splitMode, err := service.ParseSplitMode(split)
+	if err != nil {
+		return splitMode, nil, nil, fmt.Errorf("request_path '%s': %w", requestPath, err)
+	}
+
+	var required []string
+	if digest != nil {
+		// The digest is one card of all the alerts of its window, splitting it would post copies of that card.
+		if splitMode != service.SplitGroup {
+			return splitMode, nil, nil, fmt.Errorf(
+				"the digest cannot be used with split_mode '%s' for request_path '%s'", splitMode, requestPath,
+			)
+		}
+		if len(t.LayoutFile) > 0 {
+			return splitMode, nil, nil, fmt.Errorf(
+				"the digest is rendered by the '%s' template and cannot be used with a layout_file for request_path '%s'",
+				card.DigestTemplate, requestPath,
+			)
+		}
+		required = append(required, card.DigestTemplate)
+	}
+	converter, err := newConverter(t, templateIncludes, b.templateFuncs, required...)
+	if err != nil {
+		return splitMode, nil, nil, err
+	}
+
+	steps, err := enrichSteps(enrichers, b.enrichClient)
+	if err != nil {
+		return splitMode, nil, nil, fmt.Errorf("request_path '%s': %w", requestPath, err)
+	}
+
+	converter = card.NewMentionMiddleware(tc.cardMentions(), converter)
+	converter = card.NewCreatorLoggingMiddleware(
+		log.With(
+			b.logger,
+			"template_file", t.TemplateFile,
+			"template_files", strings.Join(t.TemplateFiles, ","),
+			"layout_file", t.LayoutFile,
+			"escaped_underscores", t.EscapeUnderscores,
+		),
+		b.payloadLog,
+		converter,
+	)
+	converter = card.NewInstrumentingMiddleware(t.templateName(), converter)
+	return splitMode, steps, converter, nil
+}
+
+// wrap decorates the delivery service of a route with the services of its config.
+func (b routeBuilder) wrap(
+	r transport.Route,
+	splitMode service.SplitMode,
+	steps []enrich.Step,
+	enrichConcurrency int,
+	policy service.RetryPolicy,
+	digest *DigestConfig,
+	relabelConfigs []*relabel.Config,
+) (transport.Route, error) {
+	if enrichConcurrency < 0 {
+		return r, fmt.Errorf("the enrich_concurrency must not be negative for request_path '%s'", r.RequestPath)
+	}
+
+	var err error
+	r.Service = service.NewSplittingService(splitMode, r.Service)
+	r.Service = service.NewEnrichingService(b.logger, enrichConcurrency, steps, r.Service)
+	r.Service = service.NewDeadlineService(policy.Deadline, r.Service)
+	r.Service, err = digest.withDigest(b.logger, r.Service)
+	if err != nil {
+		return r, fmt.Errorf("request_path '%s': %w", r.RequestPath, err)
+	}
+	b.flushers.add(r.Service)
+	r.Service = service.NewRelabelService(relabelConfigs, r.Service)
+	r.Service = service.NewLoggingService(b.logger, b.payloadLog, r.Service)
+	return r, nil
+}
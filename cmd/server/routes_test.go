@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_routeBuilder_digest(t *testing.T) {
+	digest := &DigestConfig{Window: time.Minute}
+	tests := []struct {
+		name      string
+		config    TemplateConfig
+		splitMode string
+		wantErr   string
+	}{
+		{
+			name:   "digest template",
+			config: TemplateConfig{TemplateFiles: []string{"../../default-message-card.tmpl", "../../examples/templates/digest-message-card.tmpl"}},
+		},
+		{
+			name:    "no digest template",
+			config:  TemplateConfig{TemplateFile: "../../default-message-card.tmpl"},
+			wantErr: "'teams.digest' is not defined",
+		},
+		{
+			name:    "layout file",
+			config:  TemplateConfig{LayoutFile: "../../examples/layouts/default-layout.yaml"},
+			wantErr: "cannot be used with a layout_file",
+		},
+		{
+			name:      "split by alert",
+			config:    TemplateConfig{TemplateFiles: []string{"../../default-message-card.tmpl", "../../examples/templates/digest-message-card.tmpl"}},
+			splitMode: "alert",
+			wantErr:   "cannot be used with split_mode 'alert'",
+		},
+		{
+			name:      "split by label",
+			config:    TemplateConfig{TemplateFiles: []string{"../../default-message-card.tmpl", "../../examples/templates/digest-message-card.tmpl"}},
+			splitMode: "by_label:instance",
+			wantErr:   "cannot be used with split_mode 'by_label:instance'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := testRouteBuilder(t)
+			rb.flushers = &flushers{}
+			_, err := rb.routes(PromTeamsConfig{ConnectorsWithCustomTemplates: []ConnectorWithCustomTemplate{{
+				RequestPath:    "/digest",
+				WebhookURL:     "https://example.webhook.office.com/webhookb2/x",
+				Digest:         digest,
+				SplitMode:      tt.splitMode,
+				TemplateConfig: tt.config,
+			}}})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rb.flushers.fs) != 1 {
+				t.Fatalf("want the digest flushed at shutdown, got %d flushers", len(rb.flushers.fs))
+			}
+		})
+	}
+}
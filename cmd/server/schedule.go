@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
+)
+
+// ScheduleConfig applies an action to the messages of connectors during a recurring time window.
+type ScheduleConfig struct {
+	Name string `yaml:"name"`
+	// Timezone is an IANA name like "Europe/Berlin", UTC if empty.
+	Timezone string `yaml:"timezone"`
+	// Days are weekdays like "saturday" or "sat", every day if empty.
+	Days []string `yaml:"days"`
+	// Hours are ranges like "22:00-07:00", the whole day if empty.
+	Hours []string `yaml:"hours"`
+	// Connectors are the request paths the rule applies to, all connectors if empty.
+	Connectors []string `yaml:"connectors"`
+	// Matchers are regular expressions the common labels must match, e.g. severity: "info|warning".
+	Matchers map[string]string `yaml:"matchers"`
+	// Action is "drop", "delay" or "reroute".
+	Action string `yaml:"action"`
+	// RerouteTo is the request path of the connector used by the reroute action.
+	RerouteTo string `yaml:"reroute_to"`
+	// MaxDelay bounds the delay action, the message is posted after it even if the window is still open.
+	// 24h if 0.
+	MaxDelay time.Duration `yaml:"max_delay"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func (sc ScheduleConfig) appliesTo(requestPath string) bool {
+	if len(sc.Connectors) == 0 {
+		return true
+	}
+	for _, c := range sc.Connectors {
+		if c == requestPath {
+			return true
+		}
+	}
+	return false
+}
+
+// rule converts the config, services are the connectors a message can be rerouted to.
+func (sc ScheduleConfig) rule(services map[string]service.Service) (service.ScheduleRule, error) {
+	r := service.ScheduleRule{
+		Name:     sc.Name,
+		Action:   service.ScheduleAction(sc.Action),
+		Matchers: map[string]*regexp.Regexp{},
+		MaxDelay: sc.MaxDelay,
+	}
+	if sc.MaxDelay < 0 || (sc.MaxDelay > 0 && r.Action != service.ScheduleDelay) {
+		return r, fmt.Errorf("schedule '%s': max_delay must be positive and is only used by the delay action", sc.Name)
+	}
+
+	loc, err := time.LoadLocation(sc.Timezone)
+	if err != nil {
+		return r, fmt.Errorf("schedule '%s': %w", sc.Name, err)
+	}
+	r.Window.Location = loc
+
+	for _, d := range sc.Days {
+		wd, ok := lookupWeekday(d)
+		if !ok {
+			return r, fmt.Errorf("schedule '%s': invalid day '%s'", sc.Name, d)
+		}
+		r.Window.Weekdays = append(r.Window.Weekdays, wd)
+	}
+
+	for _, h := range sc.Hours {
+		hr, err := service.ParseHourRange(h)
+		if err != nil {
+			return r, fmt.Errorf("schedule '%s': %w", sc.Name, err)
+		}
+		r.Window.Hours = append(r.Window.Hours, hr)
+	}
+
+	for name, expr := range sc.Matchers {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return r, fmt.Errorf("schedule '%s': invalid matcher for label '%s': %w", sc.Name, name, err)
+		}
+		r.Matchers[name] = re
+	}
+
+	switch r.Action {
+	case service.ScheduleDrop, service.ScheduleDelay:
+	case service.ScheduleReroute:
+		s, ok := services[sc.RerouteTo]
+		if !ok {
+			return r, fmt.Errorf("schedule '%s': reroute_to '%s' is not a connector", sc.Name, sc.RerouteTo)
+		}
+		r.Reroute = s
+	default:
+		return r, fmt.Errorf("schedule '%s': invalid action '%s', must be 'drop', 'delay' or 'reroute'", sc.Name, sc.Action)
+	}
+	return r, nil
+}
+
+func lookupWeekday(d string) (time.Weekday, bool) {
+	d = strings.ToLower(d)
+	for name, wd := range weekdays {
+		if name == d || (len(d) == 3 && strings.HasPrefix(name, d)) {
+			return wd, true
+		}
+	}
+	return 0, false
+}
+
+// applySchedules wraps the services of the routes with the schedule rules applying to them.
+// Messages are rerouted to the service of a connector without its schedule rules,
+// the metrics of their delivery are labelled with the route of that connector.
+func applySchedules(logger log.Logger, schedules []ScheduleConfig, routes []transport.Route) error {
+	services := map[string]service.Service{}
+	for _, r := range routes {
+		services[r.RequestPath] = service.NewRouteService(r.RequestPath, r.Service)
+	}
+
+	for i, r := range routes {
+		var rules []service.ScheduleRule
+		for _, sc := range schedules {
+			if !sc.appliesTo(r.RequestPath) {
+				continue
+			}
+			rule, err := sc.rule(services)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, rule)
+		}
+		routes[i].Service = service.NewScheduleService(
+			log.With(logger, "request_path", r.RequestPath),
+			rules,
+			r.Service,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+type countingService struct {
+	posts int
+	// route is the route of the last post.
+	route string
+}
+
+func (s *countingService) Post(ctx context.Context, _ webhook.Message) ([]service.PostResponse, error) {
+	s.posts++
+	s.route = service.RouteFromContext(ctx)
+	return nil, nil
+}
+
+func TestScheduleConfig_rule(t *testing.T) {
+	sc := ScheduleConfig{
+		Name:     "weekend",
+		Timezone: "Europe/Berlin",
+		Days:     []string{"Sat", "sunday"},
+		Hours:    []string{"00:00-24:00"},
+		Matchers: map[string]string{"severity": "info|warning"},
+		Action:   "drop",
+	}
+	r, err := sc.rule(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Weekday{time.Saturday, time.Sunday}; len(r.Window.Weekdays) != 2 ||
+		r.Window.Weekdays[0] != want[0] || r.Window.Weekdays[1] != want[1] {
+		t.Fatalf("want weekdays %v, got %v", want, r.Window.Weekdays)
+	}
+	if !r.Matchers["severity"].MatchString("warning") || r.Matchers["severity"].MatchString("warnings") {
+		t.Fatal("matcher must match the whole label value")
+	}
+
+	for _, invalid := range []ScheduleConfig{
+		{Name: "day", Days: []string{"someday"}, Action: "drop"},
+		{Name: "timezone", Timezone: "Mars/Olympus", Action: "drop"},
+		{Name: "action", Action: "ignore"},
+		{Name: "reroute", Action: "reroute", RerouteTo: "/unknown"},
+	} {
+		if _, err := invalid.rule(nil); err == nil {
+			t.Errorf("schedule '%s': want error", invalid.Name)
+		}
+	}
+}
+
+func Test_applySchedules(t *testing.T) {
+	alerts, low := &countingService{}, &countingService{}
+	routes := []transport.Route{
+		{RequestPath: "/alerts", Service: alerts},
+		{RequestPath: "/low", Service: low},
+	}
+	schedules := []ScheduleConfig{
+		{
+			Name:       "always",
+			Connectors: []string{"/alerts"},
+			Matchers:   map[string]string{"severity": "info"},
+			Action:     "reroute",
+			RerouteTo:  "/low",
+		},
+	}
+	if err := applySchedules(log.NewNopLogger(), schedules, routes); err != nil {
+		t.Fatal(err)
+	}
+
+	info := webhook.Message{Data: &template.Data{CommonLabels: template.KV{"severity": "info"}}}
+	critical := webhook.Message{Data: &template.Data{CommonLabels: template.KV{"severity": "critical"}}}
+	for _, m := range []webhook.Message{info, critical, info} {
+		if _, err := routes[0].Service.Post(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if alerts.posts != 1 || low.posts != 2 {
+		t.Fatalf("want 1 posted and 2 rerouted, got %d and %d", alerts.posts, low.posts)
+	}
+	if low.route != "/low" {
+		t.Fatalf("want the rerouted messages labelled with their new route, got %q", low.route)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/silence"
+)
+
+// SilenceActionsConfig enables the silence buttons of the cards, see the silenceActionURL template function.
+type SilenceActionsConfig struct {
+	// AlertmanagerURL is the Alertmanager the silences are created in.
+	AlertmanagerURL string `yaml:"alertmanager_url"`
+	// ExternalURL is the URL prometheus-msteams is reachable at from Teams.
+	ExternalURL string `yaml:"external_url"`
+	// SigningKey or SigningKeyFile is the secret the action tokens are signed with.
+	SigningKey     string `yaml:"signing_key"`
+	SigningKeyFile string `yaml:"signing_key_file"`
+	// TokenTTL is how long the buttons of a card work, 24h if 0.
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	// AckDuration is the duration of the silence created by the Ack button, 24h if 0.
+	AckDuration time.Duration `yaml:"ack_duration"`
+}
+
+// actions creates the silence actions, nil if not configured.
+func (sc *SilenceActionsConfig) actions(logger log.Logger) (*silence.Actions, error) {
+	if sc == nil {
+		return nil, nil
+	}
+	if sc.AlertmanagerURL == "" || sc.ExternalURL == "" {
+		return nil, fmt.Errorf("the silence_actions alertmanager_url and external_url are required")
+	}
+
+	key := sc.SigningKey
+	if sc.SigningKeyFile != "" {
+		b, err := os.ReadFile(sc.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = strings.TrimSpace(string(b))
+	}
+	signer, err := silence.NewSigner([]byte(key), sc.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: instrumentedTransport(nil), Timeout: 10 * time.Second}
+	return silence.NewActions(
+		log.With(logger, "component", "silence_actions"),
+		signer,
+		silence.NewClient(client, sc.AlertmanagerURL),
+		sc.ExternalURL,
+		sc.AckDuration,
+	), nil
+}
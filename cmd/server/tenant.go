@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+// validTenantName restricts the tenant names, they are part of the request paths.
+var validTenantName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+var tenantConfigLoaded = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "prometheus_msteams_tenant_config_loaded",
+		Help: "Whether the config file of a tenant was loaded (1) or failed to load (0).",
+	},
+	[]string{"tenant"},
+)
+
+// RateLimitConfig limits the notifications of a tenant.
+type RateLimitConfig struct {
+	// NotificationsPerMinute is the sustained rate of the notifications of all routes of the tenant.
+	NotificationsPerMinute float64 `yaml:"notifications_per_minute"`
+	// Burst is the number of notifications accepted at once, notifications_per_minute if 0.
+	Burst int `yaml:"burst"`
+}
+
+// limiter creates the limiter of the config, none if nil.
+func (rc *RateLimitConfig) limiter() (*rate.Limiter, error) {
+	if rc == nil {
+		return nil, nil
+	}
+	if rc.NotificationsPerMinute <= 0 {
+		return nil, fmt.Errorf("the rate_limit notifications_per_minute must be positive")
+	}
+	if rc.Burst < 0 {
+		return nil, fmt.Errorf("the rate_limit burst must not be negative")
+	}
+	burst := rc.Burst
+	if burst == 0 {
+		burst = int(math.Ceil(rc.NotificationsPerMinute))
+	}
+	return rate.NewLimiter(rate.Limit(rc.NotificationsPerMinute/60), burst), nil
+}
+
+// tenantPathPrefix is the prefix of the request paths of a tenant.
+func tenantPathPrefix(tenant string) string {
+	return "/t/" + tenant
+}
+
+// loadTenants loads the tenant config files of the directory, named <tenant>.yml or <tenant>.yaml.
+// A tenant failing to load, or using a request path of the routes, is logged and skipped.
+// The defaultRateLimit applies to the tenants without rate_limit.
+func loadTenants(b routeBuilder, defaultRateLimit *RateLimitConfig, dir string, routes []transport.Route) ([]transport.Route, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	for _, r := range routes {
+		used[r.RequestPath] = true
+	}
+	loaded := map[string]bool{}
+
+	var tenantRoutes []transport.Route
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		tenant := strings.TrimSuffix(e.Name(), ext)
+
+		var rs []transport.Route
+		if loaded[tenant] {
+			err = fmt.Errorf("the tenant has several config files")
+		} else {
+			rs, err = loadTenant(b, defaultRateLimit, tenant, filepath.Join(dir, e.Name()), used)
+		}
+		if err != nil {
+			level.Error(b.logger).Log("msg", "failed to load the tenant config", "tenant", tenant, "file", e.Name(), "err", err)
+			tenantConfigLoaded.WithLabelValues(tenant).Set(0)
+			continue
+		}
+
+		loaded[tenant] = true
+		for _, r := range rs {
+			used[r.RequestPath] = true
+		}
+		tenantConfigLoaded.WithLabelValues(tenant).Set(1)
+		level.Info(b.logger).Log("msg", "tenant config loaded", "tenant", tenant, "routes", len(rs))
+		tenantRoutes = append(tenantRoutes, rs...)
+	}
+	return tenantRoutes, nil
+}
+
+// loadTenant builds the routes of a tenant config file under the path prefix of the tenant.
+// used are the request paths already served.
+func loadTenant(
+	b routeBuilder, defaultRateLimit *RateLimitConfig, tenant, file string, used map[string]bool,
+) ([]transport.Route, error) {
+	if !validTenantName.MatchString(tenant) {
+		return nil, fmt.Errorf("invalid tenant name '%s', must match %s", tenant, validTenantName)
+	}
+	tc, err := parseTeamsConfigFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := tc.validateTenant(); err != nil {
+		return nil, err
+	}
+
+	rl := tc.RateLimit
+	if rl == nil {
+		rl = defaultRateLimit
+	}
+	limiter, err := rl.limiter()
+	if err != nil {
+		return nil, err
+	}
+
+	b.logger = log.With(b.logger, "tenant", tenant)
+	if tc.Retry != nil {
+		p, err := tc.Retry.policy(b.clients.policy)
+		if err != nil {
+			return nil, err
+		}
+		if b.clients, err = newTeamsClients(b.logger, b.clients.opts, p); err != nil {
+			return nil, err
+		}
+	}
+
+	routes, err := b.routes(tc.namespaced(tenantPathPrefix(tenant)))
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range routes {
+		if used[r.RequestPath] {
+			return nil, fmt.Errorf("found duplicate use of request path '%s'", r.RequestPath)
+		}
+		routes[i].Service = service.NewTenantService(tenant, limiter, r.Service)
+	}
+	return routes, nil
+}
+
+// validateTenant rejects the settings of the config file a tenant config file cannot override.
+func (tc PromTeamsConfig) validateTenant() error {
+	if tc.SilenceActions != nil {
+		return fmt.Errorf("silence_actions is only supported in the config file")
+	}
+	if tc.Admin != nil {
+		return fmt.Errorf("admin is only supported in the config file")
+	}
+	pl := tc.PayloadLogging
+	if pl.Mode != "" || pl.MaxBytes != 0 || len(pl.RedactLabels) > 0 || len(pl.RedactAnnotations) > 0 {
+		return fmt.Errorf("payload_logging is only supported in the config file")
+	}
+	return nil
+}
+
+// namespaced returns the config with the request paths of its connectors and schedules under the prefix.
+func (tc PromTeamsConfig) namespaced(prefix string) PromTeamsConfig {
+	path := func(p string) string {
+		if p == "" {
+			return ""
+		}
+		return prefix + "/" + strings.TrimPrefix(p, "/")
+	}
+
+	connectors := make([]map[string]string, 0, len(tc.Connectors))
+	for _, c := range tc.Connectors {
+		m := make(map[string]string, len(c))
+		for uri, webhook := range c {
+			m[path(uri)] = webhook
+		}
+		connectors = append(connectors, m)
+	}
+	tc.Connectors = connectors
+
+	templated := make([]ConnectorWithCustomTemplate, len(tc.ConnectorsWithCustomTemplates))
+	for i, c := range tc.ConnectorsWithCustomTemplates {
+		c.RequestPath = path(c.RequestPath)
+		templated[i] = c
+	}
+	tc.ConnectorsWithCustomTemplates = templated
+
+	bots := make([]BotConnector, len(tc.BotConnectors))
+	for i, c := range tc.BotConnectors {
+		c.RequestPath = path(c.RequestPath)
+		bots[i] = c
+	}
+	tc.BotConnectors = bots
+
+	schedules := make([]ScheduleConfig, len(tc.Schedules))
+	for i, sc := range tc.Schedules {
+		cs := make([]string, 0, len(sc.Connectors))
+		for _, c := range sc.Connectors {
+			cs = append(cs, path(c))
+		}
+		sc.Connectors = cs
+		sc.RerouteTo = path(sc.RerouteTo)
+		schedules[i] = sc
+	}
+	tc.Schedules = schedules
+	return tc
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func testRouteBuilder(t *testing.T) routeBuilder {
+	t.Helper()
+	tmpl, err := card.ParseTemplateFile("../../default-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := newTeamsClients(log.NewNopLogger(), httpClientOptions{}, service.DefaultRetryPolicy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routeBuilder{
+		logger:           log.NewNopLogger(),
+		webhookType:      service.O365,
+		defaultConverter: card.NewTemplatedCardCreator(tmpl, false),
+		clients:          clients,
+		enrichClient:     http.DefaultClient,
+	}
+}
+
+func Test_loadTenants(t *testing.T) {
+	teams := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("1"))
+	}))
+	defer teams.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"payments.yml": `
+connectors:
+- /alerts: ` + teams.URL + `
+connectors_with_custom_templates:
+- request_path: quiet
+  webhook_url: ` + teams.URL + `
+  template_file: ../../default-message-card.tmpl
+schedules:
+- name: never
+  days: [monday]
+  hours: ["00:00-00:01"]
+  connectors: [/alerts]
+  action: reroute
+  reroute_to: /quiet
+rate_limit:
+  notifications_per_minute: 1
+  burst: 1
+`,
+		"search.yaml": `
+connectors:
+- /alerts: ` + teams.URL + `
+`,
+		"broken.yml":   "connectors: [",
+		"conflict.yml": "connectors:\n- /x: " + teams.URL + "\n",
+		"bad name.yml": "connectors: []\n",
+		"README.md":    "not a tenant",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	existing := []transport.Route{{RequestPath: "/t/conflict/x"}}
+	routes, err := loadTenants(testRouteBuilder(t), &RateLimitConfig{NotificationsPerMinute: 60}, dir, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := map[string]service.Service{}
+	for _, r := range routes {
+		services[r.RequestPath] = r.Service
+	}
+	for _, p := range []string{"/t/payments/alerts", "/t/payments/quiet", "/t/search/alerts"} {
+		if services[p] == nil {
+			t.Errorf("want the route %s, got %v", p, services)
+		}
+	}
+	if len(services) != 3 {
+		t.Fatalf("want only the routes of the valid tenants, got %v", services)
+	}
+	for tenant, want := range map[string]float64{"payments": 1, "search": 1, "broken": 0, "conflict": 0, "bad name": 0} {
+		if got := testutil.ToFloat64(tenantConfigLoaded.WithLabelValues(tenant)); got != want {
+			t.Errorf("tenant %s: want loaded %v, got %v", tenant, want, got)
+		}
+	}
+
+	wm, err := testutils.ParseWebhookJSONFromFile("../../pkg/card/testdata/prom_post_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := services["/t/payments/alerts"]
+	if _, err := s.Post(context.Background(), wm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services["/t/payments/quiet"].Post(context.Background(), wm); !errors.Is(err, service.ErrRateLimited) {
+		t.Fatalf("want the rate limit shared by the routes of the tenant, got %v", err)
+	}
+	if _, err := services["/t/search/alerts"].Post(context.Background(), wm); err != nil {
+		t.Fatalf("want the other tenants not limited, got %v", err)
+	}
+}
+
+func TestRateLimitConfig_limiter(t *testing.T) {
+	l, err := (&RateLimitConfig{NotificationsPerMinute: 30}).limiter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Burst() != 30 || l.Limit() != 0.5 {
+		t.Fatalf("want 0.5/s with a burst of 30, got %v/s and %d", l.Limit(), l.Burst())
+	}
+	if l, err := (*RateLimitConfig)(nil).limiter(); l != nil || err != nil {
+		t.Fatalf("want no limiter, got %v, %v", l, err)
+	}
+	if _, err := (&RateLimitConfig{}).limiter(); err == nil {
+		t.Fatal("want an error without rate")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/version"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Supported trace exporters.
+const (
+	otlpGRPCExporter = "otlp-grpc"
+	otlpHTTPExporter = "otlp-http"
+)
+
+// tracingOptions configures the OpenTelemetry trace exporter.
+type tracingOptions struct {
+	// Exporter is "otlp-grpc" or "otlp-http".
+	Exporter string
+	// Endpoint is the host and port of the collector, the OTEL_EXPORTER_OTLP_ENDPOINT or exporter default if empty.
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the ratio of the traces without a parent that are sampled.
+	// Traces continued from Alertmanager follow the sampling decision of their parent.
+	SampleRatio float64
+}
+
+// newTracerProvider creates a tracer provider exporting spans with OTLP.
+func newTracerProvider(ctx context.Context, o tracingOptions) (*sdktrace.TracerProvider, error) {
+	if o.SampleRatio < 0 || o.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid traces sample ratio %v, must be between 0 and 1", o.SampleRatio)
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch o.Exporter {
+	case otlpGRPCExporter:
+		var opts []otlptracegrpc.Option
+		if o.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(o.Endpoint))
+		}
+		if o.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case otlpHTTPExporter:
+		var opts []otlptracehttp.Option
+		if o.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(o.Endpoint))
+		}
+		if o.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("invalid traces exporter '%s', must be '%s' or '%s'", o.Exporter, otlpGRPCExporter, otlpHTTPExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(
+			attribute.String("service.name", "prometheus-msteams"),
+			attribute.String("service.version", version.VERSION),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SampleRatio))),
+		sdktrace.WithSpanProcessor(requestIDSpanProcessor{}),
+	), nil
+}
+
+// requestIDSpanProcessor adds the request ID of the context to every span started with it.
+type requestIDSpanProcessor struct{}
+
+func (requestIDSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if id := requestid.FromContext(ctx); id != "" {
+		s.SetAttributes(attribute.String("request.id", id))
+	}
+}
+
+func (requestIDSpanProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (requestIDSpanProcessor) Shutdown(context.Context) error   { return nil }
+func (requestIDSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// setTextMapPropagator propagates W3C trace context and baggage, from Alertmanager and onward to Teams.
+func setTextMapPropagator() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// instrumentedTransport traces the requests with OpenTelemetry and records the OpenCensus HTTP client views.
+func instrumentedTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(&ochttp.Transport{Base: base})
+}
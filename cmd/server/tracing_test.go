@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_newTracerProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    tracingOptions
+		wantErr bool
+	}{
+		{"grpc", tracingOptions{Exporter: otlpGRPCExporter, Endpoint: "localhost:4317", Insecure: true, SampleRatio: 1}, false},
+		{"http", tracingOptions{Exporter: otlpHTTPExporter, Endpoint: "localhost:4318", SampleRatio: 0.1}, false},
+		{"unknown exporter", tracingOptions{Exporter: "jaeger", SampleRatio: 1}, true},
+		{"invalid sample ratio", tracingOptions{Exporter: otlpGRPCExporter, SampleRatio: 2}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := newTracerProvider(context.Background(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+			if tp != nil {
+				_ = tp.Shutdown(context.Background())
+			}
+		})
+	}
+}
+
+func Test_requestIDSpanProcessor(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(requestIDSpanProcessor{}),
+		sdktrace.WithSpanProcessor(sr),
+	)
+	tracer := tp.Tracer("test")
+
+	ctx, parent := tracer.Start(requestid.NewContext(context.Background(), "abc-123"), "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+	_, other := tracer.Start(context.Background(), "other")
+	other.End()
+
+	for _, s := range sr.Ended() {
+		var got string
+		for _, a := range s.Attributes() {
+			if a.Key == "request.id" {
+				got = a.Value.AsString()
+			}
+		}
+		want := "abc-123"
+		if s.Name() == "other" {
+			want = ""
+		}
+		if got != want {
+			t.Errorf("span %s: want request ID %q, got %q", s.Name(), want, got)
+		}
+	}
+}
@@ -13,6 +13,8 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/decode"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/transport"
@@ -33,6 +35,11 @@ func TestServer(t *testing.T) {
 
 	c := card.NewTemplatedCardCreator(tmpl, false)
 
+	grafana, err := decode.New(&decode.Config{Format: decode.Grafana})
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
 
 	// Create a dummy Microsoft teams server.
@@ -73,6 +80,7 @@ func TestServer(t *testing.T) {
 					RequestPath: "/alertmanager",
 					Service: service.NewLoggingService(
 						logger,
+						card.PayloadLogOptions{},
 						service.NewSimpleService(
 							c, http.DefaultClient, testWebhookURL, service.O365,
 						),
@@ -86,6 +94,24 @@ func TestServer(t *testing.T) {
 				},
 			},
 		},
+		{
+			"grafana decoder test",
+			[]transport.Route{
+				{
+					RequestPath: "/grafana",
+					Decoder:     grafana,
+					Service: service.NewSimpleService(
+						c, http.DefaultClient, testWebhookURL, service.O365,
+					),
+				},
+			},
+			[]alert{
+				{
+					requestPath:   "/grafana",
+					promAlertFile: "../pkg/decode/testdata/grafana.json",
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -98,11 +124,7 @@ func TestServer(t *testing.T) {
 
 			// Post the request for each alerts.
 			for _, a := range tt.alerts {
-				wm, err := testutils.ParseWebhookJSONFromFile(a.promAlertFile)
-				if err != nil {
-					t.Fatal(err)
-				}
-				b, err := json.Marshal(wm)
+				b, err := os.ReadFile(a.promAlertFile)
 				if err != nil {
 					t.Fatal(err)
 				}
@@ -114,6 +136,7 @@ func TestServer(t *testing.T) {
 				if err != nil {
 					t.Fatal(err)
 				}
+				req.Header.Set(requestid.Header, "e2e-request")
 
 				resp, err := http.DefaultClient.Do(req)
 				if err != nil {
@@ -124,6 +147,9 @@ func TestServer(t *testing.T) {
 				if resp.StatusCode != 200 {
 					t.Fatalf("want '%d', got '%d'", 200, resp.StatusCode)
 				}
+				if got := resp.Header.Get(requestid.Header); got != "e2e-request" {
+					t.Fatalf("want request ID '%s', got '%s'", "e2e-request", got)
+				}
 
 				var prs []service.PostResponse
 				if err := json.NewDecoder(resp.Body).Decode(&prs); err != nil {
@@ -4,12 +4,18 @@ package card
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
 	"github.com/prometheus/alertmanager/notify/webhook"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/prometheus-msteams/prometheus-msteams/pkg/card")
+
 // Office365ConnectorCard represents https://docs.microsoft.com/en-us/microsoftteams/platform/task-modules-and-cards/cards/cards-reference#example-office-365-connector-card
 type Office365ConnectorCard struct {
 	Context         string    `json:"@context"`
@@ -21,6 +27,25 @@ type Office365ConnectorCard struct {
 	ThemeColor      string    `json:"themeColor"`
 	Sections        []Section `json:"sections,omitempty"`
 	PotentialAction []Action  `json:"potentialAction,omitempty"`
+	// Extra holds the card fields which are not modelled, e.g. heroImage or correlationId.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Office365ConnectorCard) UnmarshalJSON(b []byte) error {
+	type plain Office365ConnectorCard
+	if err := json.Unmarshal(b, (*plain)(c)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(b, c)
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Office365ConnectorCard) MarshalJSON() ([]byte, error) {
+	type plain Office365ConnectorCard
+	return marshalWithExtra(plain(c), c.Extra)
 }
 
 // Image represents https://docs.microsoft.com/en-us/outlook/actionable-messages/message-card-reference#image-object
@@ -45,6 +70,25 @@ type Section struct {
 	Facts            []FactSection `json:"facts,omitempty"`
 	Images           []Image       `json:"images,omitempty"`
 	PotentialAction  []Action      `json:"potentialAction,omitempty"`
+	// Extra holds the section fields which are not modelled, e.g. heroImage.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Section) UnmarshalJSON(b []byte) error {
+	type plain Section
+	if err := json.Unmarshal(b, (*plain)(s)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(b, s)
+	s.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Section) MarshalJSON() ([]byte, error) {
+	type plain Section
+	return marshalWithExtra(plain(s), s.Extra)
 }
 
 // FactSection represents a name/value pair fact in an Office365 connector card section.
@@ -57,16 +101,33 @@ type FactSection struct {
 type Converter interface {
 	Convert(context.Context, webhook.Message) (Office365ConnectorCard, error)
 	ConvertWorkflow(context.Context, webhook.Message) (WorkflowConnectorCard, error)
+	// ConvertRaw returns the JSON rendered by the template as is, e.g. for a Slack message.
+	ConvertRaw(context.Context, webhook.Message) (json.RawMessage, error)
 }
 
 type loggingMiddleware struct {
 	logger log.Logger
+	opts   PayloadLogOptions
 	next   Converter
 }
 
-// NewCreatorLoggingMiddleware creates a loggingMiddleware.
-func NewCreatorLoggingMiddleware(l log.Logger, n Converter) Converter {
-	return loggingMiddleware{l, n}
+// NewCreatorLoggingMiddleware creates a loggingMiddleware logging the conversions at debug level,
+// with the payload described by the options.
+func NewCreatorLoggingMiddleware(l log.Logger, opts PayloadLogOptions, n Converter) Converter {
+	return loggingMiddleware{l, opts, n}
+}
+
+// log logs the summary of the conversion, and the payload with PayloadLogFull.
+// The logged card is rendered again from the redacted message if the options redact values,
+// only when the debug line is written.
+func (l loggingMiddleware) log(ctx context.Context, a webhook.Message, c interface{}, took time.Duration, render func(webhook.Message) (interface{}, error)) {
+	keyvals := l.opts.Summary(a)
+	if l.opts.Mode == PayloadLogFull && l.opts.Redacts() {
+		c = renderedCard(func() (interface{}, error) { return render(l.opts.Redact(a)) })
+	}
+	keyvals = append(keyvals, l.opts.Payload(a, c)...)
+	keyvals = append(keyvals, "took", took)
+	_ = level.Debug(requestid.Logger(ctx, l.logger)).Log(keyvals...)
 }
 
 func (l loggingMiddleware) Convert(ctx context.Context, a webhook.Message) (c Office365ConnectorCard, err error) {
@@ -87,11 +148,9 @@ func (l loggingMiddleware) Convert(ctx context.Context, a webhook.Message) (c Of
 			}
 		}
 
-		_ = l.logger.Log(
-			"alert", a,
-			"card", c,
-			"took", time.Since(begin),
-		)
+		l.log(ctx, a, c, time.Since(begin), func(wm webhook.Message) (interface{}, error) {
+			return l.next.Convert(ctx, wm)
+		})
 	}(time.Now())
 	return l.next.Convert(ctx, a)
 }
@@ -2,6 +2,7 @@ package card
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/prometheus/alertmanager/notify/webhook"
@@ -14,8 +15,43 @@ type BackgroundImage struct {
 }
 
 // MsTeams represents Microsoft Teams-specific configuration in an adaptive card.
+// Properties which are not modelled are kept in Extra and written back when marshalling.
 type MsTeams struct {
-	Width string `json:"width"`
+	Width    string                     `json:"width,omitempty"`
+	Entities []Entity                   `json:"entities,omitempty"`
+	Extra    map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *MsTeams) UnmarshalJSON(b []byte) error {
+	type plain MsTeams
+	if err := json.Unmarshal(b, (*plain)(m)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(b, m)
+	m.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m MsTeams) MarshalJSON() ([]byte, error) {
+	type plain MsTeams
+	return marshalWithExtra(plain(m), m.Extra)
+}
+
+// Entity represents an entry of msteams.entities, see https://learn.microsoft.com/en-us/microsoftteams/platform/task-modules-and-cards/cards/cards-format#mention-support-within-adaptive-cards
+type Entity struct {
+	Type      string     `json:"type"`
+	Text      string     `json:"text,omitempty"`
+	Mentioned *Mentioned `json:"mentioned,omitempty"`
+}
+
+// Mentioned is the user or tag referenced by a mention entity.
+type Mentioned struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Type is empty for users and "tag" for tags.
+	Type string `json:"type,omitempty"`
 }
 
 // Content represents the content of an adaptive card for Workflow connector cards.
@@ -27,6 +63,25 @@ type Content struct {
 	MsTeams         MsTeams                  `json:"msteams"`
 	Actions         []Action                 `json:"actions,omitempty"`
 	BackgroundImage BackgroundImage          `json:"backgroundImage,omitempty"`
+	// Extra holds the Adaptive Card properties which are not modelled, e.g. fallbackText, speak or refresh.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Content) UnmarshalJSON(b []byte) error {
+	type plain Content
+	if err := json.Unmarshal(b, (*plain)(c)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(b, c)
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c Content) MarshalJSON() ([]byte, error) {
+	type plain Content
+	return marshalWithExtra(plain(c), c.Extra)
 }
 
 // AdaptiveCardItem represents an adaptive card item within a Workflow connector card attachment.
@@ -34,12 +89,50 @@ type AdaptiveCardItem struct {
 	ContentType string  `json:"contentType"` // Always "application/vnd.microsoft.card.adaptive"
 	ContentURL  *string `json:"contentUrl"`  // Use a pointer to handle null values
 	Content     Content `json:"content"`
+	// Extra holds the attachment properties which are not modelled.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *AdaptiveCardItem) UnmarshalJSON(b []byte) error {
+	type plain AdaptiveCardItem
+	if err := json.Unmarshal(b, (*plain)(a)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(b, a)
+	a.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (a AdaptiveCardItem) MarshalJSON() ([]byte, error) {
+	type plain AdaptiveCardItem
+	return marshalWithExtra(plain(a), a.Extra)
 }
 
 // WorkflowConnectorCard represents a Microsoft Teams Workflow connector card message.
 type WorkflowConnectorCard struct {
 	Type        string             `json:"type"`
 	Attachments []AdaptiveCardItem `json:"attachments"`
+	// Extra holds the message properties which are not modelled.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (w *WorkflowConnectorCard) UnmarshalJSON(b []byte) error {
+	type plain WorkflowConnectorCard
+	if err := json.Unmarshal(b, (*plain)(w)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(b, w)
+	w.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (w WorkflowConnectorCard) MarshalJSON() ([]byte, error) {
+	type plain WorkflowConnectorCard
+	return marshalWithExtra(plain(w), w.Extra)
 }
 
 func (l loggingMiddleware) ConvertWorkflow(ctx context.Context, a webhook.Message) (c WorkflowConnectorCard, err error) {
@@ -53,11 +146,18 @@ func (l loggingMiddleware) ConvertWorkflow(ctx context.Context, a webhook.Messag
 			}
 		}
 
-		_ = l.logger.Log(
-			"alert", a,
-			"card", c,
-			"took", time.Since(begin),
-		)
+		l.log(ctx, a, c, time.Since(begin), func(wm webhook.Message) (interface{}, error) {
+			return l.next.ConvertWorkflow(ctx, wm)
+		})
 	}(time.Now())
 	return l.next.ConvertWorkflow(ctx, a)
 }
+
+func (l loggingMiddleware) ConvertRaw(ctx context.Context, a webhook.Message) (c json.RawMessage, err error) {
+	defer func(begin time.Time) {
+		l.log(ctx, a, c, time.Since(begin), func(wm webhook.Message) (interface{}, error) {
+			return l.next.ConvertRaw(ctx, wm)
+		})
+	}(time.Now())
+	return l.next.ConvertRaw(ctx, a)
+}
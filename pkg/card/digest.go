@@ -0,0 +1,70 @@
+package card
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// DigestTemplate is the template definition used to render a digest instead of "teams.card".
+const DigestTemplate = "teams.digest"
+
+// Digest summarizes the alerts received during a window, see templatedCard.
+type Digest struct {
+	// Window is the duration the alerts were collected for.
+	Window time.Duration
+	// Messages is the number of Alertmanager notifications merged into the digest.
+	Messages int
+	// Label is the label the alerts are grouped by.
+	Label    string
+	Firing   int
+	Resolved int
+	Groups   []DigestGroup
+}
+
+// DigestGroup are the alerts sharing a value of the digest label.
+type DigestGroup struct {
+	Value    string
+	Firing   int
+	Resolved int
+	// Alerts are the first alerts of the group, firing before resolved.
+	Alerts template.Alerts
+	// More is the number of alerts not listed in Alerts.
+	More int
+}
+
+// NewDigest groups the alerts by the label and keeps at most topN alerts per group,
+// topN < 1 keeps all. Groups with the most firing alerts come first.
+func NewDigest(alerts template.Alerts, label string, topN int) *Digest {
+	d := &Digest{Label: label}
+	for _, g := range groupBy(label, alerts) {
+		dg := DigestGroup{Value: g.Value}
+		firing, resolved := g.Alerts.Firing(), g.Alerts.Resolved()
+		dg.Firing, dg.Resolved = len(firing), len(resolved)
+		dg.Alerts = append(append(template.Alerts{}, firing...), resolved...)
+		if topN > 0 && len(dg.Alerts) > topN {
+			dg.More = len(dg.Alerts) - topN
+			dg.Alerts = dg.Alerts[:topN]
+		}
+		d.Firing += dg.Firing
+		d.Resolved += dg.Resolved
+		d.Groups = append(d.Groups, dg)
+	}
+	sort.SliceStable(d.Groups, func(i, j int) bool { return d.Groups[i].Firing > d.Groups[j].Firing })
+	return d
+}
+
+type digestKey struct{}
+
+// ContextWithDigest returns a context which makes the templated card render the digest.
+func ContextWithDigest(ctx context.Context, d *Digest) context.Context {
+	return context.WithValue(ctx, digestKey{}, d)
+}
+
+// DigestFromContext returns the digest of the context, if any.
+func DigestFromContext(ctx context.Context) (*Digest, bool) {
+	d, ok := ctx.Value(digestKey{}).(*Digest)
+	return d, ok
+}
@@ -0,0 +1,86 @@
+package card
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func testDigestAlerts() template.Alerts {
+	return template.Alerts{
+		{Status: "resolved", Labels: template.KV{"alertname": "HighLoad", "instance": "a"}},
+		{Status: "firing", Labels: template.KV{"alertname": "DiskFull", "instance": "b"}},
+		{Status: "firing", Labels: template.KV{"alertname": "HighLoad", "instance": "c"}},
+		{Status: "firing", Labels: template.KV{"alertname": "HighLoad", "instance": "d"}},
+		{Status: "firing", Labels: template.KV{"alertname": "HighLoad", "instance": "e"}},
+	}
+}
+
+func TestNewDigest(t *testing.T) {
+	alerts := testDigestAlerts()
+	got := NewDigest(alerts, "alertname", 2)
+
+	want := &Digest{
+		Label:    "alertname",
+		Firing:   4,
+		Resolved: 1,
+		Groups: []DigestGroup{
+			{Value: "HighLoad", Firing: 3, Resolved: 1, Alerts: template.Alerts{alerts[2], alerts[3]}, More: 2},
+			{Value: "DiskFull", Firing: 1, Alerts: template.Alerts{alerts[1]}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_templatedCard_ConvertDigest(t *testing.T) {
+	tmpl, err := ParseTemplateFile("../../examples/templates/digest-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts := testDigestAlerts()
+	d := NewDigest(alerts, "alertname", 2)
+	d.Window = 5 * time.Minute
+	d.Messages = 3
+
+	data := &template.Data{Status: "firing", Alerts: alerts, CommonLabels: template.KV{}}
+	ctx := ContextWithDigest(context.Background(), d)
+
+	got, err := NewTemplatedCardCreator(tmpl, false).Convert(ctx, webhook.Message{Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "Alert digest (4 firing, 1 resolved)"; got.Title != want {
+		t.Fatalf("want title %q, got %q", want, got.Title)
+	}
+	if want := "3 notifications in the last 5m 0s"; got.Text != want {
+		t.Fatalf("want text %q, got %q", want, got.Text)
+	}
+	wantSections := []Section{
+		{
+			ActivityTitle:    "alertname: HighLoad",
+			ActivitySubtitle: "3 firing, 1 resolved",
+			Markdown:         true,
+			Facts: []FactSection{
+				{Name: "firing", Value: "c"},
+				{Name: "firing", Value: "d"},
+				{Name: "more", Value: "2 more alerts"},
+			},
+		},
+		{
+			ActivityTitle:    "alertname: DiskFull",
+			ActivitySubtitle: "1 firing, 0 resolved",
+			Markdown:         true,
+			Facts:            []FactSection{{Name: "firing", Value: "b"}},
+		},
+	}
+	if diff := cmp.Diff(wantSections, got.Sections); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,315 @@
+package card
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	tmpltext "text/template"
+	"text/template/parse"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// jsonEscapeFunc is the template function added to the actions rendered inside JSON strings.
+const jsonEscapeFunc = "jsonEscapeValue"
+
+// jsonEscapeTemplateFunc is the template function replacing the calls of the skipped templates,
+// e.g. the Alertmanager default templates, made inside JSON strings.
+const jsonEscapeTemplateFunc = "jsonEscapeTemplate"
+
+// jsonEscapeValue prints v like the template engine does and escapes it for a JSON string.
+func jsonEscapeValue(v interface{}) string {
+	if v == nil {
+		return jsonEncode("<no value>")
+	}
+	return jsonEncode(fmt.Sprint(v))
+}
+
+// jsonEscaper makes the output of the actions inside JSON string literals JSON safe.
+//
+// The context of an action is found by scanning the text before it, so `"value": "{{ .x }}"`
+// is escaped while `"values": {{ toJson .x }}` is not. A template called with the
+// template action from inside a string starts inside a string, the output of a skipped
+// template, e.g. `"title": "{{ template "__subject" . }}"`, is escaped as a whole.
+type jsonEscaper struct {
+	trees    map[string]*parse.Tree
+	inString map[string]bool
+	pending  []string
+	rewrite  bool
+}
+
+// escapeJSONStrings rewrites the templates of t, except the skipped ones, so quotes,
+// backslashes and newlines of label and annotation values never break the card.
+func escapeJSONStrings(t *tmpltext.Template, skip map[*parse.Tree]bool) {
+	t.Funcs(tmpltext.FuncMap{jsonEscapeTemplateFunc: func(name string, data interface{}) (string, error) {
+		var b bytes.Buffer
+		if err := t.ExecuteTemplate(&b, name, data); err != nil {
+			return "", err
+		}
+		return jsonEncode(b.String()), nil
+	}})
+
+	e := &jsonEscaper{trees: map[string]*parse.Tree{}, inString: map[string]bool{}}
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil && !skip[tt.Tree] {
+			e.trees[tt.Name()] = tt.Tree
+			e.pending = append(e.pending, tt.Name())
+		}
+	}
+
+	// Find the templates called from inside a string before rewriting anything.
+	for len(e.pending) > 0 {
+		name := e.pending[0]
+		e.pending = e.pending[1:]
+		e.escapeList(e.trees[name].Root, e.inString[name])
+	}
+
+	e.rewrite = true
+	done := map[*parse.Tree]bool{}
+	for name, tree := range e.trees {
+		if !done[tree] {
+			done[tree] = true
+			e.escapeList(tree.Root, e.inString[name])
+		}
+	}
+}
+
+// escapeList walks the nodes starting in the given context and returns the context after them.
+func (e *jsonEscaper) escapeList(l *parse.ListNode, inString bool) bool {
+	if l == nil {
+		return inString
+	}
+	for i, node := range l.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			inString = scanJSONText(n.Text, inString)
+		case *parse.ActionNode:
+			if inString && e.rewrite && len(n.Pipe.Decl) == 0 {
+				escapePipe(n.Pipe)
+			}
+		case *parse.IfNode:
+			inString = e.escapeBranch(&n.BranchNode, inString)
+		case *parse.RangeNode:
+			inString = e.escapeBranch(&n.BranchNode, inString)
+		case *parse.WithNode:
+			inString = e.escapeBranch(&n.BranchNode, inString)
+		case *parse.TemplateNode:
+			_, ok := e.trees[n.Name]
+			switch {
+			case ok && inString && !e.inString[n.Name]:
+				e.inString[n.Name] = true
+				e.pending = append(e.pending, n.Name)
+			case !ok && inString && e.rewrite:
+				l.Nodes[i] = escapeTemplateCall(n)
+			}
+		}
+	}
+	return inString
+}
+
+// escapeBranch assumes that all branches end in the same context.
+func (e *jsonEscaper) escapeBranch(b *parse.BranchNode, inString bool) bool {
+	out := e.escapeList(b.List, inString)
+	e.escapeList(b.ElseList, inString)
+	return out
+}
+
+// escapePipe appends the escape function to the pipeline, unless one of its commands is jsonString,
+// e.g. `{{ .x | jsonString | printf "%s!" }}` which is escaped already.
+func escapePipe(p *parse.PipeNode) {
+	for _, cmd := range p.Cmds {
+		if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && (id.Ident == "jsonString" || id.Ident == jsonEscapeFunc) {
+			return
+		}
+	}
+	p.Cmds = append(p.Cmds, &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      p.Pos,
+		Args:     []parse.Node{parse.NewIdentifier(jsonEscapeFunc).SetPos(p.Pos)},
+	})
+}
+
+// escapeTemplateCall returns the action rendering the template of the call with jsonEscapeTemplateFunc,
+// e.g. `{{ jsonEscapeTemplate "__subject" . }}` for `{{ template "__subject" . }}`.
+func escapeTemplateCall(n *parse.TemplateNode) *parse.ActionNode {
+	var data parse.Node = &parse.NilNode{NodeType: parse.NodeNil, Pos: n.Pos}
+	if n.Pipe != nil {
+		data = n.Pipe
+	}
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      n.Pos,
+		Line:     n.Line,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      n.Pos,
+			Line:     n.Line,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args: []parse.Node{
+					parse.NewIdentifier(jsonEscapeTemplateFunc).SetPos(n.Pos),
+					&parse.StringNode{NodeType: parse.NodeString, Pos: n.Pos, Quoted: fmt.Sprintf("%q", n.Name), Text: n.Name},
+					data,
+				},
+			}},
+		},
+	}
+}
+
+// scanJSONText returns whether the end of text is inside a JSON string.
+func scanJSONText(text []byte, inString bool) bool {
+	escaped := false
+	for _, c := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		}
+	}
+	return inString
+}
+
+type markdownEscapeMiddleware struct {
+	fields []string
+	next   Converter
+}
+
+// NewMarkdownEscapeMiddleware creates a Converter which escapes the character `_` in the strings
+// of the given card fields, e.g. "facts" or "activityTitle", so they are not rendered as italic.
+// Nested fields of objects and arrays are escaped too.
+func NewMarkdownEscapeMiddleware(fields []string, next Converter) Converter {
+	return markdownEscapeMiddleware{fields, next}
+}
+
+func (m markdownEscapeMiddleware) Convert(ctx context.Context, wm webhook.Message) (Office365ConnectorCard, error) {
+	c, err := m.next.Convert(ctx, wm)
+	if err != nil {
+		return c, err
+	}
+	var escaped Office365ConnectorCard
+	if err := escapeMarkdownFields(c, &escaped, m.fields); err != nil {
+		return c, err
+	}
+	return escaped, nil
+}
+
+func (m markdownEscapeMiddleware) ConvertWorkflow(ctx context.Context, wm webhook.Message) (WorkflowConnectorCard, error) {
+	c, err := m.next.ConvertWorkflow(ctx, wm)
+	if err != nil {
+		return c, err
+	}
+	var escaped WorkflowConnectorCard
+	if err := escapeMarkdownFields(c, &escaped, m.fields); err != nil {
+		return c, err
+	}
+	return escaped, nil
+}
+
+func (m markdownEscapeMiddleware) ConvertRaw(ctx context.Context, wm webhook.Message) (json.RawMessage, error) {
+	c, err := m.next.ConvertRaw(ctx, wm)
+	if err != nil {
+		return c, err
+	}
+	var escaped json.RawMessage
+	if err := escapeMarkdownFields(c, &escaped, m.fields); err != nil {
+		return c, err
+	}
+	return escaped, nil
+}
+
+// escapeMarkdownFields decodes the card as JSON, escapes the strings of the fields and stores the result in out.
+func escapeMarkdownFields(card interface{}, out interface{}, fields []string) error {
+	b, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	selected := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		selected[f] = true
+	}
+
+	b, err = json.Marshal(escapeMarkdownValue(v, selected, false))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func escapeMarkdownValue(v interface{}, fields map[string]bool, selected bool) interface{} {
+	switch t := v.(type) {
+	case string:
+		if selected {
+			return escapeUnderscores(t)
+		}
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = escapeMarkdownValue(e, fields, selected || fields[k])
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = escapeMarkdownValue(e, fields, selected)
+		}
+	}
+	return v
+}
+
+// markdownEscapeMessage returns a copy of the message with the `_` of its label and annotation values
+// escaped for markdown, so they are not rendered as italic. The message itself is not modified.
+func markdownEscapeMessage(wm webhook.Message) webhook.Message {
+	if wm.Data == nil {
+		return wm
+	}
+	d := *wm.Data
+	d.GroupLabels = markdownEscapeKV(d.GroupLabels)
+	d.CommonLabels = markdownEscapeKV(d.CommonLabels)
+	d.CommonAnnotations = markdownEscapeKV(d.CommonAnnotations)
+	alerts := make(template.Alerts, len(d.Alerts))
+	for i, a := range d.Alerts {
+		a.Labels = markdownEscapeKV(a.Labels)
+		a.Annotations = markdownEscapeKV(a.Annotations)
+		alerts[i] = a
+	}
+	d.Alerts = alerts
+	wm.Data = &d
+	return wm
+}
+
+func markdownEscapeKV(kv template.KV) template.KV {
+	if kv == nil {
+		return nil
+	}
+	escaped := make(template.KV, len(kv))
+	for k, v := range kv {
+		escaped[k] = escapeUnderscores(v)
+	}
+	return escaped
+}
+
+// escapeUnderscores replaces `_` with `\_`. Underscores which are already escaped are kept.
+func escapeUnderscores(s string) string {
+	if !strings.Contains(s, "_") {
+		return s
+	}
+	var b strings.Builder
+	var prev rune
+	for _, r := range s {
+		if r == '_' && prev != '\\' {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package card
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+)
+
+const testUnsafeDescription = "say \"hi\" to C:\\temp\nand <team>"
+
+func Test_templatedCard_jsonEscaping(t *testing.T) {
+	tmpl, err := ParseTemplateFile("./testdata/escape-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.CommonAnnotations["description"] = testUnsafeDescription
+	a.CommonLabels["job"] = "docker_nodes"
+
+	got, err := NewTemplatedCardCreator(tmpl, true).Convert(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Office365ConnectorCard{
+		Context: testSchemaContext,
+		Type:    messageCardType,
+		Title:   testUnsafeDescription,
+		Summary: testUnsafeDescription,
+		Text:    testUnsafeDescription,
+		Sections: []Section{
+			{
+				ActivityTitle: `high\_memory\_load`,
+				Facts:         []FactSection{{Name: "job_name", Value: `docker\_nodes`}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// The message must not be modified.
+	if got := a.CommonLabels["job"]; got != "docker_nodes" {
+		t.Fatalf("message label was modified: %q", got)
+	}
+}
+
+func Test_escapePipe(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "card.tmpl")
+	text := `{{ define "teams.card" }}{"@type": "MessageCard", "title": "{{ .CommonAnnotations.description | jsonString | printf "%s!" }}"}{{ end }}`
+	if err := os.WriteFile(f, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplateFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.CommonAnnotations["description"] = testUnsafeDescription
+
+	got, err := NewTemplatedCardCreator(tmpl, false).Convert(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testUnsafeDescription + "!"; got.Title != want {
+		t.Fatalf("want the value escaped once %q, got %q", want, got.Title)
+	}
+}
+
+func Test_escapeTemplateCall(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "card.tmpl")
+	text := `{{ define "teams.card" }}{"@type": "MessageCard", "title": "{{ template "__subject" . }}", "summary": "{{ template "__alertmanager" }}"}{{ end }}`
+	if err := os.WriteFile(f, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplateFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.GroupLabels = map[string]string{"alertname": `say "hi"`}
+
+	got, err := NewTemplatedCardCreator(tmpl, false).Convert(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[FIRING:0] say "hi" (master warning)`; got.Title != want {
+		t.Fatalf("want the output of the Alertmanager template escaped %q, got %q", want, got.Title)
+	}
+	if want := "Alertmanager"; got.Summary != want {
+		t.Fatalf("want the Alertmanager template without data %q, got %q", want, got.Summary)
+	}
+}
+
+func TestTemplateLoader_EscapeJSONStrings(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "card.tmpl")
+	text := `{{ define "teams.card" }}{"@type": "MessageCard", "title": "{{ js .CommonAnnotations.description }}"}{{ end }}`
+	if err := os.WriteFile(f, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.CommonAnnotations["description"] = `say "hi"`
+
+	tests := []struct {
+		escape bool
+		want   string
+	}{
+		{true, `say \"hi\"`},
+		{false, `say "hi"`},
+	}
+	for _, tt := range tests {
+		tmpl, err := NewTemplateLoader().EscapeJSONStrings(tt.escape).Load(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewTemplatedCardCreator(tmpl, false).Convert(context.Background(), a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != tt.want {
+			t.Errorf("escape %v: want %q, got %q", tt.escape, tt.want, got.Title)
+		}
+	}
+}
+
+func Test_markdownEscapeMiddleware(t *testing.T) {
+	tmpl, err := ParseTemplateFile("./testdata/escape-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.CommonLabels["job"] = "docker_nodes"
+
+	m := NewMarkdownEscapeMiddleware([]string{"activityTitle"}, NewTemplatedCardCreator(tmpl, false))
+	got, err := m.Convert(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSections := []Section{
+		{
+			ActivityTitle: `high\_memory\_load`,
+			Facts:         []FactSection{{Name: "job_name", Value: "docker_nodes"}},
+		},
+	}
+	if diff := cmp.Diff(wantSections, got.Sections); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_escapeUnderscores(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"no underscores", "no underscores"},
+		{"a_b__c", `a\_b\_\_c`},
+		{`already\_escaped_once`, `already\_escaped\_once`},
+	}
+	for _, tt := range tests {
+		if got := escapeUnderscores(tt.in); got != tt.want {
+			t.Errorf("escapeUnderscores(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
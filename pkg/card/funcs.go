@@ -0,0 +1,183 @@
+package card
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// amHumanizeDuration is the humanizeDuration of Alertmanager, which alertHumanizeDuration falls back to.
+var amHumanizeDuration, _ = template.DefaultFuncs["humanizeDuration"].(func(interface{}) (string, error))
+
+// severityColors are the theme colors used by the default templates.
+var severityColors = map[string]string{
+	"resolved": "2DC72D",
+	"critical": "8C1A1A",
+	"error":    "8C1A1A",
+	"warning":  "FFA500",
+	"info":     "0078D7",
+}
+
+const defaultSeverityColor = "808080"
+
+// alertFuncs returns the alert specific template functions.
+func alertFuncs() template.FuncMap {
+	return template.FuncMap{
+		"severityColor":    severityColor,
+		"humanizeDuration": alertHumanizeDuration,
+		"silenceURL":       silenceURL,
+		"generatorLink":    generatorLink,
+		"jsonString":       jsonString,
+		"truncate":         truncate,
+		"sortedLabels":     sortedLabels,
+		"groupBy":          groupBy,
+	}
+}
+
+// severityColor returns the hex theme color of a severity.
+// Called with a status and a severity, resolved alerts are always green:
+// `severityColor .Status .CommonLabels.severity`.
+func severityColor(args ...string) string {
+	if len(args) == 0 {
+		return defaultSeverityColor
+	}
+	if len(args) > 1 && args[0] == "resolved" {
+		return severityColors["resolved"]
+	}
+	if c, ok := severityColors[strings.ToLower(args[len(args)-1])]; ok {
+		return c
+	}
+	return defaultSeverityColor
+}
+
+// alertHumanizeDuration humanizes the time since a time.Time, e.g. `humanizeDuration .StartsAt`,
+// or between two times, e.g. `humanizeDuration .StartsAt .EndsAt`.
+// Other values are handled by the Alertmanager humanizeDuration, e.g. seconds as a number.
+func alertHumanizeDuration(v interface{}, end ...time.Time) (string, error) {
+	start, ok := v.(time.Time)
+	if !ok {
+		if amHumanizeDuration == nil {
+			return "", fmt.Errorf("humanizeDuration: unsupported value %v", v)
+		}
+		return amHumanizeDuration(v)
+	}
+
+	until := time.Now()
+	if len(end) > 0 && !end[0].IsZero() {
+		until = end[0]
+	}
+	d := until.Sub(start).Round(time.Second)
+	if d < 0 {
+		d = 0
+	}
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+
+	var parts []string
+	for _, p := range []struct {
+		v    time.Duration
+		unit string
+	}{{days, "d"}, {hours, "h"}, {minutes, "m"}, {seconds, "s"}} {
+		if p.v > 0 {
+			parts = append(parts, fmt.Sprintf("%d%s", p.v, p.unit))
+		}
+	}
+	if len(parts) == 0 {
+		return "0s", nil
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// silenceURL returns the Alertmanager link to create a silence matching the given labels,
+// e.g. `silenceURL $.ExternalURL .Labels`.
+func silenceURL(externalURL string, labels template.KV) string {
+	matchers := make([]string, 0, len(labels))
+	for _, p := range labels.SortedPairs() {
+		matchers = append(matchers, fmt.Sprintf("%s=%s", p.Name, strconv.Quote(p.Value)))
+	}
+	filter := "{" + strings.Join(matchers, ", ") + "}"
+	// The Alertmanager UI does not decode '+' in the fragment.
+	escaped := strings.ReplaceAll(url.QueryEscape(filter), "+", "%20")
+	return fmt.Sprintf("%s/#/silences/new?filter=%s", strings.TrimSuffix(externalURL, "/"), escaped)
+}
+
+// generatorLink returns the GeneratorURL of an alert. When a base url is given,
+// its scheme and host replace the ones of the GeneratorURL, which is useful
+// when Prometheus advertises an internal hostname.
+func generatorLink(generatorURL string, base ...string) (string, error) {
+	if len(base) == 0 || base[0] == "" || generatorURL == "" {
+		return generatorURL, nil
+	}
+	g, err := url.Parse(generatorURL)
+	if err != nil {
+		return "", err
+	}
+	b, err := url.Parse(base[0])
+	if err != nil {
+		return "", err
+	}
+	g.Scheme = b.Scheme
+	g.Host = b.Host
+	g.Path = strings.TrimSuffix(b.Path, "/") + g.Path
+	return g.String(), nil
+}
+
+// jsonString escapes s to be used inside a JSON string literal, e.g. `"text": "{{ jsonString .x }}"`.
+func jsonString(s string) string {
+	return jsonEncode(s)
+}
+
+// truncate shortens s to at most n characters, ending with an ellipsis if shortened,
+// e.g. `{{ .Annotations.description | truncate 100 }}`.
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if n < 0 || len(r) <= n {
+		return s
+	}
+	if n == 0 {
+		return ""
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// sortedLabels returns the labels sorted by name without the excluded ones,
+// e.g. `range sortedLabels .Labels "pod_template_hash" "instance"`.
+func sortedLabels(kv template.KV, exclude ...string) template.Pairs {
+	return kv.Remove(exclude).SortedPairs()
+}
+
+// AlertGroup is a set of alerts sharing the value of a label, see groupBy.
+type AlertGroup struct {
+	Value  string
+	Alerts template.Alerts
+}
+
+// groupBy groups alerts by the value of a label, sorted by the value,
+// e.g. `range .Alerts | groupBy "instance"`.
+func groupBy(label string, alerts template.Alerts) []AlertGroup {
+	index := map[string]int{}
+	var groups []AlertGroup
+	for _, a := range alerts {
+		v := a.Labels[label]
+		i, ok := index[v]
+		if !ok {
+			i = len(groups)
+			index[v] = i
+			groups = append(groups, AlertGroup{Value: v})
+		}
+		groups[i].Alerts = append(groups[i].Alerts, a)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Value < groups[j].Value })
+	return groups
+}
@@ -0,0 +1,121 @@
+package card
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func Test_severityColor(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"critical"}, want: "8C1A1A"},
+		{args: []string{"Warning"}, want: "FFA500"},
+		{args: []string{"unknown"}, want: defaultSeverityColor},
+		{args: []string{"firing", "critical"}, want: "8C1A1A"},
+		{args: []string{"resolved", "critical"}, want: "2DC72D"},
+		{args: nil, want: defaultSeverityColor},
+	}
+	for _, tt := range tests {
+		if got := severityColor(tt.args...); got != tt.want {
+			t.Errorf("severityColor(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func Test_alertHumanizeDuration(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		v    interface{}
+		end  []time.Time
+		want string
+	}{
+		{name: "between times", v: start, end: []time.Time{start.Add(26*time.Hour + 3*time.Minute + 4*time.Second)}, want: "1d 2h 3m 4s"},
+		{name: "zero end falls back to now", v: time.Now().Add(-90 * time.Second), end: []time.Time{{}}, want: "1m 30s"},
+		{name: "same time", v: start, end: []time.Time{start}, want: "0s"},
+		{name: "seconds fall back to alertmanager", v: 90, want: "1m 30s"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := alertHumanizeDuration(tt.v, tt.end...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_silenceURL(t *testing.T) {
+	got := silenceURL("http://am:9093/", template.KV{"job": "node", "alertname": `high "load"`})
+	want := `http://am:9093/#/silences/new?filter=%7Balertname%3D%22high%20%5C%22load%5C%22%22%2C%20job%3D%22node%22%7D`
+	if got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func Test_generatorLink(t *testing.T) {
+	got, err := generatorLink("http://prometheus-0:9090/graph?g0.expr=up", "https://prometheus.example.com/prom/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://prometheus.example.com/prom/graph?g0.expr=up"; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func Test_jsonString(t *testing.T) {
+	if got, want := jsonString("a \"b\"\n\\c"), `a \"b\"\n\\c`; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func Test_truncate(t *testing.T) {
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{n: 10, s: "short", want: "short"},
+		{n: 5, s: "exactly 5", want: "exac…"},
+		{n: 3, s: "äöüß", want: "äö…"},
+		{n: 0, s: "abc", want: ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.n, tt.s); got != tt.want {
+			t.Errorf("truncate(%d, %q) = %q, want %q", tt.n, tt.s, got, tt.want)
+		}
+	}
+}
+
+func Test_sortedLabels(t *testing.T) {
+	got := sortedLabels(template.KV{"b": "2", "a": "1", "pod_template_hash": "x"}, "pod_template_hash")
+	want := template.Pairs{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_groupBy(t *testing.T) {
+	alerts := template.Alerts{
+		{Fingerprint: "1", Labels: template.KV{"instance": "b"}},
+		{Fingerprint: "2", Labels: template.KV{"instance": "a"}},
+		{Fingerprint: "3", Labels: template.KV{"instance": "b"}},
+	}
+	got := groupBy("instance", alerts)
+	want := []AlertGroup{
+		{Value: "a", Alerts: template.Alerts{alerts[1]}},
+		{Value: "b", Alerts: template.Alerts{alerts[0], alerts[2]}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,399 @@
+package card
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.2"
+	messageCardContext      = "http://schema.org/extensions"
+	defaultColorKey         = "default"
+	resolvedColorKey        = "resolved"
+	maxActions              = 5
+)
+
+// Layout is the declarative description of a card which is built without JSON templating.
+// All string values are Go templates. Title, Summary and the Actions are executed with the
+// template.Data of the notification, the Alert fields with each template.Alert.
+type Layout struct {
+	Title   string `yaml:"title"`
+	Summary string `yaml:"summary"`
+	// SeverityLabel is the label used to pick Colors and Styles. Defaults to "severity".
+	SeverityLabel string `yaml:"severity_label"`
+	// Colors maps "resolved", a severity or "default" to the MessageCard theme color.
+	Colors map[string]string `yaml:"colors"`
+	// Styles maps "resolved", a severity or "default" to the Adaptive Card container style.
+	Styles  map[string]string `yaml:"styles"`
+	Alert   AlertLayout       `yaml:"alert"`
+	Actions []LayoutAction    `yaml:"actions"`
+}
+
+// AlertLayout describes the section rendered for each alert.
+type AlertLayout struct {
+	Title string `yaml:"title"`
+	// TextAnnotations are the annotations rendered as text, in order.
+	TextAnnotations []string `yaml:"text_annotations"`
+	// FactLabels are the labels rendered as facts, in order. All labels are used if empty.
+	FactLabels []string `yaml:"fact_labels"`
+	// ExcludeLabels are never rendered as facts.
+	ExcludeLabels []string `yaml:"exclude_labels"`
+	// FactAnnotations are the annotations rendered as facts after the labels, in order.
+	FactAnnotations []string `yaml:"fact_annotations"`
+}
+
+// LayoutAction is a button opening an url.
+type LayoutAction struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// DefaultLayout returns the layout resembling the default templates.
+func DefaultLayout() Layout {
+	return Layout{
+		Title:         `Prometheus Alert ({{ .Status | title }})`,
+		Summary:       `{{ or .CommonAnnotations.summary .CommonAnnotations.message .CommonLabels.alertname "Prometheus Alert" }}`,
+		SeverityLabel: "severity",
+		Colors: map[string]string{
+			resolvedColorKey: "2DC72D",
+			"critical":       "8C1A1A",
+			"warning":        "FFA500",
+			defaultColorKey:  "808080",
+		},
+		Styles: map[string]string{
+			resolvedColorKey: "good",
+			"critical":       "attention",
+			"warning":        "warning",
+			defaultColorKey:  "default",
+		},
+		Alert: AlertLayout{
+			Title:           `{{ or .Annotations.summary .Labels.alertname }}`,
+			TextAnnotations: []string{"description"},
+		},
+	}
+}
+
+// ParseLayoutFile reads a Layout from a YAML file.
+// Fields which are not set in the file keep the values of DefaultLayout.
+func ParseLayoutFile(f string) (Layout, error) {
+	b, err := os.ReadFile(f) //nolint:gosec
+	if err != nil {
+		return Layout{}, err
+	}
+	var l Layout
+	if err := yaml.UnmarshalStrict(b, &l); err != nil {
+		return Layout{}, fmt.Errorf("failed to parse layout %s: %w", f, err)
+	}
+
+	d := DefaultLayout()
+	if l.Title == "" {
+		l.Title = d.Title
+	}
+	if l.Summary == "" {
+		l.Summary = d.Summary
+	}
+	if l.Colors == nil {
+		l.Colors = d.Colors
+	}
+	if l.Styles == nil {
+		l.Styles = d.Styles
+	}
+	if l.Alert.Title == "" {
+		l.Alert.Title = d.Alert.Title
+	}
+	if l.Alert.TextAnnotations == nil {
+		l.Alert.TextAnnotations = d.Alert.TextAnnotations
+	}
+	return l, nil
+}
+
+// layoutCard implements Converter by building the card from a Layout.
+type layoutCard struct {
+	layout            Layout
+	escapeUnderscores bool
+
+	title, summary, alertTitle *texttemplate.Template
+	actionNames, actionURLs    []*texttemplate.Template
+}
+
+// NewLayoutCardCreator creates a Converter which builds cards from the given layout.
+// The resulting JSON is always valid since no JSON is templated.
+func NewLayoutCardCreator(layout Layout, escapeUnderscores bool) (Converter, error) {
+	if len(layout.Actions) > maxActions {
+		return nil, fmt.Errorf("there can only be a maximum of %d actions, got %d", maxActions, len(layout.Actions))
+	}
+	if layout.SeverityLabel == "" {
+		layout.SeverityLabel = "severity"
+	}
+
+	c := &layoutCard{layout: layout, escapeUnderscores: escapeUnderscores}
+
+	var err error
+	if c.title, err = parseLayoutText("title", layout.Title); err != nil {
+		return nil, err
+	}
+	if c.summary, err = parseLayoutText("summary", layout.Summary); err != nil {
+		return nil, err
+	}
+	if c.alertTitle, err = parseLayoutText("alert.title", layout.Alert.Title); err != nil {
+		return nil, err
+	}
+	for i, a := range layout.Actions {
+		n, err := parseLayoutText(fmt.Sprintf("actions[%d].name", i), a.Name)
+		if err != nil {
+			return nil, err
+		}
+		u, err := parseLayoutText(fmt.Sprintf("actions[%d].url", i), a.URL)
+		if err != nil {
+			return nil, err
+		}
+		c.actionNames = append(c.actionNames, n)
+		c.actionURLs = append(c.actionURLs, u)
+	}
+
+	return c, nil
+}
+
+func parseLayoutText(name, text string) (*texttemplate.Template, error) {
+	t, err := texttemplate.New(name).
+		Option("missingkey=zero").
+		Funcs(texttemplate.FuncMap(template.DefaultFuncs)).
+		Funcs(texttemplate.FuncMap(defaultFuncs())).
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse layout %s: %w", name, err)
+	}
+	return t, nil
+}
+
+func executeLayoutText(t *texttemplate.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute layout %s: %w", t.Name(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// layoutAlert is the rendered content of one alert.
+type layoutAlert struct {
+	severity string
+	title    string
+	texts    []string
+	facts    []FactSection
+}
+
+// layoutResult is the rendered content of a notification.
+type layoutResult struct {
+	severity string
+	title    string
+	summary  string
+	alerts   []layoutAlert
+	actions  []LayoutAction
+}
+
+func (m *layoutCard) render(promAlert webhook.Message) (layoutResult, error) {
+	data := promAlert.Data
+	r := layoutResult{severity: data.CommonLabels[m.layout.SeverityLabel]}
+	if data.Status == resolvedColorKey {
+		r.severity = resolvedColorKey
+	}
+
+	var err error
+	if r.title, err = executeLayoutText(m.title, data); err != nil {
+		return r, err
+	}
+	if r.summary, err = executeLayoutText(m.summary, data); err != nil {
+		return r, err
+	}
+	for i := range m.actionNames {
+		var a LayoutAction
+		if a.Name, err = executeLayoutText(m.actionNames[i], data); err != nil {
+			return r, err
+		}
+		if a.URL, err = executeLayoutText(m.actionURLs[i], data); err != nil {
+			return r, err
+		}
+		r.actions = append(r.actions, a)
+	}
+
+	for _, alert := range data.Alerts {
+		la := layoutAlert{severity: alert.Labels[m.layout.SeverityLabel]}
+		if alert.Status == resolvedColorKey {
+			la.severity = resolvedColorKey
+		}
+		if la.title, err = executeLayoutText(m.alertTitle, alert); err != nil {
+			return r, err
+		}
+		for _, a := range m.layout.Alert.TextAnnotations {
+			if v := alert.Annotations[a]; v != "" {
+				la.texts = append(la.texts, v)
+			}
+		}
+		la.facts = m.facts(alert)
+		r.alerts = append(r.alerts, la)
+	}
+
+	return r, nil
+}
+
+func (m *layoutCard) facts(alert template.Alert) []FactSection {
+	excluded := map[string]bool{}
+	for _, l := range m.layout.Alert.ExcludeLabels {
+		excluded[l] = true
+	}
+
+	names := m.layout.Alert.FactLabels
+	if len(names) == 0 {
+		names = alert.Labels.SortedPairs().Names()
+	}
+
+	var facts []FactSection
+	for _, n := range names {
+		v, ok := alert.Labels[n]
+		if !ok || excluded[n] {
+			continue
+		}
+		facts = append(facts, FactSection{Name: m.escape(n), Value: m.escape(v)})
+	}
+	for _, n := range m.layout.Alert.FactAnnotations {
+		if v, ok := alert.Annotations[n]; ok {
+			facts = append(facts, FactSection{Name: m.escape(n), Value: m.escape(v)})
+		}
+	}
+	return facts
+}
+
+func (m *layoutCard) escape(s string) string {
+	if !m.escapeUnderscores {
+		return s
+	}
+	return strings.ReplaceAll(s, "_", `\_`)
+}
+
+// lookup returns the value for the severity, falling back to "default".
+func lookup(values map[string]string, severity string) string {
+	if v, ok := values[severity]; ok {
+		return v
+	}
+	return values[defaultColorKey]
+}
+
+func (m *layoutCard) Convert(ctx context.Context, promAlert webhook.Message) (Office365ConnectorCard, error) {
+	_, span := tracer.Start(ctx, "layoutCard.Convert")
+	defer span.End()
+
+	r, err := m.render(promAlert)
+	if err != nil {
+		return Office365ConnectorCard{}, err
+	}
+
+	c := Office365ConnectorCard{
+		Context:    messageCardContext,
+		Type:       messageCardType,
+		Title:      r.title,
+		Summary:    r.summary,
+		ThemeColor: lookup(m.layout.Colors, r.severity),
+	}
+	for _, a := range r.alerts {
+		c.Sections = append(c.Sections, Section{
+			ActivityTitle: a.title,
+			Text:          strings.Join(a.texts, "\n\n"),
+			Facts:         a.facts,
+			Markdown:      true,
+		})
+	}
+	for _, a := range r.actions {
+		c.PotentialAction = append(c.PotentialAction, Action{
+			"@type":   "OpenUri",
+			"name":    a.Name,
+			"targets": []map[string]string{{"os": "default", "uri": a.URL}},
+		})
+	}
+
+	return c, nil
+}
+
+func (m *layoutCard) ConvertWorkflow(ctx context.Context, promAlert webhook.Message) (WorkflowConnectorCard, error) {
+	_, span := tracer.Start(ctx, "layoutCard.ConvertWorkflow")
+	defer span.End()
+
+	r, err := m.render(promAlert)
+	if err != nil {
+		return WorkflowConnectorCard{}, err
+	}
+
+	body := []map[string]interface{}{
+		{
+			"type":   "TextBlock",
+			"text":   r.title,
+			"weight": "bolder",
+			"size":   "medium",
+			"style":  "heading",
+			"wrap":   true,
+		},
+		{
+			"type": "TextBlock",
+			"text": r.summary,
+			"wrap": true,
+		},
+	}
+	for _, a := range r.alerts {
+		items := []interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": a.title, "weight": "bolder", "wrap": true},
+		}
+		for _, t := range a.texts {
+			items = append(items, map[string]interface{}{"type": "TextBlock", "text": t, "wrap": true})
+		}
+		if len(a.facts) > 0 {
+			facts := make([]interface{}, 0, len(a.facts))
+			for _, f := range a.facts {
+				facts = append(facts, map[string]interface{}{"title": f.Name, "value": f.Value})
+			}
+			items = append(items, map[string]interface{}{"type": "FactSet", "facts": facts})
+		}
+		body = append(body, map[string]interface{}{
+			"type":  "Container",
+			"style": lookup(m.layout.Styles, a.severity),
+			"items": items,
+		})
+	}
+
+	var actions []Action
+	for _, a := range r.actions {
+		actions = append(actions, Action{"type": "Action.OpenUrl", "title": a.Name, "url": a.URL})
+	}
+
+	return WorkflowConnectorCard{
+		Type: workflowCardType,
+		Attachments: []AdaptiveCardItem{
+			{
+				ContentType: adaptiveCardContentType,
+				Content: Content{
+					Schema:  adaptiveCardSchema,
+					Type:    "AdaptiveCard",
+					Version: adaptiveCardVersion,
+					Body:    body,
+					MsTeams: MsTeams{Width: "Full"},
+					Actions: actions,
+				},
+			},
+		},
+	}, nil
+}
+
+// ConvertRaw is not supported, layouts only describe Teams cards.
+func (m *layoutCard) ConvertRaw(context.Context, webhook.Message) (json.RawMessage, error) {
+	return nil, errors.New("layout files only render Teams cards, use a template file for raw webhook types")
+}
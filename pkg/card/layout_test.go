@@ -0,0 +1,114 @@
+package card
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+)
+
+func Test_layoutCard_Convert(t *testing.T) {
+	l, err := ParseLayoutFile("./testdata/layout.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Characters breaking templated JSON must not break built cards.
+	a.Alerts[0].Annotations["description"] = `a "quoted" \ description`
+
+	c, err := NewLayoutCardCreator(l, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Convert(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Office365ConnectorCard{
+		Context:    testSchemaContext,
+		Type:       messageCardType,
+		Title:      "high_memory_load is firing",
+		Summary:    "Prometheus Test",
+		ThemeColor: testThemeColor,
+		Sections: []Section{
+			{
+				ActivityTitle: "instance-with-hyphen_and_underscore",
+				Text:          `a "quoted" \ description`,
+				Markdown:      true,
+				Facts: []FactSection{
+					{Name: testAlertname, Value: `high\_memory\_load`},
+					{Name: testInstance, Value: `instance-with-hyphen\_and\_underscore`},
+					{Name: testJob, Value: `docker\_nodes`},
+					{Name: testSeverity, Value: testSeverityWarning},
+					{Name: testLabelSummary, Value: testMemorySummary},
+				},
+			},
+		},
+		PotentialAction: []Action{
+			{
+				"@type":   "OpenUri",
+				"name":    "Alertmanager",
+				"targets": []map[string]string{{"os": "default", "uri": "http://docker.for.mac.host.internal:9093"}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_layoutCard_ConvertWorkflow(t *testing.T) {
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewLayoutCardCreator(DefaultLayout(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.ConvertWorkflow(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The card must survive a round-trip like a templated card.
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var card WorkflowConnectorCard
+	if err := json.Unmarshal(b, &card); err != nil {
+		t.Fatal(err)
+	}
+
+	body := card.Attachments[0].Content.Body
+	if len(body) != 3 {
+		t.Fatalf("want 3 body elements, got %d", len(body))
+	}
+	if text := body[0]["text"]; text != testAlertTitle {
+		t.Fatalf("want title %q, got %q", testAlertTitle, text)
+	}
+	if text := body[1]["text"]; text != testAlertSummary {
+		t.Fatalf("want summary %q, got %q", testAlertSummary, text)
+	}
+	if style := body[2]["style"]; style != "warning" {
+		t.Fatalf("want container style %q, got %q", "warning", style)
+	}
+}
+
+func Test_NewLayoutCardCreator_invalid(t *testing.T) {
+	l := DefaultLayout()
+	l.Title = "{{ .Status "
+	if _, err := NewLayoutCardCreator(l, false); err == nil {
+		t.Fatal("want error for invalid title template")
+	}
+}
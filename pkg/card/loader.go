@@ -0,0 +1,290 @@
+package card
+
+import (
+	"fmt"
+	tmplhtml "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	tmpltext "text/template"
+	"text/template/parse"
+
+	"github.com/prometheus/alertmanager/template"
+	"k8s.io/helm/pkg/engine"
+)
+
+// TemplateLoader parses Alertmanager templates with its own set of functions.
+// Unlike the Alertmanager template package, it never modifies template.DefaultFuncs,
+// so each connector can have its own functions.
+type TemplateLoader struct {
+	funcs    template.FuncMap
+	disabled map[string]bool
+	includes []string
+	required []string
+	// keepJSONStrings leaves the actions inside JSON strings as they are.
+	keepJSONStrings bool
+}
+
+// NewTemplateLoader creates a TemplateLoader with the default functions, see ParseTemplateFile.
+func NewTemplateLoader() *TemplateLoader {
+	return &TemplateLoader{funcs: defaultFuncs(), disabled: map[string]bool{}}
+}
+
+// defaultFuncs returns sprig and Helm functions, the 'counter' and 'mention' functions
+// and the alert specific functions.
+func defaultFuncs() template.FuncMap {
+	funcs := template.FuncMap{}
+	for k, v := range engine.FuncMap() {
+		funcs[k] = v
+	}
+	funcs["counter"] = func() func() int {
+		i := -1
+		return func() int {
+			i++
+			return i
+		}
+	}
+	funcs["mention"] = mention
+	for k, v := range alertFuncs() {
+		funcs[k] = v
+	}
+	return funcs
+}
+
+// Funcs adds the functions to the loader, replacing existing functions of the same name.
+func (l *TemplateLoader) Funcs(funcs template.FuncMap) *TemplateLoader {
+	for k, v := range funcs {
+		l.funcs[k] = v
+		delete(l.disabled, k)
+	}
+	return l
+}
+
+// Disable removes the functions from the loader.
+// Templates using a disabled function fail to load.
+func (l *TemplateLoader) Disable(names ...string) *TemplateLoader {
+	for _, n := range names {
+		l.disabled[n] = true
+		// Functions of Alertmanager cannot be removed, so they are replaced.
+		name := n
+		l.funcs[n] = func(...interface{}) (string, error) {
+			return "", fmt.Errorf("template function %s is disabled", name)
+		}
+	}
+	return l
+}
+
+// Require makes Load fail if the templates do not define all names, e.g. DigestTemplate.
+func (l *TemplateLoader) Require(names ...string) *TemplateLoader {
+	l.required = append(l.required, names...)
+	return l
+}
+
+// EscapeJSONStrings sets whether Load escapes the actions inside JSON strings, the default.
+// Templates escaping their values themselves, e.g. with `js`, should not be escaped again.
+func (l *TemplateLoader) EscapeJSONStrings(escape bool) *TemplateLoader {
+	l.keepJSONStrings = !escape
+	return l
+}
+
+// Include adds shared template files or globs, which are loaded before the templates passed to Load.
+// The templates passed to Load may override their definitions, e.g. only "teams.card".
+func (l *TemplateLoader) Include(patterns ...string) *TemplateLoader {
+	l.includes = append(l.includes, patterns...)
+	return l
+}
+
+// Load parses the given template files or globs into a single template,
+// so partials can be defined once in one file and used in the others.
+// Actions inside JSON strings are escaped unless disabled with EscapeJSONStrings,
+// so values with quotes or newlines are rendered safely.
+// A template defined in more than one of the included files, or in more than one
+// of the given files, is reported as a conflict.
+func (l *TemplateLoader) Load(patterns ...string) (*template.Template, error) {
+	for _, layer := range [][]string{l.includes, patterns} {
+		files, err := expandGlobs(layer)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.checkConflicts(files); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		text *tmpltext.Template
+		html *tmplhtml.Template
+	)
+	tmpl, err := template.FromGlobs(nil, func(t *tmpltext.Template, h *tmplhtml.Template) {
+		text, html = t, h
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create template: %w", err)
+	}
+
+	// template.New adds the Alertmanager functions after the options are applied.
+	// Adding the loader functions afterwards gives them precedence.
+	text.Funcs(tmpltext.FuncMap(l.funcs)).Funcs(tmpltext.FuncMap{jsonEscapeFunc: jsonEscapeValue})
+	html.Funcs(tmplhtml.FuncMap(l.funcs))
+
+	// The Alertmanager default templates may use disabled functions, they are not checked.
+	builtin := map[*parse.Tree]bool{}
+	for _, t := range text.Templates() {
+		builtin[t.Tree] = true
+	}
+
+	for _, p := range append(append([]string{}, l.includes...), patterns...) {
+		if err := tmpl.FromGlob(p); err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+	}
+
+	if used := l.disabledFuncsIn(text, builtin); len(used) > 0 {
+		return nil, fmt.Errorf("template uses disabled functions: %s", strings.Join(used, ", "))
+	}
+
+	for _, name := range l.required {
+		if text.Lookup(name) == nil {
+			return nil, fmt.Errorf("the template '%s' is not defined", name)
+		}
+	}
+
+	if !l.keepJSONStrings {
+		escapeJSONStrings(text, builtin)
+	}
+
+	return tmpl, nil
+}
+
+func expandGlobs(patterns []string) ([]string, error) {
+	var files []string
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template glob %s: %w", p, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("template file %s does not exist", p)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// checkConflicts returns an error if a template is defined in more than one of the files.
+func (l *TemplateLoader) checkConflicts(files []string) error {
+	definedIn := map[string]string{}
+	for _, f := range files {
+		b, err := os.ReadFile(f) //nolint:gosec
+		if err != nil {
+			return err
+		}
+		t, err := tmpltext.New(f).
+			Funcs(tmpltext.FuncMap(template.DefaultFuncs)).
+			Funcs(tmpltext.FuncMap(l.funcs)).
+			Parse(string(b))
+		if err != nil {
+			return fmt.Errorf("failed to parse template %s: %w", f, err)
+		}
+		for _, d := range t.Templates() {
+			if d.Name() == f {
+				continue
+			}
+			if other, ok := definedIn[d.Name()]; ok && other != f {
+				return fmt.Errorf("template %q is defined in both %s and %s", d.Name(), other, f)
+			}
+			definedIn[d.Name()] = f
+		}
+	}
+	return nil
+}
+
+// disabledFuncsIn returns the disabled functions used by the templates, except the skipped ones.
+func (l *TemplateLoader) disabledFuncsIn(t *tmpltext.Template, skip map[*parse.Tree]bool) []string {
+	if len(l.disabled) == 0 {
+		return nil
+	}
+	used := map[string]bool{}
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil && !skip[tt.Tree] {
+			l.walk(tt.Tree.Root, used)
+		}
+	}
+	names := make([]string, 0, len(used))
+	for n := range used {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *TemplateLoader) walk(node parse.Node, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			l.walk(c, used)
+		}
+	case *parse.ActionNode:
+		l.walk(n.Pipe, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			l.walk(c, used)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			l.walk(a, used)
+		}
+	case *parse.ChainNode:
+		l.walk(n.Node, used)
+	case *parse.IdentifierNode:
+		if l.disabled[n.Ident] {
+			used[n.Ident] = true
+		}
+	case *parse.IfNode:
+		l.walkBranch(&n.BranchNode, used)
+	case *parse.RangeNode:
+		l.walkBranch(&n.BranchNode, used)
+	case *parse.WithNode:
+		l.walkBranch(&n.BranchNode, used)
+	case *parse.TemplateNode:
+		l.walk(n.Pipe, used)
+	}
+}
+
+func (l *TemplateLoader) walkBranch(n *parse.BranchNode, used map[string]bool) {
+	l.walk(n.Pipe, used)
+	l.walk(n.List, used)
+	l.walk(n.ElseList, used)
+}
+
+// ParseTemplateFile creates an alertmanager template from the given file.
+// It does not modify template.DefaultFuncs.
+//
+// The functions include all functions (except 'env' and 'expandenv' ) from sprig (http://masterminds.github.io/sprig/)
+// and the following functions from HELM templating:
+//   - toToml
+//   - toYaml
+//   - fromYaml
+//   - toJson
+//   - fromJson
+//
+// It also adds the 'mention' function which renders a Teams mention, see NewMentionMiddleware,
+// and the alert specific functions:
+//   - severityColor
+//   - humanizeDuration (also accepts StartsAt and EndsAt)
+//   - silenceURL
+//   - generatorLink
+//   - jsonString
+//   - truncate
+//   - sortedLabels
+//   - groupBy
+func ParseTemplateFile(f string) (*template.Template, error) {
+	return NewTemplateLoader().Load(f)
+}
@@ -0,0 +1,124 @@
+package card
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func Test_TemplateLoader_Load(t *testing.T) {
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := len(template.DefaultFuncs)
+
+	tmpl, err := NewTemplateLoader().
+		Funcs(template.FuncMap{"shout": strings.ToUpper}).
+		Load("./testdata/partials/*.tmpl", "./testdata/partials-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(template.DefaultFuncs) != defaults {
+		t.Fatal("template.DefaultFuncs must not be modified")
+	}
+
+	got, err := NewTemplatedCardCreator(tmpl, false).Convert(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HIGH_MEMORY_LOAD"; got.Title != want {
+		t.Fatalf("want title %q, got %q", want, got.Title)
+	}
+
+	// Functions of one loader must not leak into another.
+	if _, err := NewTemplateLoader().Load("./testdata/partials/*.tmpl"); err == nil {
+		t.Fatal("want error for undefined function shout")
+	}
+}
+
+func Test_TemplateLoader_Disable(t *testing.T) {
+	_, err := NewTemplateLoader().Disable("counter", "toUpper").Load(testdataDefaultTemplate)
+	if err == nil || !strings.Contains(err.Error(), "counter") {
+		t.Fatalf("want error for disabled function counter, got %v", err)
+	}
+
+	if _, err := NewTemplateLoader().Disable("toUpper").Load(testdataDefaultTemplate); err != nil {
+		t.Fatalf("unused disabled functions must not fail, got %v", err)
+	}
+}
+
+func Test_TemplateLoader_missingFile(t *testing.T) {
+	if _, err := NewTemplateLoader().Load("./testdata/does-not-exist.tmpl"); err == nil {
+		t.Fatal("want error for missing template file")
+	}
+}
+
+const testdataDefaultTemplate = "../../default-message-card.tmpl"
+
+func Test_TemplateLoader_Include(t *testing.T) {
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		includes    []string
+		files       []string
+		wantSummary string
+		wantErr     bool
+	}{
+		{
+			name:        "library only",
+			includes:    []string{"./testdata/library/*.tmpl"},
+			wantSummary: "library card",
+		},
+		{
+			name:        "connector overrides teams.card",
+			includes:    []string{"./testdata/library/*.tmpl"},
+			files:       []string{"./testdata/library-override.tmpl"},
+			wantSummary: "connector card",
+		},
+		{
+			name:     "conflicting includes",
+			includes: []string{"./testdata/library/*.tmpl", "./testdata/conflict/a.tmpl", "./testdata/conflict/b.tmpl"},
+			wantErr:  true,
+		},
+		{
+			name:     "conflicting connector files",
+			includes: []string{"./testdata/library/*.tmpl"},
+			files:    []string{"./testdata/conflict/*.tmpl"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := NewTemplateLoader().Include(tt.includes...).Load(tt.files...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got, err := NewTemplatedCardCreator(tmpl, false).Convert(context.Background(), a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Summary != tt.wantSummary {
+				t.Fatalf("want summary %q, got %q", tt.wantSummary, got.Summary)
+			}
+			if want := "Alert high_memory_load"; got.Title != want {
+				t.Fatalf("want title %q, got %q", want, got.Title)
+			}
+		})
+	}
+}
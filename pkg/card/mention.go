@@ -0,0 +1,206 @@
+package card
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+)
+
+const mentionEntityType = "mention"
+
+// mentionPattern matches the placeholders rendered by the mention template function.
+var mentionPattern = regexp.MustCompile(`<at>(.*?)</at>`)
+
+// Mention is the Teams user or tag a mention placeholder resolves to.
+type Mention struct {
+	// ID is the user principal name, the Azure AD object id or the tag id.
+	ID   string
+	Name string
+	// Type is empty for users and "tag" for tags.
+	Type string
+}
+
+// Mentions maps the argument of the mention template function, e.g. "team=payments", to a Mention.
+type Mentions map[string]Mention
+
+// mention renders a mention placeholder which is resolved by the mention middleware.
+// It is called either with a single key like "owner@corp.com" or "team=payments",
+// or with a label name and value like `mention "team" .CommonLabels.team`.
+func mention(args ...string) (string, error) {
+	switch len(args) {
+	case 1:
+		return fmt.Sprintf("<at>%s</at>", args[0]), nil
+	case 2:
+		return fmt.Sprintf("<at>%s=%s</at>", args[0], args[1]), nil
+	}
+	return "", fmt.Errorf("mention expects 1 or 2 arguments, got %d", len(args))
+}
+
+type mentionMiddleware struct {
+	mentions Mentions
+	next     Converter
+}
+
+// NewMentionMiddleware creates a Converter which resolves the placeholders of the mention template function.
+// Adaptive Cards get the matching msteams.entities for the placeholders of their body, the placeholders
+// elsewhere, e.g. in actions, and those of Office 365 connector cards only get the display name
+// because they do not support mentions.
+func NewMentionMiddleware(mentions Mentions, next Converter) Converter {
+	return mentionMiddleware{mentions, next}
+}
+
+func (m mentionMiddleware) Convert(ctx context.Context, wm webhook.Message) (Office365ConnectorCard, error) {
+	c, err := m.next.Convert(ctx, wm)
+	if err != nil {
+		return c, err
+	}
+
+	replace := func(s string) string {
+		return mentionPattern.ReplaceAllStringFunc(s, func(p string) string {
+			return m.resolve(mentionPattern.FindStringSubmatch(p)[1]).Name
+		})
+	}
+	c.Title = replace(c.Title)
+	c.Text = replace(c.Text)
+	c.Summary = replace(c.Summary)
+	for i, s := range c.Sections {
+		s.Title = replace(s.Title)
+		s.ActivityTitle = replace(s.ActivityTitle)
+		s.ActivitySubtitle = replace(s.ActivitySubtitle)
+		s.ActivityText = replace(s.ActivityText)
+		s.Text = replace(s.Text)
+		for j, f := range s.Facts {
+			s.Facts[j].Value = replace(f.Value)
+		}
+		c.Sections[i] = s
+	}
+	return c, nil
+}
+
+func (m mentionMiddleware) ConvertWorkflow(ctx context.Context, wm webhook.Message) (WorkflowConnectorCard, error) {
+	c, err := m.next.ConvertWorkflow(ctx, wm)
+	if err != nil {
+		return c, err
+	}
+
+	for i := range c.Attachments {
+		content := &c.Attachments[i].Content
+
+		existing := map[string]bool{}
+		for _, e := range content.MsTeams.Entities {
+			existing[e.Text] = true
+		}
+
+		var found []Mention
+		for _, elem := range content.Body {
+			replaceInValue(elem, func(key string) string {
+				mn := m.resolve(key)
+				found = append(found, mn)
+				return fmt.Sprintf("<at>%s</at>", mn.Name)
+			})
+		}
+		// Teams only renders the mentions of the body.
+		for _, a := range content.Actions {
+			replaceInValue(map[string]interface{}(a), m.name)
+		}
+		if err := replaceInExtra(content.Extra, m.name); err != nil {
+			return c, err
+		}
+		if err := replaceInExtra(c.Attachments[i].Extra, m.name); err != nil {
+			return c, err
+		}
+
+		for _, mn := range found {
+			text := fmt.Sprintf("<at>%s</at>", mn.Name)
+			if existing[text] {
+				continue
+			}
+			existing[text] = true
+			content.MsTeams.Entities = append(content.MsTeams.Entities, Entity{
+				Type:      mentionEntityType,
+				Text:      text,
+				Mentioned: &Mentioned{ID: mn.ID, Name: mn.Name, Type: mn.Type},
+			})
+		}
+	}
+	return c, replaceInExtra(c.Extra, m.name)
+}
+
+// ConvertRaw replaces the placeholders by the display names, the raw webhook types have no Teams mentions.
+func (m mentionMiddleware) ConvertRaw(ctx context.Context, wm webhook.Message) (json.RawMessage, error) {
+	c, err := m.next.ConvertRaw(ctx, wm)
+	if err != nil {
+		return c, err
+	}
+	return replaceInRaw(c, m.name)
+}
+
+// replaceInExtra replaces the placeholders in the properties which are not modelled.
+func replaceInExtra(extra map[string]json.RawMessage, replace func(key string) string) error {
+	for k, raw := range extra {
+		r, err := replaceInRaw(raw, replace)
+		if err != nil {
+			return err
+		}
+		extra[k] = r
+	}
+	return nil
+}
+
+// replaceInRaw replaces the placeholders in all strings of a JSON value.
+func replaceInRaw(raw json.RawMessage, replace func(key string) string) (json.RawMessage, error) {
+	if !mentionPattern.Match(raw) && !bytes.Contains(raw, []byte(`\u003cat\u003e`)) {
+		return raw, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return raw, err
+	}
+	return json.Marshal(replaceInValue(v, replace))
+}
+
+// replaceInValue replaces the placeholders in all strings of a decoded JSON value in place,
+// replace is called with the key of each placeholder.
+func replaceInValue(v interface{}, replace func(key string) string) interface{} {
+	switch t := v.(type) {
+	case string:
+		return mentionPattern.ReplaceAllStringFunc(t, func(p string) string {
+			return replace(mentionPattern.FindStringSubmatch(p)[1])
+		})
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = replaceInValue(e, replace)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = replaceInValue(e, replace)
+		}
+	}
+	return v
+}
+
+// name returns the display name of the key, e.g. for the placeholders Teams does not render as mentions.
+func (m mentionMiddleware) name(key string) string {
+	return m.resolve(key).Name
+}
+
+// resolve looks up the key in the configured mentions.
+// Unknown keys are mentioned as they are, which works for user principal names.
+func (m mentionMiddleware) resolve(key string) Mention {
+	// Labels may have been escaped for markdown.
+	key = strings.ReplaceAll(key, `\_`, `_`)
+	if mn, ok := m.mentions[key]; ok {
+		if mn.Name == "" {
+			mn.Name = key
+		}
+		return mn
+	}
+	return Mention{ID: key, Name: key}
+}
@@ -0,0 +1,79 @@
+package card
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+)
+
+func Test_mentionMiddleware_ConvertWorkflow(t *testing.T) {
+	tmpl, err := ParseTemplateFile("./testdata/workflow_mention.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMentionMiddleware(
+		Mentions{"monitor=master": {ID: "19:abc@thread.tacv2", Name: "Master On-Call", Type: "tag"}},
+		NewTemplatedCardCreator(tmpl, false),
+	)
+
+	got, err := m.ConvertWorkflow(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := got.Attachments[0].Content
+	wantTexts := []string{
+		"<at>Master On-Call</at> please check high_memory_load",
+		"owner: <at>owner@corp.com</at>, again <at>owner@corp.com</at>",
+	}
+	for i, want := range wantTexts {
+		if text, _ := content.Body[i]["text"].(string); text != want {
+			t.Fatalf("want text %q, got %q", want, text)
+		}
+	}
+
+	wantEntities := []Entity{
+		{
+			Type:      mentionEntityType,
+			Text:      "<at>Master On-Call</at>",
+			Mentioned: &Mentioned{ID: "19:abc@thread.tacv2", Name: "Master On-Call", Type: "tag"},
+		},
+		{
+			Type:      mentionEntityType,
+			Text:      "<at>owner@corp.com</at>",
+			Mentioned: &Mentioned{ID: "owner@corp.com", Name: "owner@corp.com"},
+		},
+	}
+	if diff := cmp.Diff(wantEntities, content.MsTeams.Entities); diff != "" {
+		t.Fatalf("entities mismatch (-want +got):\n%s", diff)
+	}
+
+	// Placeholders outside the body get the display name.
+	if title := content.Actions[0]["title"]; title != "Page Master On-Call" {
+		t.Fatalf("want the action title with the display name, got %q", title)
+	}
+	if fallback := string(content.Extra["fallbackText"]); fallback != `"Master On-Call please check high_memory_load"` {
+		t.Fatalf("want the fallbackText with the display name, got %s", fallback)
+	}
+
+	// msteams properties which are not modelled must survive.
+	b, err := json.Marshal(content.MsTeams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msteams map[string]interface{}
+	if err := json.Unmarshal(b, &msteams); err != nil {
+		t.Fatal(err)
+	}
+	if msteams["allowExpand"] != true || msteams["width"] != "Full" {
+		t.Fatalf("msteams properties were dropped: %s", b)
+	}
+}
@@ -0,0 +1,54 @@
+package card
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/route"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var conversionFailures = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "prometheus_msteams_conversion_failures_total",
+		Help: "Number of notifications which could not be converted to a card, by route and template.",
+	},
+	[]string{"route", "tenant", "template"},
+)
+
+type instrumentingMiddleware struct {
+	template string
+	next     Converter
+}
+
+// NewInstrumentingMiddleware creates a Converter counting the conversion failures of the template,
+// e.g. the template or layout file of a connector, labelled with the route and tenant of the context.
+func NewInstrumentingMiddleware(template string, next Converter) Converter {
+	return instrumentingMiddleware{template, next}
+}
+
+func (m instrumentingMiddleware) Convert(ctx context.Context, wm webhook.Message) (Office365ConnectorCard, error) {
+	c, err := m.next.Convert(ctx, wm)
+	if err != nil {
+		conversionFailures.WithLabelValues(route.Labels(ctx, m.template)...).Inc()
+	}
+	return c, err
+}
+
+func (m instrumentingMiddleware) ConvertWorkflow(ctx context.Context, wm webhook.Message) (WorkflowConnectorCard, error) {
+	c, err := m.next.ConvertWorkflow(ctx, wm)
+	if err != nil {
+		conversionFailures.WithLabelValues(route.Labels(ctx, m.template)...).Inc()
+	}
+	return c, err
+}
+
+func (m instrumentingMiddleware) ConvertRaw(ctx context.Context, wm webhook.Message) (json.RawMessage, error) {
+	c, err := m.next.ConvertRaw(ctx, wm)
+	if err != nil {
+		conversionFailures.WithLabelValues(route.Labels(ctx, m.template)...).Inc()
+	}
+	return c, err
+}
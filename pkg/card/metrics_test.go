@@ -0,0 +1,46 @@
+package card
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/route"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type failingConverter struct{}
+
+func (failingConverter) Convert(context.Context, webhook.Message) (Office365ConnectorCard, error) {
+	return Office365ConnectorCard{}, errors.New("failed")
+}
+
+func (failingConverter) ConvertWorkflow(context.Context, webhook.Message) (WorkflowConnectorCard, error) {
+	return WorkflowConnectorCard{}, errors.New("failed")
+}
+
+func (failingConverter) ConvertRaw(context.Context, webhook.Message) (json.RawMessage, error) {
+	return nil, errors.New("failed")
+}
+
+func TestInstrumentingMiddleware(t *testing.T) {
+	c := NewInstrumentingMiddleware("broken.tmpl", failingConverter{})
+	ctx := route.WithTenant(route.NewContext(context.Background(), "/alerts"), "team-a")
+	if _, err := c.Convert(ctx, webhook.Message{}); err == nil {
+		t.Fatal("want an error")
+	}
+	if _, err := c.ConvertWorkflow(ctx, webhook.Message{}); err == nil {
+		t.Fatal("want an error")
+	}
+	if _, err := c.ConvertRaw(context.Background(), webhook.Message{}); err == nil {
+		t.Fatal("want an error")
+	}
+	if got := testutil.ToFloat64(conversionFailures.WithLabelValues("/alerts", "team-a", "broken.tmpl")); got != 2 {
+		t.Fatalf("want 2 conversion failures of the tenant route, got %v", got)
+	}
+	if got := testutil.ToFloat64(conversionFailures.WithLabelValues("", "", "broken.tmpl")); got != 1 {
+		t.Fatalf("want 1 conversion failure without route, got %v", got)
+	}
+}
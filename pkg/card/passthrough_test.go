@@ -0,0 +1,111 @@
+package card
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+)
+
+func Test_templatedCard_unknownFieldsPassthrough(t *testing.T) {
+	a, err := testutils.ParseWebhookJSONFromFile(testPromAlertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		templateFile string
+		convert      func(Converter) (interface{}, error)
+		want         string
+	}{
+		{
+			name:         "message card",
+			templateFile: "./testdata/passthrough-message-card.tmpl",
+			convert: func(c Converter) (interface{}, error) {
+				return c.Convert(context.Background(), a)
+			},
+			want: `{
+				"@type": "MessageCard",
+				"@context": "http://schema.org/extensions",
+				"title": "firing",
+				"text": "",
+				"summary": "",
+				"themeColor": "",
+				"correlationId": "high_memory_load",
+				"originator": "11111111-2222-3333-4444-555555555555",
+				"hideOriginalBody": true,
+				"sections": [{
+					"activityTitle": "Prometheus Test",
+					"heroImage": {"image": "https://example.com/graph.png", "title": "graph"},
+					"startGroup": true,
+					"markdown": true
+				}]
+			}`,
+		},
+		{
+			name:         "workflow card",
+			templateFile: "./testdata/passthrough-workflow-card.tmpl",
+			convert: func(c Converter) (interface{}, error) {
+				return c.ConvertWorkflow(context.Background(), a)
+			},
+			want: `{
+				"type": "message",
+				"summary": "Prometheus Test",
+				"attachments": [{
+					"contentType": "application/vnd.microsoft.card.adaptive",
+					"contentUrl": null,
+					"name": "alert",
+					"content": {
+						"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+						"type": "AdaptiveCard",
+						"version": "1.5",
+						"fallbackText": "Prometheus Test",
+						"speak": "high_memory_load",
+						"minHeight": "100px",
+						"rtl": false,
+						"selectAction": {"type": "Action.OpenUrl", "url": "http://docker.for.mac.host.internal:9093"},
+						"refresh": {"userIds": []},
+						"authentication": {"text": "sign in"},
+						"msteams": {"width": "Full"},
+						"backgroundImage": {"url": ""},
+						"body": [{"type": "TextBlock", "text": "test"}]
+					}
+				}]
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplateFile(tt.templateFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := tt.convert(NewTemplatedCardCreator(tmpl, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := json.Marshal(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got, want interface{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
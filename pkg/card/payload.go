@@ -0,0 +1,201 @@
+package card
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// PayloadLogMode is how much of the alerts and cards is logged.
+type PayloadLogMode string
+
+// Payload log modes.
+const (
+	// PayloadLogNone logs neither the summary nor the payload of the messages.
+	PayloadLogNone PayloadLogMode = "none"
+	// PayloadLogSummary logs the group key, alert count and status of the messages.
+	PayloadLogSummary PayloadLogMode = "summary"
+	// PayloadLogFull additionally logs the alerts and cards at debug level.
+	PayloadLogFull PayloadLogMode = "full"
+)
+
+// DefaultPayloadLogMaxBytes caps the logged alerts and cards when PayloadLogOptions.MaxBytes is 0.
+const DefaultPayloadLogMaxBytes = 4096
+
+const redacted = "<redacted>"
+
+// PayloadLogOptions configures what is logged about the alerts and cards.
+// The zero value logs the summary.
+type PayloadLogOptions struct {
+	Mode PayloadLogMode
+	// MaxBytes caps each logged alert and card, DefaultPayloadLogMaxBytes if 0.
+	MaxBytes int
+	// RedactLabels and RedactAnnotations match the names of the labels and annotations
+	// whose values are replaced in the logs, i.e. in the group key, the alerts and the card rendered from them.
+	RedactLabels      []*regexp.Regexp
+	RedactAnnotations []*regexp.Regexp
+}
+
+// ParsePayloadLogMode parses a payload log mode, the summary if empty.
+func ParsePayloadLogMode(s string) (PayloadLogMode, error) {
+	switch m := PayloadLogMode(s); m {
+	case "":
+		return PayloadLogSummary, nil
+	case PayloadLogNone, PayloadLogSummary, PayloadLogFull:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid payload log mode '%s', must be '%s', '%s' or '%s'", s, PayloadLogNone, PayloadLogSummary, PayloadLogFull)
+	}
+}
+
+// Summary returns the group key, alert count and status of the message as log key values,
+// none with PayloadLogNone.
+func (o PayloadLogOptions) Summary(wm webhook.Message) []interface{} {
+	if o.Mode == PayloadLogNone || wm.Data == nil {
+		return nil
+	}
+	return []interface{}{
+		"group_key", o.redactGroupKey(wm.GroupKey),
+		"alerts", len(wm.Alerts),
+		"status", wm.Status,
+	}
+}
+
+// Payload returns the message, redacted, and the card as log key values, capped.
+// The card is logged as is, so it must be rendered from the Redact of the message.
+// The values are formatted when the line is written, i.e. not if its level is filtered.
+// It returns none unless the mode is PayloadLogFull.
+func (o PayloadLogOptions) Payload(wm webhook.Message, card interface{}) []interface{} {
+	if o.Mode != PayloadLogFull {
+		return nil
+	}
+	return []interface{}{
+		"alert", lazyValue(func() string { return o.format(o.Redact(wm)) }),
+		"card", lazyValue(func() string { return o.format(card) }),
+	}
+}
+
+// lazyValue is a log value computed by the logger when it writes the line.
+type lazyValue func() string
+
+// String implements fmt.Stringer.
+func (f lazyValue) String() string {
+	return f()
+}
+
+// Redacts reports whether Redact changes messages.
+func (o PayloadLogOptions) Redacts() bool {
+	return len(o.RedactLabels) > 0 || len(o.RedactAnnotations) > 0
+}
+
+// Redact returns a copy of the message whose matching labels and annotations have redacted values,
+// e.g. to render the card logged with Payload.
+func (o PayloadLogOptions) Redact(wm webhook.Message) webhook.Message {
+	if wm.Data == nil || !o.Redacts() {
+		return wm
+	}
+	d := *wm.Data
+	d.GroupLabels = redactKV(d.GroupLabels, o.RedactLabels)
+	d.CommonLabels = redactKV(d.CommonLabels, o.RedactLabels)
+	d.CommonAnnotations = redactKV(d.CommonAnnotations, o.RedactAnnotations)
+	d.Alerts = make(template.Alerts, len(wm.Alerts))
+	for i, a := range wm.Alerts {
+		a.Labels = redactKV(a.Labels, o.RedactLabels)
+		a.Annotations = redactKV(a.Annotations, o.RedactAnnotations)
+		d.Alerts[i] = a
+	}
+	wm.Data = &d
+	wm.GroupKey = o.redactGroupKey(wm.GroupKey)
+	return wm
+}
+
+// renderedCard is a card rendered when it is marshalled, e.g. by the logger writing a line of Payload.
+type renderedCard func() (interface{}, error)
+
+// MarshalJSON implements json.Marshaler.
+func (r renderedCard) MarshalJSON() ([]byte, error) {
+	c, err := r()
+	if err != nil {
+		c = "failed to render the redacted card: " + err.Error()
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (o PayloadLogOptions) format(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err.Error()
+	}
+	max := o.MaxBytes
+	if max <= 0 {
+		max = DefaultPayloadLogMaxBytes
+	}
+	return truncateBytes(strings.TrimSuffix(buf.String(), "\n"), max)
+}
+
+// redactKV returns a copy of kv whose values of the keys matching res are redacted.
+func redactKV(kv template.KV, res []*regexp.Regexp) template.KV {
+	if len(kv) == 0 || len(res) == 0 {
+		return kv
+	}
+	r := make(template.KV, len(kv))
+	for k, v := range kv {
+		if v != "" && matchAny(res, k) {
+			v = redacted
+		}
+		r[k] = v
+	}
+	return r
+}
+
+// groupKeyLabel matches the label="value" pairs of a group key, e.g. `{}:{customer="ACME"}`.
+var groupKeyLabel = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\]|\\.)*)"`)
+
+// redactGroupKey redacts the values of the labels of the group key matching RedactLabels.
+func (o PayloadLogOptions) redactGroupKey(key string) string {
+	if len(o.RedactLabels) == 0 {
+		return key
+	}
+	return groupKeyLabel.ReplaceAllStringFunc(key, func(pair string) string {
+		name := groupKeyLabel.FindStringSubmatch(pair)[1]
+		if !matchAny(o.RedactLabels, name) {
+			return pair
+		}
+		return name + `="` + redacted + `"`
+	})
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateBytes cuts s to at most max bytes without splitting a rune.
+func truncateBytes(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(%d bytes truncated)", s[:cut], len(s)-cut)
+}
@@ -0,0 +1,162 @@
+package card
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func payloadTestMessage() webhook.Message {
+	labels := template.KV{"alertname": "Login", "customer": "ACME <corp>"}
+	return webhook.Message{
+		Data: &template.Data{
+			Status:            "firing",
+			Alerts:            template.Alerts{{Status: "firing", Labels: labels, Annotations: template.KV{"email": "ops@acme.test"}}},
+			GroupLabels:       template.KV{"customer": "ACME <corp>"},
+			CommonLabels:      labels,
+			CommonAnnotations: template.KV{"email": "ops@acme.test"},
+		},
+		GroupKey: `{}:{customer="ACME <corp>"}`,
+	}
+}
+
+func TestPayloadLogOptionsSummary(t *testing.T) {
+	o := PayloadLogOptions{RedactLabels: []*regexp.Regexp{regexp.MustCompile("^customer$")}}
+	want := []interface{}{"group_key", `{}:{customer="<redacted>"}`, "alerts", 1, "status", "firing"}
+	if diff := cmp.Diff(want, o.Summary(payloadTestMessage())); diff != "" {
+		t.Fatalf("unexpected summary (-want +got):\n%s", diff)
+	}
+	if got := o.Payload(payloadTestMessage(), nil); got != nil {
+		t.Fatalf("want no payload in summary mode, got %v", got)
+	}
+
+	o.Mode = PayloadLogNone
+	if got := o.Summary(payloadTestMessage()); got != nil {
+		t.Fatalf("want no summary in none mode, got %v", got)
+	}
+}
+
+func TestPayloadLogOptionsPayload(t *testing.T) {
+	o := PayloadLogOptions{
+		Mode:              PayloadLogFull,
+		RedactLabels:      []*regexp.Regexp{regexp.MustCompile("^customer$")},
+		RedactAnnotations: []*regexp.Regexp{regexp.MustCompile("^email$")},
+	}
+	wm := payloadTestMessage()
+	// A short redacted value must not be replaced elsewhere.
+	wm.Alerts[0].Labels = template.KV{"alertname": "Login", "customer": "ACME <corp>", "replica": "1", "tier": "1"}
+	o.RedactLabels = append(o.RedactLabels, regexp.MustCompile("^tier$"))
+	c := Office365ConnectorCard{Title: "Login failures of <redacted>", Text: "1 failure"}
+
+	got := o.Payload(wm, c)
+	if len(got) != 4 || got[0] != "alert" || got[2] != "card" {
+		t.Fatalf("unexpected payload %v", got)
+	}
+	alert := fmt.Sprint(got[1])
+	if strings.Contains(alert, "ACME") || strings.Contains(alert, "ops@acme.test") {
+		t.Fatalf("the alert is not redacted: %s", alert)
+	}
+	for _, want := range []string{`"customer":"<redacted>"`, `"email":"<redacted>"`, `"tier":"<redacted>"`, `"replica":"1"`, `"alertname":"Login"`} {
+		if !strings.Contains(alert, want) {
+			t.Fatalf("want %s in %s", want, alert)
+		}
+	}
+	if card := fmt.Sprint(got[3]); !strings.Contains(card, `"text":"1 failure"`) {
+		t.Fatalf("want the card as is, got %s", card)
+	}
+	if wm.Alerts[0].Labels["customer"] != "ACME <corp>" {
+		t.Fatal("want the message unchanged")
+	}
+
+	o.MaxBytes = 20
+	got = o.Payload(wm, c)
+	if s := fmt.Sprint(got[1]); !strings.HasSuffix(s, "bytes truncated)") || len(s) > 50 {
+		t.Fatalf("want a truncated payload, got %s", s)
+	}
+}
+
+func TestCreatorLoggingMiddleware_redact(t *testing.T) {
+	tmpl, err := ParseTemplateFile("../../default-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	o := PayloadLogOptions{Mode: PayloadLogFull, RedactLabels: []*regexp.Regexp{regexp.MustCompile("^customer$")}}
+	c := NewCreatorLoggingMiddleware(log.NewLogfmtLogger(&buf), o, NewTemplatedCardCreator(tmpl, false))
+
+	got, err := c.Convert(context.Background(), payloadTestMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(got); !strings.Contains(string(b), "ACME") {
+		t.Fatalf("want the posted card unredacted, got %s", b)
+	}
+	if strings.Contains(buf.String(), "ACME") || !strings.Contains(buf.String(), "<redacted>") {
+		t.Fatalf("want the logged card rendered from the redacted alert, got %s", buf.String())
+	}
+}
+
+// countingConverter counts the cards it converts.
+type countingConverter struct {
+	Converter
+	converted int
+}
+
+func (c *countingConverter) Convert(ctx context.Context, wm webhook.Message) (Office365ConnectorCard, error) {
+	c.converted++
+	return c.Converter.Convert(ctx, wm)
+}
+
+func TestCreatorLoggingMiddleware_redactFiltered(t *testing.T) {
+	tmpl, err := ParseTemplateFile("../../default-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	o := PayloadLogOptions{Mode: PayloadLogFull, RedactLabels: []*regexp.Regexp{regexp.MustCompile("^customer$")}}
+	next := &countingConverter{Converter: NewTemplatedCardCreator(tmpl, false)}
+	c := NewCreatorLoggingMiddleware(level.NewFilter(log.NewLogfmtLogger(&buf), level.AllowInfo()), o, next)
+
+	if _, err := c.Convert(context.Background(), payloadTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if next.converted != 1 || buf.Len() != 0 {
+		t.Fatalf("want the redacted card not rendered above debug level, got %d conversions and %q", next.converted, buf.String())
+	}
+}
+
+func TestTruncateBytes(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"0123456789", 4, "0123...(6 bytes truncated)"},
+		{"aé", 2, "a...(2 bytes truncated)"},
+	}
+	for _, tt := range tests {
+		if got := truncateBytes(tt.s, tt.max); got != tt.want {
+			t.Errorf("truncateBytes(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestParsePayloadLogMode(t *testing.T) {
+	if m, err := ParsePayloadLogMode(""); err != nil || m != PayloadLogSummary {
+		t.Fatalf("want the summary mode by default, got %q, %v", m, err)
+	}
+	if _, err := ParsePayloadLogMode("all"); err == nil {
+		t.Fatal("want an error for an invalid mode")
+	}
+}
@@ -6,13 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"strings"
 
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
 	"github.com/prometheus/alertmanager/notify/webhook"
 	"github.com/prometheus/alertmanager/template"
-	"go.opencensus.io/trace"
-	"k8s.io/helm/pkg/engine"
 )
 
 const messageCardType = "MessageCard"
@@ -22,7 +19,7 @@ const workflowCardType = "message"
 // templatedCard implements Converter using Alert manager templating.
 type templatedCard struct {
 	template *template.Template
-	// If true, replace all character `_` with `\\_` in the prometheus alert.
+	// If true, replace all character `_` with `\\_` in the label and annotation values of the alert.
 	escapeUnderscores bool
 }
 
@@ -32,10 +29,10 @@ func NewTemplatedCardCreator(template *template.Template, escapeUnderscores bool
 }
 
 func (m *templatedCard) Convert(ctx context.Context, promAlert webhook.Message) (Office365ConnectorCard, error) {
-	_, span := trace.StartSpan(ctx, "templatedCard.Convert")
+	_, span := tracer.Start(ctx, "templatedCard.Convert")
 	defer span.End()
 
-	cardString, err := m.executeTemplate(promAlert)
+	cardString, err := m.executeTemplate(ctx, promAlert)
 	if err != nil {
 		return Office365ConnectorCard{}, err
 	}
@@ -53,10 +50,10 @@ func (m *templatedCard) Convert(ctx context.Context, promAlert webhook.Message)
 }
 
 func (m *templatedCard) ConvertWorkflow(ctx context.Context, promAlert webhook.Message) (WorkflowConnectorCard, error) {
-	_, span := trace.StartSpan(ctx, "templatedCard.ConvertWorkflow")
+	_, span := tracer.Start(ctx, "templatedCard.ConvertWorkflow")
 	defer span.End()
 
-	cardString, err := m.executeTemplate(promAlert)
+	cardString, err := m.executeTemplate(ctx, promAlert)
 	if err != nil {
 		return WorkflowConnectorCard{}, err
 	}
@@ -73,12 +70,29 @@ func (m *templatedCard) ConvertWorkflow(ctx context.Context, promAlert webhook.M
 	return card, nil
 }
 
-func (m *templatedCard) executeTemplate(promAlert webhook.Message) (string, error) {
-	// TODO(bzon): Maybe we can escape underscores after the office 365 card is finally created?
-	// That approach would be simpler to read and probably a performance gain because
-	// we don't have to run json.NewEncoder(v).Encode() multiple times.
+func (m *templatedCard) ConvertRaw(ctx context.Context, promAlert webhook.Message) (json.RawMessage, error) {
+	_, span := tracer.Start(ctx, "templatedCard.ConvertRaw")
+	defer span.End()
+
+	s, err := m.executeTemplate(ctx, promAlert)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid([]byte(s)) {
+		return nil, errors.New("the template output is not valid JSON")
+	}
+	return json.RawMessage(s), nil
+}
+
+// executeTemplate renders "teams.card", or "teams.digest" if the context has a digest.
+func (m *templatedCard) executeTemplate(ctx context.Context, promAlert webhook.Message) (string, error) {
+	labels, _ := OriginalLabelsFromContext(ctx)
+	original := originalData(promAlert, labels)
+
+	// The values are escaped for JSON by the template itself, see escapeJSONStrings,
+	// so only the underscores are escaped here.
 	if m.escapeUnderscores {
-		promAlert = jsonEscapeMessage(promAlert)
+		promAlert = markdownEscapeMessage(promAlert)
 	}
 
 	data := &template.Data{
@@ -91,8 +105,20 @@ func (m *templatedCard) executeTemplate(promAlert webhook.Message) (string, erro
 		ExternalURL:       promAlert.ExternalURL,
 	}
 
+	extra, _ := ExtraFromContext(ctx)
+	requestID := requestid.FromContext(ctx)
+	if d, ok := DigestFromContext(ctx); ok {
+		cardString, err := m.template.ExecuteTextString(
+			`{{ template "`+DigestTemplate+`" . }}`, templateData{data, original, d, extra, requestID},
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to template digest: %w", err)
+		}
+		return cardString, nil
+	}
+
 	cardString, err := m.template.ExecuteTextString(
-		`{{ template "teams.card" . }}`, data,
+		`{{ template "teams.card" . }}`, templateData{Data: data, Original: original, Extra: extra, RequestID: requestID},
 	)
 	if err != nil {
 		return "", fmt.Errorf("failed to template alerts: %w", err)
@@ -101,69 +127,87 @@ func (m *templatedCard) executeTemplate(promAlert webhook.Message) (string, erro
 	return cardString, nil
 }
 
-func jsonEncode(str string) string {
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	err := enc.Encode(str)
-	if err != nil {
-		return ""
-	}
-	return string(buf.Bytes()[1 : len(buf.Bytes())-2])
+// templateData is the data of the templates, the message with its digest and enrichment results if any,
+// and the request ID of the notification, e.g. for a card footer.
+type templateData struct {
+	*template.Data
+	// Original is the message with the labels its alerts were received with, see OriginalLabels.
+	Original  *template.Data
+	Digest    *Digest
+	Extra     Extra
+	RequestID string
 }
 
-// json escape all string values in kvData and also escape
-// '_' char so it does not get processed as markdown italic
-func jsonEncodeAlertmanagerKV(kvData template.KV) {
-	for k, v := range kvData {
-		kvData[k] = strings.ReplaceAll(jsonEncode(v), `_`, `\\_`)
-	}
+// Extra are the enrichment results of the alerts by alert fingerprint and enricher name,
+// e.g. `{{ with index $.Extra .Fingerprint }}{{ .runbook }}{{ end }}`.
+type Extra map[string]map[string]interface{}
+
+type extraKey struct{}
+
+// ContextWithExtra returns a context which makes the templated card expose the enrichment results as `.Extra`.
+func ContextWithExtra(ctx context.Context, e Extra) context.Context {
+	return context.WithValue(ctx, extraKey{}, e)
 }
 
-func jsonEscapeMessage(promAlert webhook.Message) webhook.Message {
-	retPromAlert := promAlert
-	jsonEncodeAlertmanagerKV(retPromAlert.GroupLabels)
-	jsonEncodeAlertmanagerKV(retPromAlert.CommonLabels)
-	jsonEncodeAlertmanagerKV(retPromAlert.CommonAnnotations)
-	for _, alert := range retPromAlert.Alerts {
-		jsonEncodeAlertmanagerKV(alert.Labels)
-		jsonEncodeAlertmanagerKV(alert.Annotations)
-	}
-	return retPromAlert
+// ExtraFromContext returns the enrichment results of the context, if any.
+func ExtraFromContext(ctx context.Context) (Extra, bool) {
+	e, ok := ctx.Value(extraKey{}).(Extra)
+	return e, ok
+}
+
+// OriginalLabels are the labels the alerts were received with by alert fingerprint, i.e. before relabelling.
+type OriginalLabels map[string]template.KV
+
+type originalLabelsKey struct{}
+
+// ContextWithOriginalLabels returns a context which makes the templated card expose the message
+// with the labels its alerts were received with as `.Original`, e.g. to silence them in Alertmanager.
+func ContextWithOriginalLabels(ctx context.Context, labels OriginalLabels) context.Context {
+	return context.WithValue(ctx, originalLabelsKey{}, labels)
+}
+
+// OriginalLabelsFromContext returns the original labels of the context, if any.
+func OriginalLabelsFromContext(ctx context.Context) (OriginalLabels, bool) {
+	l, ok := ctx.Value(originalLabelsKey{}).(OriginalLabels)
+	return l, ok
 }
 
-/*
-	ParseTemplateFile creates an alertmanager template from the given file.
-
-The functions include all functions (except 'env' and 'expandenv' ) from sprig (http://masterminds.github.io/sprig/)
-and the following functions from HELM templating:
-  - toToml
-  - toYaml
-  - fromYaml
-  - toJson
-  - fromJson
-*/
-func ParseTemplateFile(f string) (*template.Template, error) {
-	funcs := template.DefaultFuncs
-	for k, v := range engine.FuncMap() {
-		funcs[k] = v
-	}
-	funcs["counter"] = func() func() int {
-		i := -1
-		return func() int {
-			i++
-			return i
+// originalData returns the data of the message whose alerts have their original labels,
+// the alerts without keep their labels. The common labels are those of the original labels.
+func originalData(wm webhook.Message, labels OriginalLabels) *template.Data {
+	d := *wm.Data
+	if len(labels) == 0 {
+		return &d
+	}
+	d.Alerts = make(template.Alerts, len(wm.Alerts))
+	for i, a := range wm.Alerts {
+		if l, ok := labels[a.Fingerprint]; ok {
+			a.Labels = l
 		}
+		d.Alerts[i] = a
 	}
-	template.DefaultFuncs = funcs
-
-	if _, err := os.Stat(f); os.IsNotExist(err) {
-		return nil, fmt.Errorf("template file %s does not exist", f)
+	d.CommonLabels = template.KV{}
+	if len(d.Alerts) > 0 {
+		for k, v := range d.Alerts[0].Labels {
+			d.CommonLabels[k] = v
+		}
 	}
+	for _, a := range d.Alerts {
+		for k, v := range d.CommonLabels {
+			if a.Labels[k] != v {
+				delete(d.CommonLabels, k)
+			}
+		}
+	}
+	return &d
+}
 
-	tmpl, err := template.FromGlobs([]string{f})
+func jsonEncode(str string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(str)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse template: %v: %v", err, err)
+		return ""
 	}
-
-	return tmpl, nil
+	return string(buf.Bytes()[1 : len(buf.Bytes())-2])
 }
@@ -5,7 +5,10 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
 )
 
 const (
@@ -277,3 +280,103 @@ func Test_templatedCard_ConvertWorkflow(t *testing.T) {
 		})
 	}
 }
+
+func Test_templatedCard_Extra(t *testing.T) {
+	tmpl, err := ParseTemplateFile("./testdata/extra-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := webhook.Message{Data: &template.Data{
+		CommonLabels: template.KV{"alertname": "HighLoad"},
+		Alerts: template.Alerts{
+			{Fingerprint: "a1", Labels: template.KV{"instance": "node-1"}},
+			{Fingerprint: "b2", Labels: template.KV{"instance": "node-2"}},
+		},
+	}}
+	ctx := ContextWithExtra(context.Background(), Extra{"a1": {"value": "4.25"}})
+
+	got, err := NewTemplatedCardCreator(tmpl, false).Convert(ctx, wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Section{
+		{ActivityTitle: "node-1", Facts: []FactSection{{Name: "value", Value: "4.25"}}},
+		{ActivityTitle: "node-2", Facts: []FactSection{{Name: "value", Value: "unknown"}}},
+	}
+	if diff := cmp.Diff(want, got.Sections); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_templatedCard_RequestID(t *testing.T) {
+	tmpl, err := ParseTemplateFile("./testdata/request-id-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := webhook.Message{Data: &template.Data{CommonLabels: template.KV{"alertname": "HighLoad"}}}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"with request ID", requestid.NewContext(context.Background(), "abc-123"), "Request ID: abc-123"},
+		{"without request ID", context.Background(), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewTemplatedCardCreator(tmpl, false).Convert(tt.ctx, wm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Text != tt.want {
+				t.Fatalf("want text %q, got %q", tt.want, got.Text)
+			}
+		})
+	}
+}
+
+func Test_templatedCard_graphExamples(t *testing.T) {
+	wm := webhook.Message{Data: &template.Data{
+		Status:       "firing",
+		CommonLabels: template.KV{"alertname": "HighLoad"},
+		Alerts: template.Alerts{
+			{Fingerprint: "a1", Labels: template.KV{"alertname": "HighLoad", "instance": "node-1"}},
+			{Fingerprint: "b2", Labels: template.KV{"alertname": "HighLoad", "instance": "node-2"}},
+		},
+	}}
+	graph := "data:image/png;base64,iVBORw0KGgo="
+	ctx := ContextWithExtra(context.Background(), Extra{"a1": {"graph": graph}})
+
+	tmpl, err := ParseTemplateFile("../../examples/templates/card-with-graph.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTemplatedCardCreator(tmpl, false).Convert(ctx, wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Sections) != 2 || len(c.Sections[0].Images) != 1 || c.Sections[0].Images[0].Image != graph ||
+		len(c.Sections[1].Images) != 0 {
+		t.Fatalf("want the graph in the first section only, got %+v", c.Sections)
+	}
+
+	tmpl, err = ParseTemplateFile("../../examples/templates/workflow-card-with-graph.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewTemplatedCardCreator(tmpl, false).ConvertWorkflow(ctx, wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images int
+	for _, e := range w.Attachments[0].Content.Body {
+		if e["type"] == "Image" && e["url"] == graph {
+			images++
+		}
+	}
+	if images != 1 {
+		t.Fatalf("want 1 image, got %d", images)
+	}
+}
@@ -0,0 +1,83 @@
+package decode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+const azureMonitorSchemaID = "azureMonitorCommonAlertSchema"
+
+// azureMonitorMessage is the common alert schema of Azure Monitor.
+// See https://learn.microsoft.com/en-us/azure/azure-monitor/alerts/alerts-common-schema
+type azureMonitorMessage struct {
+	SchemaID string `json:"schemaId"`
+	Data     struct {
+		Essentials struct {
+			AlertID            string    `json:"alertId"`
+			AlertRule          string    `json:"alertRule"`
+			Severity           string    `json:"severity"`
+			SignalType         string    `json:"signalType"`
+			MonitorCondition   string    `json:"monitorCondition"`
+			MonitoringService  string    `json:"monitoringService"`
+			AlertTargetIDs     []string  `json:"alertTargetIDs"`
+			ConfigurationItems []string  `json:"configurationItems"`
+			FiredDateTime      time.Time `json:"firedDateTime"`
+			ResolvedDateTime   time.Time `json:"resolvedDateTime"`
+			Description        string    `json:"description"`
+		} `json:"essentials"`
+	} `json:"data"`
+}
+
+// azureMonitorDecoder decodes the alerts of Azure Monitor action groups using the common alert schema.
+// An alert has the labels alertname (the alert rule), severity, signal_type, monitoring_service and
+// configuration_items, and the annotations description, alert_id and alert_target_ids.
+// It is grouped by its alert rule.
+type azureMonitorDecoder struct{}
+
+func (azureMonitorDecoder) Decode(b []byte) (webhook.Message, error) {
+	var am azureMonitorMessage
+	if err := json.Unmarshal(b, &am); err != nil {
+		return webhook.Message{}, err
+	}
+	if am.SchemaID != azureMonitorSchemaID {
+		return webhook.Message{}, fmt.Errorf("the webhook message does not use the Azure Monitor common alert schema, schemaId '%s'", am.SchemaID)
+	}
+
+	e := am.Data.Essentials
+	a := template.Alert{
+		Status: firing,
+		Labels: nonEmpty(template.KV{
+			"alertname":           e.AlertRule,
+			"severity":            e.Severity,
+			"signal_type":         e.SignalType,
+			"monitoring_service":  e.MonitoringService,
+			"configuration_items": strings.Join(e.ConfigurationItems, ","),
+		}),
+		Annotations: nonEmpty(template.KV{
+			"description":      e.Description,
+			"alert_id":         e.AlertID,
+			"alert_target_ids": strings.Join(e.AlertTargetIDs, ","),
+		}),
+		StartsAt: e.FiredDateTime,
+	}
+	if e.MonitorCondition == "Resolved" {
+		a.Status = resolved
+		a.EndsAt = e.ResolvedDateTime
+	}
+	return newMessage("", "", template.Alerts{a}, []string{"alertname"}), nil
+}
+
+// nonEmpty removes the empty values of kv.
+func nonEmpty(kv template.KV) template.KV {
+	for k, v := range kv {
+		if v == "" {
+			delete(kv, k)
+		}
+	}
+	return kv
+}
@@ -0,0 +1,172 @@
+// Package decode normalises the webhooks of alerting systems into Alertmanager webhook messages,
+// so the templates render them like alerts of Alertmanager.
+package decode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// Format is the webhook format a Decoder accepts.
+type Format string
+
+// Supported formats.
+const (
+	Alertmanager Format = "alertmanager"
+	// Grafana is the webhook of Grafana unified alerting.
+	Grafana Format = "grafana"
+	// AzureMonitor is the common alert schema of Azure Monitor action groups.
+	AzureMonitor Format = "azure-monitor-common-schema"
+	// GenericJSON maps any JSON document to alerts with JSONPath expressions.
+	GenericJSON Format = "generic-json"
+)
+
+// Alert statuses.
+const (
+	firing   = "firing"
+	resolved = "resolved"
+)
+
+// Decoder decodes a request body into a webhook message.
+type Decoder interface {
+	Decode(b []byte) (webhook.Message, error)
+}
+
+// Config selects the Decoder of a route.
+type Config struct {
+	// Format is the webhook format, "alertmanager" if empty.
+	Format Format `yaml:"format"`
+	// Mapping is required by the "generic-json" format.
+	Mapping *Mapping `yaml:"mapping"`
+}
+
+// New creates the Decoder of the config, the Alertmanager decoder if c is nil.
+func New(c *Config) (Decoder, error) {
+	if c == nil {
+		return alertmanagerDecoder{}, nil
+	}
+	if c.Mapping != nil && c.Format != GenericJSON {
+		return nil, fmt.Errorf("the input mapping is only supported by the '%s' format", GenericJSON)
+	}
+	switch c.Format {
+	case "", Alertmanager:
+		return alertmanagerDecoder{}, nil
+	case Grafana:
+		return grafanaDecoder{}, nil
+	case AzureMonitor:
+		return azureMonitorDecoder{}, nil
+	case GenericJSON:
+		if c.Mapping == nil {
+			return nil, fmt.Errorf("the '%s' input format requires a mapping", GenericJSON)
+		}
+		return newGenericDecoder(*c.Mapping)
+	default:
+		return nil, fmt.Errorf(
+			"invalid input format '%s', must be '%s', '%s', '%s' or '%s'",
+			c.Format, Alertmanager, Grafana, AzureMonitor, GenericJSON,
+		)
+	}
+}
+
+// alertmanagerDecoder decodes the webhooks of Alertmanager, and the Loki and Mimir rulers through it.
+type alertmanagerDecoder struct{}
+
+func (alertmanagerDecoder) Decode(b []byte) (webhook.Message, error) {
+	var wm webhook.Message
+	if err := json.Unmarshal(b, &wm); err != nil {
+		return wm, err
+	}
+	if wm.Data == nil || wm.Version == "" || wm.GroupKey == "" {
+		return wm, fmt.Errorf("the webhook message does not seem to be a valid Prometheus Alertmanager webhook. More information see https://prometheus.io/docs/alerting/latest/configuration/#webhook_config")
+	}
+	return wm, nil
+}
+
+// newMessage creates the message of the alerts, with the labels and annotations they have in common.
+// The group labels are the common labels named by groupBy, the status is firing if any alert fires.
+// Alerts without a fingerprint get the one of their labels.
+func newMessage(receiver, externalURL string, alerts template.Alerts, groupBy []string) webhook.Message {
+	setFingerprints(alerts)
+	data := &template.Data{
+		Receiver:          receiver,
+		Status:            resolved,
+		Alerts:            alerts,
+		GroupLabels:       template.KV{},
+		CommonLabels:      commonKV(alerts, func(a template.Alert) template.KV { return a.Labels }),
+		CommonAnnotations: commonKV(alerts, func(a template.Alert) template.KV { return a.Annotations }),
+		ExternalURL:       externalURL,
+	}
+	if len(alerts.Firing()) > 0 {
+		data.Status = firing
+	}
+	for _, name := range groupBy {
+		if v, ok := data.CommonLabels[name]; ok {
+			data.GroupLabels[name] = v
+		}
+	}
+	return webhook.Message{Data: data, Version: "4", GroupKey: groupKey(receiver, data.GroupLabels)}
+}
+
+// setFingerprints sets the fingerprint of the alerts without one from their labels, like Alertmanager does,
+// so the enrichers and digests can tell them apart.
+func setFingerprints(alerts template.Alerts) {
+	for i, a := range alerts {
+		if a.Fingerprint != "" {
+			continue
+		}
+		ls := make(model.LabelSet, len(a.Labels))
+		for k, v := range a.Labels {
+			ls[model.LabelName(k)] = model.LabelValue(v)
+		}
+		alerts[i].Fingerprint = ls.Fingerprint().String()
+	}
+}
+
+// commonKV returns the pairs all alerts have.
+func commonKV(alerts template.Alerts, kv func(template.Alert) template.KV) template.KV {
+	common := template.KV{}
+	if len(alerts) == 0 {
+		return common
+	}
+	for k, v := range kv(alerts[0]) {
+		common[k] = v
+	}
+	for _, a := range alerts[1:] {
+		other := kv(a)
+		for k, v := range common {
+			if other[k] != v {
+				delete(common, k)
+			}
+		}
+	}
+	return common
+}
+
+// groupKey formats a group key like Alertmanager does, e.g. `{}:{alertname="Disk"}`.
+func groupKey(receiver string, groupLabels template.KV) string {
+	names := make([]string, 0, len(groupLabels))
+	for k := range groupLabels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, k := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, groupLabels[k]))
+	}
+	return fmt.Sprintf("{%s}:{%s}", receiver, strings.Join(pairs, ", "))
+}
+
+// alertStatus is resolved if the alert has ended, firing otherwise.
+func alertStatus(endsAt time.Time) string {
+	if !endsAt.IsZero() && endsAt.Before(time.Now()) {
+		return resolved
+	}
+	return firing
+}
@@ -0,0 +1,200 @@
+package decode
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func decodeFile(t *testing.T, c *Config, file string) webhook.Message {
+	t.Helper()
+	d, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm, err := d.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wm
+}
+
+func TestAlertmanager(t *testing.T) {
+	wm := decodeFile(t, nil, "../card/testdata/prom_post_request.json")
+	if wm.GroupKey == "" || len(wm.Alerts) == 0 {
+		t.Fatalf("unexpected message %+v", wm)
+	}
+
+	d, _ := New(&Config{Format: Alertmanager})
+	if _, err := d.Decode([]byte(`{"status": "firing", "alerts": []}`)); err == nil {
+		t.Fatal("want an error for a message without version and group key")
+	}
+}
+
+func TestGrafana(t *testing.T) {
+	wm := decodeFile(t, &Config{Format: Grafana}, "testdata/grafana.json")
+	if wm.Version != "1" || wm.GroupKey != `{}/{alertname="HighCPU"}:{alertname="HighCPU"}` || wm.Status != "firing" {
+		t.Fatalf("unexpected message %+v", wm)
+	}
+	if len(wm.Alerts) != 1 {
+		t.Fatalf("want 1 alert, got %d", len(wm.Alerts))
+	}
+	want := template.KV{
+		"summary":       "CPU above 90%",
+		"silence_url":   "https://grafana.example.com/alerting/silence/new?matcher=alertname%3DHighCPU",
+		"dashboard_url": "https://grafana.example.com/d/node",
+		"panel_url":     "https://grafana.example.com/d/node?viewPanel=2",
+		"value_string":  "[ var='B' labels={instance=web-1} value=93.5 ]",
+	}
+	if diff := cmp.Diff(want, wm.Alerts[0].Annotations); diff != "" {
+		t.Fatalf("unexpected annotations (-want +got):\n%s", diff)
+	}
+	if wm.Alerts[0].Fingerprint != "c6eadffa33fcdf37" || wm.CommonLabels["grafana_folder"] != "Infra" {
+		t.Fatalf("unexpected alert %+v", wm.Alerts[0])
+	}
+}
+
+func TestAzureMonitor(t *testing.T) {
+	wm := decodeFile(t, &Config{Format: AzureMonitor}, "testdata/azure-monitor.json")
+	a := wm.Alerts[0]
+	wantLabels := template.KV{
+		"alertname":           "WCUS-R2-Gen2",
+		"severity":            "Sev3",
+		"signal_type":         "Metric",
+		"monitoring_service":  "Platform",
+		"configuration_items": "wcus-r2-gen2",
+	}
+	if diff := cmp.Diff(wantLabels, a.Labels); diff != "" {
+		t.Fatalf("unexpected labels (-want +got):\n%s", diff)
+	}
+	if a.Status != "resolved" || wm.Status != "resolved" || a.EndsAt.IsZero() || a.Annotations["description"] != "CPU of the VM" {
+		t.Fatalf("unexpected alert %+v", a)
+	}
+	if a.Fingerprint != "4d7144d1346775b9" {
+		t.Fatalf("want the fingerprint of the labels, got %q", a.Fingerprint)
+	}
+	if wm.GroupKey != `{}:{alertname="WCUS-R2-Gen2"}` {
+		t.Fatalf("unexpected group key %s", wm.GroupKey)
+	}
+
+	d, _ := New(&Config{Format: AzureMonitor})
+	if _, err := d.Decode([]byte(`{"schemaId": "Microsoft.Insights/activityLogs"}`)); err == nil {
+		t.Fatal("want an error for another schema")
+	}
+}
+
+func TestGenericJSON(t *testing.T) {
+	c := &Config{Format: GenericJSON, Mapping: &Mapping{
+		Alerts: "$.events[*]",
+		Status: "$.state",
+		Labels: map[string]string{
+			"alertname": "$.title",
+			"severity":  "$.priority",
+			"service":   "$.tags['service.name']",
+			"env":       "$.tags.env",
+			"team":      "$.tags.team",
+		},
+		Annotations:  map[string]string{"description": "$.body"},
+		StartsAt:     "$.last_updated",
+		GeneratorURL: "$.url",
+		Receiver:     "$.source",
+		ExternalURL:  "$.link",
+		GroupBy:      []string{"alertname", "env"},
+	}}
+	wm := decodeFile(t, c, "testdata/generic.json")
+
+	want := template.Alerts{
+		{
+			Status:       "firing",
+			Labels:       template.KV{"alertname": "Disk full", "severity": "P1", "service": "db", "env": "prod"},
+			Annotations:  template.KV{"description": "Disk usage is 98%"},
+			StartsAt:     time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+			GeneratorURL: "https://app.datadoghq.com/monitors/1",
+			// The fingerprint of the labels, no fingerprint is mapped.
+			Fingerprint: "4ed8f58d255f2ae1",
+		},
+		{
+			Status:       "resolved",
+			Labels:       template.KV{"alertname": "Disk full", "severity": "P1", "service": "db", "env": "staging"},
+			Annotations:  template.KV{"description": "Disk usage is 50%"},
+			StartsAt:     time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+			GeneratorURL: "https://app.datadoghq.com/monitors/1",
+			Fingerprint:  "d9c809acfd24571d",
+		},
+	}
+	if diff := cmp.Diff(want, wm.Alerts); diff != "" {
+		t.Fatalf("unexpected alerts (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(template.KV{"alertname": "Disk full", "severity": "P1", "service": "db"}, wm.CommonLabels); diff != "" {
+		t.Fatalf("unexpected common labels (-want +got):\n%s", diff)
+	}
+	if wm.Status != "firing" || wm.Receiver != "datadog" || wm.ExternalURL != "https://app.datadoghq.com/monitors" {
+		t.Fatalf("unexpected message %+v", wm.Data)
+	}
+	if wm.GroupKey != `{datadog}:{alertname="Disk full"}` {
+		t.Fatalf("unexpected group key %s", wm.GroupKey)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *Config
+	}{
+		{"invalid format", &Config{Format: "datadog"}},
+		{"generic-json without mapping", &Config{Format: GenericJSON}},
+		{"mapping of another format", &Config{Format: Grafana, Mapping: &Mapping{}}},
+		{"mapping without labels", &Config{Format: GenericJSON, Mapping: &Mapping{}}},
+		{"invalid JSONPath", &Config{Format: GenericJSON, Mapping: &Mapping{Labels: map[string]string{"alertname": "title"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.c); err == nil {
+				t.Fatal("want an error")
+			}
+		})
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"a": []interface{}{
+			map[string]interface{}{"b": "x"},
+			map[string]interface{}{"b": "y", "c.d": "z"},
+		},
+	}
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{"$", []interface{}{doc}},
+		{"$.a[*].b", []interface{}{"x", "y"}},
+		{"$.a[1]['c.d']", []interface{}{"z"}},
+		{`$.a[1]["b"]`, []interface{}{"y"}},
+		{"$.a[2].b", nil},
+		{"$.missing", nil},
+	}
+	for _, tt := range tests {
+		p, err := parseJSONPath(tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if diff := cmp.Diff(tt.want, p.eval(doc)); diff != "" {
+			t.Errorf("%s: unexpected values (-want +got):\n%s", tt.path, diff)
+		}
+	}
+
+	for _, path := range []string{"a.b", "$..b", "$.a[", "$.a[x]", "$a"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("want an error for %s", path)
+		}
+	}
+}
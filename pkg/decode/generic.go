@@ -0,0 +1,218 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// defaultResolvedValues are the status values of resolved alerts if Mapping.ResolvedValues is empty.
+var defaultResolvedValues = []string{"resolved", "ok", "normal", "inactive"}
+
+// Mapping maps a JSON document to alerts with JSONPath expressions.
+// Alerts is relative to the document, the other paths of the alert fields are relative to an alert.
+type Mapping struct {
+	// Alerts selects the alerts of the document, e.g. `$.events[*]`. The document is one alert if empty.
+	Alerts string `yaml:"alerts"`
+	// Status selects the status of an alert, it is firing unless the value is one of ResolvedValues.
+	// Without a status the alert is firing unless it has ended.
+	Status string `yaml:"status"`
+	// ResolvedValues are the status values of resolved alerts, compared case insensitively.
+	// "resolved", "ok", "normal" and "inactive" if empty.
+	ResolvedValues []string `yaml:"resolved_values"`
+	// Labels and Annotations map names to the paths of their values. A value is left out if the path has none.
+	Labels       map[string]string `yaml:"labels"`
+	Annotations  map[string]string `yaml:"annotations"`
+	StartsAt     string            `yaml:"starts_at"`
+	EndsAt       string            `yaml:"ends_at"`
+	GeneratorURL string            `yaml:"generator_url"`
+	Fingerprint  string            `yaml:"fingerprint"`
+	// Receiver and ExternalURL select the receiver and external URL of the message in the document.
+	Receiver    string `yaml:"receiver"`
+	ExternalURL string `yaml:"external_url"`
+	// GroupBy are the labels the message is grouped by, among the labels common to its alerts.
+	GroupBy []string `yaml:"group_by"`
+}
+
+// genericDecoder decodes JSON documents with a Mapping.
+type genericDecoder struct {
+	alerts       jsonPath
+	status       jsonPath
+	resolved     map[string]bool
+	labels       map[string]jsonPath
+	annotations  map[string]jsonPath
+	startsAt     jsonPath
+	endsAt       jsonPath
+	generatorURL jsonPath
+	fingerprint  jsonPath
+	receiver     jsonPath
+	externalURL  jsonPath
+	groupBy      []string
+}
+
+func newGenericDecoder(m Mapping) (genericDecoder, error) {
+	if len(m.Labels) == 0 {
+		return genericDecoder{}, fmt.Errorf("the input mapping requires labels")
+	}
+	d := genericDecoder{resolved: map[string]bool{}, groupBy: m.GroupBy}
+
+	var err error
+	parse := func(s string) jsonPath {
+		if s == "" || err != nil {
+			return nil
+		}
+		var p jsonPath
+		p, err = parseJSONPath(s)
+		return p
+	}
+	parseKV := func(m map[string]string) map[string]jsonPath {
+		ps := make(map[string]jsonPath, len(m))
+		for k, s := range m {
+			if ps[k] = parse(s); ps[k] == nil && err == nil {
+				err = fmt.Errorf("the input mapping of '%s' requires a JSONPath", k)
+			}
+		}
+		return ps
+	}
+	d.alerts = parse(m.Alerts)
+	d.status = parse(m.Status)
+	d.labels = parseKV(m.Labels)
+	d.annotations = parseKV(m.Annotations)
+	d.startsAt = parse(m.StartsAt)
+	d.endsAt = parse(m.EndsAt)
+	d.generatorURL = parse(m.GeneratorURL)
+	d.fingerprint = parse(m.Fingerprint)
+	d.receiver = parse(m.Receiver)
+	d.externalURL = parse(m.ExternalURL)
+	if err != nil {
+		return genericDecoder{}, err
+	}
+
+	resolvedValues := m.ResolvedValues
+	if len(resolvedValues) == 0 {
+		resolvedValues = defaultResolvedValues
+	}
+	for _, v := range resolvedValues {
+		d.resolved[strings.ToLower(v)] = true
+	}
+	return d, nil
+}
+
+func (d genericDecoder) Decode(b []byte) (webhook.Message, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return webhook.Message{}, err
+	}
+
+	objs := []interface{}{doc}
+	if d.alerts != nil {
+		objs = d.alerts.eval(doc)
+	}
+	if len(objs) == 0 {
+		return webhook.Message{}, fmt.Errorf("the JSON document has no alerts")
+	}
+
+	alerts := make(template.Alerts, 0, len(objs))
+	for _, obj := range objs {
+		a, err := d.alert(obj)
+		if err != nil {
+			return webhook.Message{}, err
+		}
+		alerts = append(alerts, a)
+	}
+	return newMessage(first(d.receiver, doc), first(d.externalURL, doc), alerts, d.groupBy), nil
+}
+
+func (d genericDecoder) alert(obj interface{}) (template.Alert, error) {
+	a := template.Alert{
+		Labels:       template.KV{},
+		Annotations:  template.KV{},
+		GeneratorURL: first(d.generatorURL, obj),
+		Fingerprint:  first(d.fingerprint, obj),
+	}
+	for k, p := range d.labels {
+		if v := first(p, obj); v != "" {
+			a.Labels[k] = v
+		}
+	}
+	for k, p := range d.annotations {
+		if v := first(p, obj); v != "" {
+			a.Annotations[k] = v
+		}
+	}
+
+	var err error
+	if a.StartsAt, err = firstTime(d.startsAt, obj); err != nil {
+		return a, fmt.Errorf("invalid starts_at: %w", err)
+	}
+	if a.EndsAt, err = firstTime(d.endsAt, obj); err != nil {
+		return a, fmt.Errorf("invalid ends_at: %w", err)
+	}
+
+	a.Status = alertStatus(a.EndsAt)
+	if d.status != nil {
+		a.Status = firing
+		if d.resolved[strings.ToLower(first(d.status, obj))] {
+			a.Status = resolved
+		}
+	}
+	return a, nil
+}
+
+// first returns the first value of v at the path as a string, an empty string if none.
+func first(p jsonPath, v interface{}) string {
+	if p == nil {
+		return ""
+	}
+	values := p.eval(v)
+	if len(values) == 0 {
+		return ""
+	}
+	switch v := values[0].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// firstTime parses the first value of v at the path as an RFC 3339 time,
+// or a Unix time in seconds, or milliseconds if it is above 1e12.
+func firstTime(p jsonPath, v interface{}) (time.Time, error) {
+	s := first(p, v)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(int64(n)).UTC(), nil
+		}
+		return time.Unix(0, int64(n*float64(time.Second))).UTC(), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,69 @@
+package decode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// grafanaMessage is the webhook of Grafana unified alerting, an Alertmanager webhook with extra fields.
+// See https://grafana.com/docs/grafana/latest/alerting/configure-notifications/manage-contact-points/integrations/webhook-notifier/
+type grafanaMessage struct {
+	*template.Data
+	Version         string         `json:"version"`
+	GroupKey        string         `json:"groupKey"`
+	TruncatedAlerts uint64         `json:"truncatedAlerts"`
+	Alerts          []grafanaAlert `json:"alerts"`
+}
+
+type grafanaAlert struct {
+	template.Alert
+	SilenceURL   string `json:"silenceURL"`
+	DashboardURL string `json:"dashboardURL"`
+	PanelURL     string `json:"panelURL"`
+	ValueString  string `json:"valueString"`
+}
+
+// grafanaDecoder decodes the webhooks of Grafana.
+// The silence, dashboard and panel URLs and the value string of an alert become its
+// silence_url, dashboard_url, panel_url and value_string annotations, unless they are set.
+type grafanaDecoder struct{}
+
+func (grafanaDecoder) Decode(b []byte) (webhook.Message, error) {
+	var gm grafanaMessage
+	if err := json.Unmarshal(b, &gm); err != nil {
+		return webhook.Message{}, err
+	}
+	if gm.Data == nil || gm.Alerts == nil {
+		return webhook.Message{}, fmt.Errorf("the webhook message does not seem to be a valid Grafana alerting webhook")
+	}
+
+	alerts := make(template.Alerts, 0, len(gm.Alerts))
+	for _, ga := range gm.Alerts {
+		a := ga.Alert
+		if a.Annotations == nil {
+			a.Annotations = template.KV{}
+		}
+		for k, v := range map[string]string{
+			"silence_url":   ga.SilenceURL,
+			"dashboard_url": ga.DashboardURL,
+			"panel_url":     ga.PanelURL,
+			"value_string":  ga.ValueString,
+		} {
+			if _, ok := a.Annotations[k]; !ok && v != "" {
+				a.Annotations[k] = v
+			}
+		}
+		alerts = append(alerts, a)
+	}
+	setFingerprints(alerts)
+	gm.Data.Alerts = alerts
+
+	wm := webhook.Message{Data: gm.Data, Version: gm.Version, GroupKey: gm.GroupKey, TruncatedAlerts: gm.TruncatedAlerts}
+	if wm.GroupKey == "" {
+		wm.GroupKey = groupKey(wm.Receiver, wm.GroupLabels)
+	}
+	return wm, nil
+}
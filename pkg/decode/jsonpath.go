@@ -0,0 +1,110 @@
+package decode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a JSONPath expression of child members and array elements,
+// e.g. `$.events[*].tags['service.name']`.
+type jsonPath []pathStep
+
+// pathStep selects a member by key, an element by index, or all members or elements if wildcard.
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the `$`, `.key`, `.*`, `['key']`, `[n]` and `[*]` steps of JSONPath.
+func parseJSONPath(s string) (jsonPath, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("the JSONPath '%s' must start with '$'", s)
+	}
+	var p jsonPath
+	rest := s[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "" {
+				return nil, fmt.Errorf("the JSONPath '%s' has an empty key, recursive descent is not supported", s)
+			}
+			p = append(p, pathStep{key: key, wildcard: key == "*"})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("the JSONPath '%s' has an unclosed '['", s)
+			}
+			step, err := parseBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSONPath '%s': %w", s, err)
+			}
+			p = append(p, step)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("the JSONPath '%s' has an unexpected '%c'", s, rest[0])
+		}
+	}
+	return p, nil
+}
+
+func parseBracket(s string) (pathStep, error) {
+	if s == "*" {
+		return pathStep{wildcard: true}, nil
+	}
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return pathStep{key: s[1 : len(s)-1]}, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 {
+		return pathStep{}, fmt.Errorf("'[%s]' must be a quoted key, an index or '*'", s)
+	}
+	return pathStep{index: i, isIndex: true}, nil
+}
+
+// eval returns the values v has at the path, in order.
+func (p jsonPath) eval(v interface{}) []interface{} {
+	values := []interface{}{v}
+	for _, step := range p {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, step.eval(v)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func (s pathStep) eval(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			keys := sortedKeys(v)
+			values := make([]interface{}, 0, len(keys))
+			for _, k := range keys {
+				values = append(values, v[k])
+			}
+			return values
+		}
+		if e, ok := v[s.key]; ok && !s.isIndex {
+			return []interface{}{e}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return v
+		}
+		if s.isIndex && s.index < len(v) {
+			return []interface{}{v[s.index]}
+		}
+	}
+	return nil
+}
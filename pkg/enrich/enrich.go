@@ -0,0 +1,112 @@
+// Package enrich adds data to alerts before they are rendered, e.g. the current value
+// of the alert expression, a runbook or a dashboard link.
+package enrich
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// DefaultTimeout is the timeout of a Step without one.
+const DefaultTimeout = 2 * time.Second
+
+// DefaultConcurrency is the number of steps Run calls at the same time if not set.
+const DefaultConcurrency = 10
+
+// Enricher returns data about an alert.
+type Enricher interface {
+	Enrich(ctx context.Context, a template.Alert) (interface{}, error)
+}
+
+// EnricherFunc is a function implementing Enricher.
+type EnricherFunc func(ctx context.Context, a template.Alert) (interface{}, error)
+
+// Enrich calls f.
+func (f EnricherFunc) Enrich(ctx context.Context, a template.Alert) (interface{}, error) {
+	return f(ctx, a)
+}
+
+// Step is an Enricher whose result is stored under its name.
+type Step struct {
+	Name     string
+	Timeout  time.Duration
+	Enricher Enricher
+}
+
+// Run enriches the alerts with all steps, calling at most concurrency steps at the same time, DefaultConcurrency if not positive.
+// It returns the results by alert fingerprint and step name.
+// Each step is cancelled after its timeout. Failed steps are logged and left out, they never fail the delivery.
+// Alerts without a fingerprint are not enriched.
+func Run(ctx context.Context, logger log.Logger, concurrency int, alerts template.Alerts, steps ...Step) map[string]map[string]interface{} {
+	type job struct {
+		alert template.Alert
+		step  Step
+	}
+	var jobs []job
+	for _, a := range alerts {
+		if a.Fingerprint == "" {
+			continue
+		}
+		for _, s := range steps {
+			jobs = append(jobs, job{a, s})
+		}
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	if concurrency > len(jobs) {
+		concurrency = len(jobs)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = map[string]map[string]interface{}{}
+		queue   = make(chan job, len(jobs))
+	)
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+
+	run := func(a template.Alert, s Step) {
+		timeout := s.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		v, err := s.Enricher.Enrich(ctx, a)
+		if err != nil {
+			level.Warn(logger).Log("msg", "enrichment failed", "enricher", s.Name, "fingerprint", a.Fingerprint, "err", err)
+			return
+		}
+		if v == nil {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if results[a.Fingerprint] == nil {
+			results[a.Fingerprint] = map[string]interface{}{}
+		}
+		results[a.Fingerprint][s.Name] = v
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				run(j.alert, j.step)
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
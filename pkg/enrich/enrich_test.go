@@ -0,0 +1,186 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func testAlerts() template.Alerts {
+	return template.Alerts{
+		{
+			Status:       "firing",
+			Fingerprint:  "a1",
+			Labels:       template.KV{"alertname": "HighLoad", "instance": "node-1", "job": "node"},
+			Annotations:  template.KV{"runbook_url": "https://runbooks/highload"},
+			GeneratorURL: "http://prometheus:9090/graph?g0.expr=node_load1+%3E+4&g0.tab=1",
+			StartsAt:     time.Date(2024, 3, 11, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			Status:      "resolved",
+			Fingerprint: "b2",
+			Labels:      template.KV{"alertname": "HighLoad", "instance": "node-2", "job": "node"},
+			StartsAt:    time.Date(2024, 3, 11, 12, 0, 0, 0, time.UTC),
+			EndsAt:      time.Date(2024, 3, 11, 13, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	var queries []string
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"instance":"node-0"},"value":[1710158400,"3.5"]},
+			{"metric":{"instance":"node-1"},"value":[1710158400,"4.25"]}
+		]}}`))
+	}))
+	defer prom.Close()
+
+	slow := EnricherFunc(func(ctx context.Context, _ template.Alert) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	failing := EnricherFunc(func(context.Context, template.Alert) (interface{}, error) {
+		return nil, errors.New("unavailable")
+	})
+
+	runbook, err := NewRunbookEnricher("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []Step{
+		{Name: "value", Enricher: NewPrometheusValueEnricher(prom.Client(), prom.URL+"/")},
+		{Name: "runbook", Enricher: runbook},
+		{Name: "dashboard", Enricher: NewGrafanaDashboardEnricher(
+			"https://grafana/", "node-exporter", map[string]string{"node": "instance", "cluster": "cluster"},
+		)},
+		{Name: "slow", Timeout: 10 * time.Millisecond, Enricher: slow},
+		{Name: "failing", Enricher: failing},
+	}
+
+	start := time.Now()
+	got := Run(context.Background(), log.NewNopLogger(), 0, testAlerts(), steps...)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("a slow enricher must not block, took %s", elapsed)
+	}
+
+	want := map[string]map[string]interface{}{
+		"a1": {
+			"value":     "4.25",
+			"runbook":   "https://runbooks/highload",
+			"dashboard": "https://grafana/d/node-exporter?from=1710154800000&to=now&var-node=node-1",
+		},
+		"b2": {
+			"dashboard": "https://grafana/d/node-exporter?from=1710154800000&to=1710162000000&var-node=node-2",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"node_load1 > 4"}, queries); diff != "" {
+		t.Fatalf("queries mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRun_concurrency(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		running, peak int
+	)
+	counting := EnricherFunc(func(context.Context, template.Alert) (interface{}, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "ok", nil
+	})
+
+	var alerts template.Alerts
+	for i := 0; i < 20; i++ {
+		alerts = append(alerts, template.Alert{Fingerprint: fmt.Sprintf("a%d", i)})
+	}
+	steps := []Step{{Name: "first", Enricher: counting}, {Name: "second", Enricher: counting}}
+
+	tests := []struct {
+		concurrency int
+		want        int
+	}{
+		{3, 3},
+		{0, DefaultConcurrency},
+	}
+	for _, tt := range tests {
+		peak = 0
+		got := Run(context.Background(), log.NewNopLogger(), tt.concurrency, alerts, steps...)
+		if len(got) != len(alerts) || len(got["a19"]) != len(steps) {
+			t.Fatalf("want all alerts enriched by all steps, got %v", got)
+		}
+		if peak > tt.want {
+			t.Errorf("concurrency %d: want at most %d steps at the same time, got %d", tt.concurrency, tt.want, peak)
+		}
+	}
+}
+
+func TestPrometheusValueEnricher_error(t *testing.T) {
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+	}))
+	defer prom.Close()
+
+	_, err := NewPrometheusValueEnricher(prom.Client(), prom.URL).Enrich(context.Background(), testAlerts()[0])
+	if err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestRunbookEnricher_template(t *testing.T) {
+	r, err := NewRunbookEnricher("https://runbooks/{{ .Labels.job }}/{{ .Labels.alertname }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Enrich(context.Background(), testAlerts()[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://runbooks/node/HighLoad"; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if _, err := NewRunbookEnricher("{{ .Labels"); err == nil {
+		t.Fatal("want error for an invalid template")
+	}
+}
+
+func TestRunbookEnricher_annotation(t *testing.T) {
+	r, err := NewRunbookEnricher("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testAlerts()[0]
+	a.Annotations = template.KV{"runbook_url": "https://runbooks/{{ .Labels.alertname }}"}
+	got, err := r.Enrich(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://runbooks/{{ .Labels.alertname }}"; got != want {
+		t.Fatalf("want the annotation as is %q, got %q", want, got)
+	}
+}
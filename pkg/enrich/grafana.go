@@ -0,0 +1,57 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// grafanaRangeBefore is how long before the start of the alert the dashboard time range begins.
+const grafanaRangeBefore = time.Hour
+
+type grafanaDashboard struct {
+	baseURL      string
+	dashboardUID string
+	variables    map[string]string
+}
+
+// NewGrafanaDashboardEnricher creates an Enricher which builds a link to a Grafana dashboard,
+// with its variables set from the alert labels and the time range of the alert.
+// The variables map a dashboard variable name to a label name.
+func NewGrafanaDashboardEnricher(baseURL, dashboardUID string, variables map[string]string) Enricher {
+	return grafanaDashboard{strings.TrimSuffix(baseURL, "/"), dashboardUID, variables}
+}
+
+func (g grafanaDashboard) Enrich(_ context.Context, a template.Alert) (interface{}, error) {
+	q := url.Values{}
+	names := make([]string, 0, len(g.variables))
+	for name := range g.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v, ok := a.Labels[g.variables[name]]; ok {
+			q.Set("var-"+name, v)
+		}
+	}
+
+	if !a.StartsAt.IsZero() {
+		q.Set("from", fmt.Sprint(a.StartsAt.Add(-grafanaRangeBefore).UnixMilli()))
+		if a.EndsAt.IsZero() || a.Status == "firing" {
+			q.Set("to", "now")
+		} else {
+			q.Set("to", fmt.Sprint(a.EndsAt.UnixMilli()))
+		}
+	}
+
+	u := fmt.Sprintf("%s/d/%s", g.baseURL, url.PathEscape(g.dashboardUID))
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u, nil
+}
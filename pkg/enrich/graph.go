@@ -0,0 +1,320 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// Defaults of GraphOptions.
+const (
+	DefaultGraphRange     = time.Hour
+	DefaultGraphWidth     = 400
+	DefaultGraphHeight    = 100
+	DefaultGraphMaxSeries = 5
+	// DefaultGraphMaxBytes keeps a card section with one graph below the 14KB limit of Office 365 connector cards.
+	// The services leave out graphs of a card still above the limit of its webhook type.
+	DefaultGraphMaxBytes = 8 * 1024
+)
+
+// minGraphWidth is the smallest width a graph is shrunk to when it exceeds MaxBytes.
+const minGraphWidth = 100
+
+var graphPalette = color.Palette{
+	color.White,
+	color.RGBA{0xE0, 0xE0, 0xE0, 0xFF}, // grid
+	color.RGBA{0x00, 0x78, 0xD7, 0xFF},
+	color.RGBA{0xD1, 0x34, 0x38, 0xFF},
+	color.RGBA{0x10, 0x7C, 0x10, 0xFF},
+	color.RGBA{0xFF, 0x8C, 0x00, 0xFF},
+	color.RGBA{0x88, 0x17, 0x98, 0xFF},
+}
+
+const (
+	graphGridColor   = 1
+	graphSeriesColor = 2
+)
+
+// GraphOptions configures the graphs of NewPrometheusGraphEnricher.
+type GraphOptions struct {
+	// Range is the time range of the graph ending at the end of the alert, or now if it is firing.
+	Range         time.Duration
+	Width, Height int
+	// MaxSeries is the maximum number of series drawn.
+	MaxSeries int
+	// MaxBytes is the maximum size of the data URI, larger graphs are shrunk.
+	MaxBytes int
+}
+
+func (o GraphOptions) withDefaults() GraphOptions {
+	if o.Range <= 0 {
+		o.Range = DefaultGraphRange
+	}
+	if o.Width <= 0 {
+		o.Width = DefaultGraphWidth
+	}
+	if o.Height <= 0 {
+		o.Height = DefaultGraphHeight
+	}
+	if o.MaxSeries <= 0 {
+		o.MaxSeries = DefaultGraphMaxSeries
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultGraphMaxBytes
+	}
+	return o
+}
+
+type prometheusGraph struct {
+	client  *http.Client
+	baseURL string
+	opts    GraphOptions
+	now     func() time.Time
+}
+
+// NewPrometheusGraphEnricher creates an Enricher which queries the range of the expression in the
+// GeneratorURL of the alert from a Prometheus compatible query_range endpoint at baseURL,
+// and renders it as a PNG data URI for the url of an Adaptive Card Image or a MessageCard image.
+// If the query returns series matching the alert labels, only they are drawn.
+func NewPrometheusGraphEnricher(client *http.Client, baseURL string, opts GraphOptions) Enricher {
+	return prometheusGraph{client, strings.TrimSuffix(baseURL, "/"), opts.withDefaults(), time.Now}
+}
+
+type rangeSample struct {
+	Metric map[string]string `json:"metric"`
+	Values [][]interface{}   `json:"values"`
+}
+
+type point struct {
+	t float64
+	v float64
+}
+
+func (p prometheusGraph) Enrich(ctx context.Context, a template.Alert) (interface{}, error) {
+	expr, err := alertExpr(a.GeneratorURL)
+	if err != nil || expr == "" {
+		return nil, err
+	}
+
+	end := p.now()
+	if a.Status == "resolved" && !a.EndsAt.IsZero() {
+		end = a.EndsAt
+	}
+	start := end.Add(-p.opts.Range)
+	step := p.opts.Range / time.Duration(p.opts.Width)
+	if step < time.Second {
+		step = time.Second
+	}
+
+	samples, err := p.queryRange(ctx, expr, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	var series [][]point
+	for _, smp := range p.selectSeries(samples, a) {
+		points, err := rangePoints(smp.Values)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, points)
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+
+	return renderGraph(series, float64(start.Unix()), float64(end.Unix()), p.opts)
+}
+
+func (p prometheusGraph) queryRange(ctx context.Context, expr string, start, end time.Time, step time.Duration) ([]rangeSample, error) {
+	q := url.Values{
+		"query": {expr},
+		"start": {strconv.FormatInt(start.Unix(), 10)},
+		"end":   {strconv.FormatInt(end.Unix(), 10)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/v1/query_range?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var qr queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&qr); err != nil {
+		return nil, fmt.Errorf("failed to decode query response: %w", err)
+	}
+	if qr.Status != "success" {
+		return nil, fmt.Errorf("query failed with status %d: %s", resp.StatusCode, qr.Error)
+	}
+	if qr.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("unsupported result type %q", qr.Data.ResultType)
+	}
+	var samples []rangeSample
+	if err := json.Unmarshal(qr.Data.Result, &samples); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// selectSeries returns the series matching the alert labels if any, otherwise all series, up to MaxSeries.
+func (p prometheusGraph) selectSeries(samples []rangeSample, a template.Alert) []rangeSample {
+	var matching []rangeSample
+	for _, s := range samples {
+		if matchesAlert(s.Metric, a) {
+			matching = append(matching, s)
+		}
+	}
+	if len(matching) > 0 {
+		samples = matching
+	}
+	if len(samples) > p.opts.MaxSeries {
+		samples = samples[:p.opts.MaxSeries]
+	}
+	return samples
+}
+
+// rangePoints converts [timestamp, "value"] pairs, NaN and infinite values are skipped.
+func rangePoints(values [][]interface{}) ([]point, error) {
+	points := make([]point, 0, len(values))
+	for _, v := range values {
+		if len(v) != 2 {
+			return nil, errors.New("invalid sample")
+		}
+		t, ok := v[0].(float64)
+		if !ok {
+			return nil, errors.New("invalid sample timestamp")
+		}
+		s, ok := v[1].(string)
+		if !ok {
+			return nil, errors.New("invalid sample value")
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			continue
+		}
+		points = append(points, point{t, f})
+	}
+	return points, nil
+}
+
+// renderGraph draws the series and returns the PNG as a data URI,
+// shrinking the image until it fits into MaxBytes.
+func renderGraph(series [][]point, start, end float64, opts GraphOptions) (string, error) {
+	w, h := opts.Width, opts.Height
+	for {
+		var buf bytes.Buffer
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, drawGraph(series, start, end, w, h)); err != nil {
+			return "", err
+		}
+		uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+		if len(uri) <= opts.MaxBytes {
+			return uri, nil
+		}
+		w, h = w*3/4, h*3/4
+		if w < minGraphWidth {
+			return "", fmt.Errorf("graph exceeds %d bytes", opts.MaxBytes)
+		}
+	}
+}
+
+func drawGraph(series [][]point, start, end float64, w, h int) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, w, h), graphPalette)
+
+	for i := 1; i < 4; i++ {
+		y := i * (h - 1) / 4
+		for x := 0; x < w; x++ {
+			img.SetColorIndex(x, y, graphGridColor)
+		}
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, p := range s {
+			lo, hi = math.Min(lo, p.v), math.Max(hi, p.v)
+		}
+	}
+	if math.IsInf(lo, 0) {
+		return img
+	}
+	if hi == lo {
+		lo, hi = lo-1, hi+1
+	}
+	if end <= start {
+		end = start + 1
+	}
+
+	scale := func(p point) (int, int) {
+		x := int(math.Round((p.t - start) / (end - start) * float64(w-1)))
+		y := int(math.Round((hi - p.v) / (hi - lo) * float64(h-1)))
+		return x, y
+	}
+	for i, s := range series {
+		c := uint8(graphSeriesColor + i%(len(graphPalette)-graphSeriesColor))
+		for j := range s {
+			x0, y0 := scale(s[j])
+			x1, y1 := x0, y0
+			if j > 0 {
+				x1, y1 = scale(s[j-1])
+			}
+			drawLine(img, x0, y0, x1, y1, c)
+		}
+	}
+	return img
+}
+
+// drawLine draws a line with the Bresenham algorithm.
+func drawLine(img *image.Paletted, x0, y0, x1, y1 int, c uint8) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetColorIndex(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
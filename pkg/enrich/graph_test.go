@@ -0,0 +1,92 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func graphServer(t *testing.T, queries *[]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_range" {
+			http.NotFound(w, r)
+			return
+		}
+		*queries = append(*queries, r.URL.RawQuery)
+
+		var values []string
+		for i := 0; i < 60; i++ {
+			values = append(values, fmt.Sprintf(`[%d,"%d"]`, 1710154800+i*60, i%7))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"instance":"node-0"},"values":[[1710154800,"100"]]},
+			{"metric":{"instance":"node-1"},"values":[%s,[1710158400,"NaN"]]}
+		]}}`, strings.Join(values, ","))
+	}))
+}
+
+func TestPrometheusGraphEnricher(t *testing.T) {
+	var queries []string
+	srv := graphServer(t, &queries)
+	defer srv.Close()
+
+	e := NewPrometheusGraphEnricher(srv.Client(), srv.URL, GraphOptions{Width: 200, Height: 50}).(prometheusGraph)
+	e.now = func() time.Time { return time.Unix(1710158400, 0) }
+
+	got, err := e.Enrich(context.Background(), testAlerts()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri, ok := got.(string)
+	if !ok || !strings.HasPrefix(uri, "data:image/png;base64,") {
+		t.Fatalf("want a PNG data URI, got %v", got)
+	}
+	if len(uri) > DefaultGraphMaxBytes {
+		t.Fatalf("graph of %d bytes exceeds the limit", len(uri))
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "data:image/png;base64,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 200 || size.Y != 50 {
+		t.Fatalf("want a 200x50 image, got %v", size)
+	}
+
+	want := "end=1710158400&query=node_load1+%3E+4&start=1710154800&step=18"
+	if len(queries) != 1 || queries[0] != want {
+		t.Fatalf("want query %q, got %v", want, queries)
+	}
+}
+
+func TestPrometheusGraphEnricher_maxBytes(t *testing.T) {
+	var queries []string
+	srv := graphServer(t, &queries)
+	defer srv.Close()
+
+	// The limit cannot be met, the graph is left out instead of breaking the card.
+	e := NewPrometheusGraphEnricher(srv.Client(), srv.URL, GraphOptions{MaxBytes: 100})
+	if _, err := e.Enrich(context.Background(), testAlerts()[0]); err == nil {
+		t.Fatal("want error")
+	}
+
+	// Alerts without an expression have no graph.
+	got, err := e.Enrich(context.Background(), template.Alert{Fingerprint: "c3"})
+	if err != nil || got != nil {
+		t.Fatalf("want no graph, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,123 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// prometheusValue queries the current value of the alert expression.
+type prometheusValue struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewPrometheusValueEnricher creates an Enricher which queries the Prometheus HTTP API at baseURL
+// for the current value of the expression in the GeneratorURL of the alert.
+// If the query returns several series, the value of the series matching the alert labels is used.
+func NewPrometheusValueEnricher(client *http.Client, baseURL string) Enricher {
+	return prometheusValue{client, strings.TrimSuffix(baseURL, "/")}
+}
+
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type sample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+func (p prometheusValue) Enrich(ctx context.Context, a template.Alert) (interface{}, error) {
+	expr, err := alertExpr(a.GeneratorURL)
+	if err != nil || expr == "" {
+		return nil, err
+	}
+
+	u := p.baseURL + "/api/v1/query?" + url.Values{"query": {expr}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var qr queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&qr); err != nil {
+		return nil, fmt.Errorf("failed to decode query response: %w", err)
+	}
+	if qr.Status != "success" {
+		return nil, fmt.Errorf("query failed with status %d: %s", resp.StatusCode, qr.Error)
+	}
+
+	switch qr.Data.ResultType {
+	case "scalar":
+		var v []interface{}
+		if err := json.Unmarshal(qr.Data.Result, &v); err != nil {
+			return nil, err
+		}
+		return sampleValue(v)
+	case "vector":
+		var samples []sample
+		if err := json.Unmarshal(qr.Data.Result, &samples); err != nil {
+			return nil, err
+		}
+		if len(samples) == 0 {
+			return nil, nil
+		}
+		for _, s := range samples {
+			if matchesAlert(s.Metric, a) {
+				return sampleValue(s.Value)
+			}
+		}
+		return sampleValue(samples[0].Value)
+	}
+	return nil, fmt.Errorf("unsupported result type %q", qr.Data.ResultType)
+}
+
+// alertExpr returns the expression of a Prometheus graph link like /graph?g0.expr=...
+func alertExpr(generatorURL string) (string, error) {
+	if generatorURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(generatorURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Query().Get("g0.expr"), nil
+}
+
+func matchesAlert(metric map[string]string, a template.Alert) bool {
+	for k, v := range metric {
+		if a.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// sampleValue returns the value of a [timestamp, "value"] pair.
+func sampleValue(v []interface{}) (interface{}, error) {
+	if len(v) != 2 {
+		return nil, errors.New("invalid sample")
+	}
+	s, ok := v[1].(string)
+	if !ok {
+		return nil, errors.New("invalid sample value")
+	}
+	return s, nil
+}
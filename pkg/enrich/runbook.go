@@ -0,0 +1,52 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	tmpltext "text/template"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// runbookAnnotation is the annotation used as runbook link if no template is configured.
+const runbookAnnotation = "runbook_url"
+
+type runbook struct {
+	tmpl *tmpltext.Template
+}
+
+// NewRunbookEnricher creates an Enricher which renders the runbook link of an alert,
+// e.g. `https://runbooks.example.com/{{ .Labels.alertname }}`. The template gets the alert
+// and the Alertmanager template functions. If tmpl is empty, the runbook_url annotation of the alert is
+// used as is: it comes with the request and is never executed as a template.
+func NewRunbookEnricher(tmpl string) (Enricher, error) {
+	if tmpl == "" {
+		return runbook{}, nil
+	}
+	t, err := tmpltext.New("runbook").
+		Option("missingkey=zero").
+		Funcs(tmpltext.FuncMap(template.DefaultFuncs)).
+		Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return runbook{t}, nil
+}
+
+func (r runbook) Enrich(_ context.Context, a template.Alert) (interface{}, error) {
+	if r.tmpl == nil {
+		if annotation := a.Annotations[runbookAnnotation]; annotation != "" {
+			return annotation, nil
+		}
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := r.tmpl.Execute(&buf, a); err != nil {
+		return nil, err
+	}
+	if buf.Len() == 0 {
+		return nil, nil
+	}
+	return buf.String(), nil
+}
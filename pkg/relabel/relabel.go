@@ -0,0 +1,211 @@
+// Package relabel transforms and filters the labels and annotations of alerts,
+// modelled on the relabel_configs of Prometheus.
+package relabel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// Action is the action of a relabel Config.
+type Action string
+
+// Supported relabel actions.
+const (
+	// Replace sets the target label to the replacement if the regex matches the source labels.
+	// An empty result removes the target label.
+	Replace Action = "replace"
+	// Keep drops the alert if the regex does not match the source labels.
+	Keep Action = "keep"
+	// Drop drops the alert if the regex matches the source labels.
+	Drop Action = "drop"
+	// LabelDrop removes the labels whose name matches the regex.
+	LabelDrop Action = "labeldrop"
+	// LabelKeep removes the labels whose name does not match the regex.
+	LabelKeep Action = "labelkeep"
+	// LabelMap copies the labels whose name matches the regex to the name given by the replacement.
+	LabelMap Action = "labelmap"
+)
+
+// Scope is what a relabel Config applies to.
+type Scope string
+
+// Supported relabel scopes.
+const (
+	Labels      Scope = "labels"
+	Annotations Scope = "annotations"
+)
+
+// DefaultConfig is the default relabel Config, like in Prometheus.
+var DefaultConfig = Config{
+	Separator:   ";",
+	Regex:       MustNewRegexp("(.*)"),
+	Replacement: "$1",
+	Action:      Replace,
+	Scope:       Labels,
+}
+
+// Config is a relabel step.
+type Config struct {
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    string   `yaml:"separator"`
+	Regex        Regexp   `yaml:"regex"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  string   `yaml:"replacement"`
+	Action       Action   `yaml:"action"`
+	// Scope selects the labels or the annotations, source labels are read from the same scope.
+	Scope Scope `yaml:"scope"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate checks the action, scope and target label of the config.
+func (c *Config) Validate() error {
+	switch c.Action {
+	case Replace:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %s requires a target_label", c.Action)
+		}
+	case Keep, Drop, LabelDrop, LabelKeep, LabelMap:
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	switch c.Scope {
+	case Labels, Annotations:
+	default:
+		return fmt.Errorf("unknown relabel scope %q", c.Scope)
+	}
+	if c.Regex.Regexp == nil {
+		c.Regex = DefaultConfig.Regex
+	}
+	return nil
+}
+
+// Regexp is a regular expression anchored at both ends.
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp creates an anchored Regexp.
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	return Regexp{Regexp: re, original: s}, err
+}
+
+// MustNewRegexp is like NewRegexp but panics if the expression is invalid.
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	if re.Regexp == nil {
+		return nil, nil
+	}
+	return re.original, nil
+}
+
+// Process applies the configs in order to the labels and annotations of an alert.
+// It returns false if the alert is dropped. The given KVs are not modified.
+func Process(labels, annotations template.KV, cfgs ...*Config) (template.KV, template.KV, bool) {
+	labels, annotations = copyKV(labels), copyKV(annotations)
+	for _, c := range cfgs {
+		kv := labels
+		if c.Scope == Annotations {
+			kv = annotations
+		}
+		if !relabel(kv, c) {
+			return nil, nil, false
+		}
+	}
+	return labels, annotations, true
+}
+
+// relabel applies the config to kv in place and returns false if the alert is dropped.
+func relabel(kv template.KV, c *Config) bool {
+	values := make([]string, 0, len(c.SourceLabels))
+	for _, ln := range c.SourceLabels {
+		values = append(values, kv[ln])
+	}
+	val := strings.Join(values, c.Separator)
+
+	switch c.Action {
+	case Keep:
+		return c.Regex.MatchString(val)
+	case Drop:
+		return !c.Regex.MatchString(val)
+	case Replace:
+		indexes := c.Regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			return true
+		}
+		target := string(c.Regex.ExpandString(nil, c.TargetLabel, val, indexes))
+		res := string(c.Regex.ExpandString(nil, c.Replacement, val, indexes))
+		if res == "" {
+			delete(kv, target)
+			return true
+		}
+		kv[target] = res
+	case LabelDrop:
+		for name := range kv {
+			if c.Regex.MatchString(name) {
+				delete(kv, name)
+			}
+		}
+	case LabelKeep:
+		for name := range kv {
+			if !c.Regex.MatchString(name) {
+				delete(kv, name)
+			}
+		}
+	case LabelMap:
+		mapped := template.KV{}
+		for name, v := range kv {
+			if c.Regex.MatchString(name) {
+				mapped[c.Regex.ReplaceAllString(name, c.Replacement)] = v
+			}
+		}
+		for name, v := range mapped {
+			kv[name] = v
+		}
+	}
+	return true
+}
+
+func copyKV(kv template.KV) template.KV {
+	c := make(template.KV, len(kv))
+	for k, v := range kv {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,148 @@
+package relabel
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/alertmanager/template"
+	"gopkg.in/yaml.v2"
+)
+
+func parseConfigs(t *testing.T, s string) []*Config {
+	t.Helper()
+	var cfgs []*Config
+	if err := yaml.UnmarshalStrict([]byte(s), &cfgs); err != nil {
+		t.Fatal(err)
+	}
+	return cfgs
+}
+
+func TestProcess(t *testing.T) {
+	labels := template.KV{
+		"alertname":         "HighLoad",
+		"instance":          "10.0.0.1:9100",
+		"pod_template_hash": "5d8f",
+		"endpoint":          "metrics",
+		"severity":          "crit",
+	}
+	annotations := template.KV{"summary": "load is high", "runbook_url": "https://runbooks/high-load"}
+
+	tests := []struct {
+		name            string
+		cfgs            string
+		wantLabels      template.KV
+		wantAnnotations template.KV
+		wantKeep        bool
+	}{
+		{
+			name: "drop noisy labels",
+			cfgs: `
+- action: labeldrop
+  regex: pod_template_hash|endpoint
+`,
+			wantLabels:      template.KV{"alertname": "HighLoad", "instance": "10.0.0.1:9100", "severity": "crit"},
+			wantAnnotations: annotations,
+			wantKeep:        true,
+		},
+		{
+			name: "rename and map values",
+			cfgs: `
+- source_labels: [instance]
+  regex: '(.*):\d+'
+  target_label: Host
+- action: labelkeep
+  regex: alertname|Host|severity
+- source_labels: [severity]
+  regex: crit|critical
+  target_label: severity
+  replacement: critical
+`,
+			wantLabels:      template.KV{"alertname": "HighLoad", "Host": "10.0.0.1", "severity": "critical"},
+			wantAnnotations: annotations,
+			wantKeep:        true,
+		},
+		{
+			name: "labelmap annotations",
+			cfgs: `
+- action: labelmap
+  scope: annotations
+  regex: (.*)_url
+  replacement: ${1}
+- action: labeldrop
+  scope: annotations
+  regex: .*_url
+`,
+			wantLabels:      labels,
+			wantAnnotations: template.KV{"summary": "load is high", "runbook": "https://runbooks/high-load"},
+			wantKeep:        true,
+		},
+		{
+			name: "empty replacement removes the target",
+			cfgs: `
+- source_labels: [endpoint]
+  regex: metrics
+  target_label: endpoint
+  replacement: ""
+`,
+			wantLabels: template.KV{
+				"alertname": "HighLoad", "instance": "10.0.0.1:9100", "pod_template_hash": "5d8f", "severity": "crit",
+			},
+			wantAnnotations: annotations,
+			wantKeep:        true,
+		},
+		{
+			name: "drop matching alerts",
+			cfgs: `
+- action: drop
+  source_labels: [alertname, severity]
+  regex: HighLoad;crit
+`,
+			wantKeep: false,
+		},
+		{
+			name: "keep matching alerts",
+			cfgs: `
+- action: keep
+  source_labels: [severity]
+  regex: crit
+`,
+			wantLabels:      labels,
+			wantAnnotations: annotations,
+			wantKeep:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			gotLabels, gotAnnotations, gotKeep := Process(labels, annotations, parseConfigs(t, tt.cfgs)...)
+			if gotKeep != tt.wantKeep {
+				t.Fatalf("want keep %v, got %v", tt.wantKeep, gotKeep)
+			}
+			if diff := cmp.Diff(tt.wantLabels, gotLabels); diff != "" {
+				t.Fatalf("labels mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantAnnotations, gotAnnotations); diff != "" {
+				t.Fatalf("annotations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if len(labels) != 5 || len(annotations) != 2 {
+		t.Fatal("the given labels and annotations must not be modified")
+	}
+}
+
+func TestConfig_UnmarshalYAML(t *testing.T) {
+	for _, s := range []string{
+		"- action: replace\n  source_labels: [a]",
+		"- action: rename",
+		"- action: labeldrop\n  scope: facts",
+		"- action: labeldrop\n  regex: '('",
+	} {
+		var cfgs []*Config
+		if err := yaml.Unmarshal([]byte(s), &cfgs); err == nil {
+			t.Errorf("want error for %q", s)
+		}
+	}
+}
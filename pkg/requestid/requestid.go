@@ -0,0 +1,57 @@
+// Package requestid correlates the logs, spans, responses and cards of a notification.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Header is the HTTP header the request ID is taken from and returned in.
+const Header = "X-Request-ID"
+
+// validID restricts the IDs taken from requests, so they are safe in logs and cards.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+type key struct{}
+
+// New generates a random request ID.
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// FromRequest returns the request ID of the Header of the request,
+// or a new one if the header is missing or invalid.
+func FromRequest(r *http.Request) string {
+	if id := r.Header.Get(Header); validID.MatchString(id) {
+		return id
+	}
+	return New()
+}
+
+// NewContext returns a context carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// FromContext returns the request ID of the context, empty if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
+
+// Logger returns a logger adding the request ID of the context to each log line.
+func Logger(ctx context.Context, logger log.Logger) log.Logger {
+	if id := FromContext(ctx); id != "" {
+		return log.With(logger, "request_id", id)
+	}
+	return logger
+}
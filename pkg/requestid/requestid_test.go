@@ -0,0 +1,54 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"taken from the header", "abc-123", "abc-123"},
+		{"generated without header", "", ""},
+		{"generated for an invalid header", "abc 123\nlevel=error", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/alertmanager", nil)
+			if tt.header != "" {
+				r.Header.Set(Header, tt.header)
+			}
+			got := FromRequest(r)
+			if tt.want != "" && got != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+			if tt.want == "" && (len(got) != 32 || got == tt.header) {
+				t.Fatalf("want a generated ID, got %q", got)
+			}
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+
+	_ = Logger(context.Background(), logger).Log("msg", "without")
+	_ = Logger(NewContext(context.Background(), "abc-123"), logger).Log("msg", "with")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"msg=without", "request_id=abc-123 msg=with"}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("want %q, got %q", want[i], lines[i])
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Package route carries the route and tenant of a notification, e.g. to label the metrics of its conversion and delivery.
+package route
+
+import "context"
+
+type (
+	routeKey  struct{}
+	tenantKey struct{}
+)
+
+// NewContext returns a context carrying the route, e.g. the request path of a connector.
+func NewContext(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// FromContext returns the route of the context, empty if none.
+func FromContext(ctx context.Context) string {
+	r, _ := ctx.Value(routeKey{}).(string)
+	return r
+}
+
+// WithTenant returns a context carrying the tenant of the route.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of the context, empty if none.
+func TenantFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(tenantKey{}).(string)
+	return t
+}
+
+// Labels returns the route and tenant label values of the context followed by the values.
+func Labels(ctx context.Context, values ...string) []string {
+	return append([]string{FromContext(ctx), TenantFromContext(ctx)}, values...)
+}
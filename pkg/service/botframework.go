@@ -0,0 +1,236 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// botFrameworkScope is the OAuth scope of the Bot Framework connector service.
+const botFrameworkScope = "https://api.botframework.com/.default"
+
+// botFrameworkTenant is the tenant used for multi-tenant bot registrations.
+const botFrameworkTenant = "botframework.com"
+
+// messageActivityType is the activity type for plain messages.
+const messageActivityType = "message"
+
+// ConversationReference identifies the Teams conversation a bot posts proactive messages to.
+// It is the subset of the Bot Framework conversation reference needed for sending.
+type ConversationReference struct {
+	// ServiceURL is the Bot Framework service url of the conversation, e.g. https://smba.trafficmanager.net/emea/.
+	ServiceURL string
+	// ConversationID is the id of the channel, group chat or personal chat.
+	ConversationID string
+}
+
+// BotCredentials are the app credentials of a Bot Framework registration.
+type BotCredentials struct {
+	AppID       string
+	AppPassword string
+	// TenantID is the tenant of single-tenant bots. It defaults to botframework.com.
+	TenantID string
+	// TokenURL overrides the Microsoft identity platform token endpoint.
+	TokenURL string
+}
+
+type botActivity struct {
+	Type        string                  `json:"type"`
+	Attachments []card.AdaptiveCardItem `json:"attachments"`
+}
+
+type botFrameworkService struct {
+	converter    card.Converter
+	client       *http.Client
+	conversation ConversationReference
+	tokens       *botTokenSource
+}
+
+// NewBotFrameworkService creates a Service that sends the Workflow card attachments
+// as proactive messages through the Bot Framework REST API.
+// The tokens are requested with tokenClient, which should neither retry nor record delivery attempts.
+func NewBotFrameworkService(converter card.Converter, client, tokenClient *http.Client, conversation ConversationReference, credentials BotCredentials) Service {
+	return botFrameworkService{
+		converter:    converter,
+		client:       client,
+		conversation: conversation,
+		tokens:       newBotTokenSource(tokenClient, credentials),
+	}
+}
+
+func (s botFrameworkService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	ctx, span := tracer.Start(ctx, "botFrameworkService.Post",
+		trace.WithAttributes(attribute.String("webhook.type", string(BotFramework))),
+	)
+	defer span.End()
+
+	var b []byte
+	err := fitGraphs(ctx, wm, maxAdaptiveCardSize, func(ctx context.Context) (int, error) {
+		c, err := s.converter.ConvertWorkflow(ctx, wm)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse webhook message: %w", err)
+		}
+		if b, err = json.Marshal(botActivity{Type: messageActivityType, Attachments: c.Attachments}); err != nil {
+			return 0, fmt.Errorf("failed to encode activity: %w", err)
+		}
+		return len(b), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	cardSize.WithLabelValues(routeLabels(ctx)...).Observe(float64(len(b)))
+
+	u := activitiesURL(s.conversation)
+	pr, err := s.post(ctx, u, b)
+	if err != nil {
+		return []PostResponse{pr}, err
+	}
+
+	// The token may have been revoked before it expired, fetch a new one and try once more.
+	if pr.Status == http.StatusUnauthorized {
+		s.tokens.invalidate()
+		pr, err = s.post(ctx, u, b)
+	}
+
+	return []PostResponse{pr}, err
+}
+
+func (s botFrameworkService) post(ctx context.Context, u string, b []byte) (pr PostResponse, err error) {
+	ctx, span := tracer.Start(ctx, "botFrameworkService.post",
+		trace.WithAttributes(attribute.Int("card.size_bytes", len(b))),
+	)
+	defer func() { endSpan(span, pr.Status, err) }()
+
+	pr = PostResponse{WebhookURL: u}
+
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return pr, fmt.Errorf("failed to acquire bot token: %w", err)
+	}
+
+	ctx, d := withDelivery(ctx)
+	defer func() { observeDelivery(ctx, d, pr.Status, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(b))
+	if err != nil {
+		return pr, fmt.Errorf("failed to creating a request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return pr, fmt.Errorf("http client failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	pr.Status = resp.StatusCode
+
+	rb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed reading http response body: %w", err)
+		pr.Message = err.Error()
+		return pr, err
+	}
+	pr.Message = string(rb)
+
+	return pr, nil
+}
+
+func activitiesURL(c ConversationReference) string {
+	return fmt.Sprintf(
+		"%s/v3/conversations/%s/activities",
+		strings.TrimSuffix(c.ServiceURL, "/"),
+		url.PathEscape(c.ConversationID),
+	)
+}
+
+// botTokenSource fetches and caches client credential tokens for the Bot Framework.
+type botTokenSource struct {
+	client      *http.Client
+	credentials BotCredentials
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newBotTokenSource(client *http.Client, credentials BotCredentials) *botTokenSource {
+	if credentials.TenantID == "" {
+		credentials.TenantID = botFrameworkTenant
+	}
+	if credentials.TokenURL == "" {
+		credentials.TokenURL = fmt.Sprintf(
+			"https://login.microsoftonline.com/%s/oauth2/v2.0/token",
+			url.PathEscape(credentials.TenantID),
+		)
+	}
+	return &botTokenSource{client: client, credentials: credentials}
+}
+
+// Token returns a cached token or requests a new one when it is about to expire.
+func (ts *botTokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	// Refresh a minute early so the token does not expire in flight.
+	if ts.token != "" && time.Now().Add(time.Minute).Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", ts.credentials.AppID)
+	form.Set("client_secret", ts.credentials.AppPassword)
+	form.Set("scope", botFrameworkScope)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ts.credentials.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		rb, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, rb)
+	}
+
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned an empty access token")
+	}
+
+	ts.token = tr.AccessToken
+	ts.expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	return ts.token, nil
+}
+
+func (ts *botTokenSource) invalidate() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.token = ""
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_botFrameworkService_Post(t *testing.T) {
+	tmpl, err := card.ParseTemplateFile("../../default-message-workflow-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm, err := testutils.ParseWebhookJSONFromFile("../card/testdata/prom_post_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		tokenRequests int
+		activities    []botActivity
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Form.Get("scope"); got != botFrameworkScope {
+			t.Errorf("want scope %q, got %q", botFrameworkScope, got)
+		}
+		token := "first"
+		if tokenRequests > 1 {
+			token = "second"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": token, "expires_in": 3600})
+	})
+	mux.HandleFunc("/v3/conversations/a:1/activities", func(w http.ResponseWriter, r *http.Request) {
+		// Reject the first token to simulate a revoked token.
+		if r.Header.Get("Authorization") != "Bearer second" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var a botActivity
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Fatal(err)
+		}
+		activities = append(activities, a)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	s := NewBotFrameworkService(
+		card.NewTemplatedCardCreator(tmpl, false),
+		NewRetryClient(log.NewNopLogger(), DefaultRetryPolicy(), srv.Client()),
+		srv.Client(),
+		ConversationReference{ServiceURL: srv.URL + "/", ConversationID: "a:1"},
+		BotCredentials{AppID: "app", AppPassword: "secret", TokenURL: srv.URL + "/token"},
+	)
+
+	ctx := ContextWithRoute(context.Background(), "/bot")
+	prs, err := s.Post(ctx, wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prs) != 1 || prs[0].Status != http.StatusCreated {
+		t.Fatalf("unexpected responses: %+v", prs)
+	}
+	if prs[0].WebhookURL != srv.URL+"/v3/conversations/a:1/activities" {
+		t.Fatalf("unexpected webhook url %q", prs[0].WebhookURL)
+	}
+	if tokenRequests != 2 {
+		t.Fatalf("want 2 token requests, got %d", tokenRequests)
+	}
+	if got := testutil.ToFloat64(deliveryAttempts.WithLabelValues("/bot", "")); got != 2 {
+		t.Fatalf("want the 2 activity posts counted as delivery attempts, got %v", got)
+	}
+	if len(activities) != 1 {
+		t.Fatalf("want 1 activity, got %d", len(activities))
+	}
+	if activities[0].Type != messageActivityType || len(activities[0].Attachments) != 1 {
+		t.Fatalf("unexpected activity: %+v", activities[0])
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// DigestOptions configures a digestService.
+type DigestOptions struct {
+	// Window is how long messages are collected before the digest is posted.
+	Window time.Duration
+	// GroupBy is the label the alerts of the digest are grouped by, "alertname" if empty.
+	GroupBy string
+	// TopN is the maximum number of alerts listed per group, all if 0.
+	TopN int
+}
+
+// digestService collects the messages of a window and posts them as a single digest.
+type digestService struct {
+	logger log.Logger
+	opts   DigestOptions
+	next   Service
+
+	mu       sync.Mutex
+	messages []webhook.Message
+	// originals are the original labels of the alerts of the messages, see card.ContextWithOriginalLabels.
+	originals card.OriginalLabels
+	timer     *time.Timer
+	// flushCtx is the context of the first message of the window.
+	flushCtx context.Context
+}
+
+// NewDigestService creates a Service which buffers the messages for the window of the options
+// and then posts one merged message with next. The context of that post has a card.Digest,
+// so templated cards render the "teams.digest" template definition.
+func NewDigestService(logger log.Logger, opts DigestOptions, next Service) Service {
+	if opts.GroupBy == "" {
+		opts.GroupBy = "alertname"
+	}
+	return &digestService{logger: logger, opts: opts, next: next}
+}
+
+func (s *digestService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	_, span := tracer.Start(ctx, "digestService.Post")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, wm)
+	if labels, ok := card.OriginalLabelsFromContext(ctx); ok {
+		if s.originals == nil {
+			s.originals = card.OriginalLabels{}
+		}
+		for fp, l := range labels {
+			s.originals[fp] = l
+		}
+	}
+	if s.timer == nil {
+		// The digest keeps the values of the first context, e.g. its route, but not its deadline.
+		flushCtx := context.WithoutCancel(ctx)
+		s.flushCtx = flushCtx
+		s.timer = time.AfterFunc(s.opts.Window, func() { s.flush(flushCtx) })
+	}
+	return []PostResponse{}, nil
+}
+
+// Flush posts the digest of the collected messages before the window closes, e.g. at shutdown.
+func (s *digestService) Flush(ctx context.Context) {
+	s.mu.Lock()
+	if s.timer == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.timer.Stop()
+	flushCtx := s.flushCtx
+	s.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		flushCtx, cancel = context.WithDeadline(flushCtx, deadline)
+		defer cancel()
+	}
+	s.flush(flushCtx)
+}
+
+// flush posts the digest of the collected messages.
+func (s *digestService) flush(ctx context.Context) {
+	s.mu.Lock()
+	messages := s.messages
+	originals := s.originals
+	s.messages = nil
+	s.originals = nil
+	s.timer = nil
+	s.mu.Unlock()
+
+	if len(messages) == 0 {
+		return
+	}
+
+	merged := mergeMessages(messages)
+	d := card.NewDigest(merged.Alerts, s.opts.GroupBy, s.opts.TopN)
+	d.Window = s.opts.Window
+	d.Messages = len(messages)
+
+	ctx, span := tracer.Start(ctx, "digestService.flush")
+	defer span.End()
+
+	// The context is that of the first message, the original labels are those of all messages.
+	if originals != nil {
+		ctx = card.ContextWithOriginalLabels(ctx, originals)
+	}
+
+	if _, err := s.next.Post(card.ContextWithDigest(ctx, d), merged); err != nil {
+		level.Error(requestid.Logger(ctx, s.logger)).Log("msg", "failed to post digest", "messages", len(messages), "err", err)
+	}
+}
+
+// mergeMessages combines the alerts of the messages into one message.
+// An alert received more than once is listed once with its latest state.
+func mergeMessages(messages []webhook.Message) webhook.Message {
+	var alerts template.Alerts
+	index := map[string]int{}
+	groupLabels := []template.KV{}
+	for _, m := range messages {
+		if m.Data == nil {
+			continue
+		}
+		groupLabels = append(groupLabels, m.GroupLabels)
+		for _, a := range m.Alerts {
+			if a.Fingerprint != "" {
+				if i, ok := index[a.Fingerprint]; ok {
+					alerts[i] = a
+					continue
+				}
+				index[a.Fingerprint] = len(alerts)
+			}
+			alerts = append(alerts, a)
+		}
+	}
+
+	merged := messages[len(messages)-1]
+	if merged.Data == nil || len(alerts) == 0 {
+		return merged
+	}
+	merged.Data = subData(merged.Data, alerts)
+	merged.GroupLabels = commonKV(groupLabels)
+	return merged
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+type digestRecorder struct {
+	digests  chan *card.Digest
+	messages chan webhook.Message
+}
+
+func (s digestRecorder) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	d, _ := card.DigestFromContext(ctx)
+	s.digests <- d
+	s.messages <- wm
+	return nil, nil
+}
+
+func Test_digestService_Post(t *testing.T) {
+	next := digestRecorder{make(chan *card.Digest, 1), make(chan webhook.Message, 1)}
+	s := NewDigestService(log.NewNopLogger(), DigestOptions{Window: 20 * time.Millisecond, TopN: 5}, next)
+
+	messages := []webhook.Message{
+		{Data: &template.Data{
+			GroupLabels: template.KV{"alertname": "HighLoad"},
+			Alerts: template.Alerts{
+				{Status: "firing", Fingerprint: "a", Labels: template.KV{"alertname": "HighLoad", "instance": "a"}},
+			},
+		}},
+		{Data: &template.Data{
+			GroupLabels: template.KV{"alertname": "DiskFull"},
+			Alerts: template.Alerts{
+				{Status: "firing", Fingerprint: "b", Labels: template.KV{"alertname": "DiskFull", "instance": "b"}},
+			},
+		}},
+		{Data: &template.Data{
+			GroupLabels: template.KV{"alertname": "HighLoad"},
+			Alerts: template.Alerts{
+				{Status: "resolved", Fingerprint: "a", Labels: template.KV{"alertname": "HighLoad", "instance": "a"}},
+			},
+		}},
+	}
+	for _, m := range messages {
+		prs, err := s.Post(context.Background(), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prs) != 0 {
+			t.Fatalf("want no responses while collecting, got %v", prs)
+		}
+	}
+
+	var d *card.Digest
+	select {
+	case d = <-next.digests:
+	case <-time.After(time.Second):
+		t.Fatal("digest was not posted")
+	}
+	wm := <-next.messages
+
+	if d == nil {
+		t.Fatal("want a digest in the context")
+	}
+	if d.Messages != 3 || d.Firing != 1 || d.Resolved != 1 || d.Label != "alertname" {
+		t.Fatalf("unexpected digest %+v", d)
+	}
+	if len(wm.Alerts) != 2 || wm.Alerts[0].Status != "resolved" {
+		t.Fatalf("want the alerts merged by fingerprint, got %+v", wm.Alerts)
+	}
+	if wm.Status != "firing" || len(wm.GroupLabels) != 0 {
+		t.Fatalf("unexpected merged message status %q group labels %v", wm.Status, wm.GroupLabels)
+	}
+}
+
+func Test_digestService_Flush(t *testing.T) {
+	next := digestRecorder{make(chan *card.Digest, 1), make(chan webhook.Message, 1)}
+	s := NewDigestService(log.NewNopLogger(), DigestOptions{Window: time.Hour}, next)
+
+	// Nothing to flush.
+	s.(Flusher).Flush(context.Background())
+
+	wm := webhook.Message{Data: &template.Data{
+		Alerts: template.Alerts{{Status: "firing", Fingerprint: "a", Labels: template.KV{"alertname": "HighLoad"}}},
+	}}
+	if _, err := s.Post(context.Background(), wm); err != nil {
+		t.Fatal(err)
+	}
+	s.(Flusher).Flush(context.Background())
+
+	select {
+	case d := <-next.digests:
+		if d == nil || d.Messages != 1 {
+			t.Fatalf("unexpected digest %+v", d)
+		}
+	default:
+		t.Fatal("want the digest posted by Flush before the window closes")
+	}
+	<-next.messages
+}
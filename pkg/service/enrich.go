@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/enrich"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
+	"github.com/prometheus/alertmanager/notify/webhook"
+)
+
+// enrichingService runs the enrichers before the message is converted.
+type enrichingService struct {
+	logger      log.Logger
+	concurrency int
+	steps       []enrich.Step
+	next        Service
+}
+
+// NewEnrichingService creates a Service which enriches the alerts and posts the message with next.
+// The results are exposed to templated cards as `.Extra`, failed enrichers are only logged.
+// At most concurrency steps are called at the same time, see enrich.Run.
+func NewEnrichingService(logger log.Logger, concurrency int, steps []enrich.Step, next Service) Service {
+	if len(steps) == 0 {
+		return next
+	}
+	return enrichingService{logger, concurrency, steps, next}
+}
+
+func (s enrichingService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	ctx, span := tracer.Start(ctx, "enrichingService.Post")
+	defer span.End()
+
+	if wm.Data == nil {
+		return s.next.Post(ctx, wm)
+	}
+	extra := enrich.Run(ctx, requestid.Logger(ctx, s.logger), s.concurrency, wm.Alerts, s.steps...)
+	return s.next.Post(card.ContextWithExtra(ctx, extra), wm)
+}
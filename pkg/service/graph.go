@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Maximum sizes of the cards accepted by Microsoft Teams.
+const (
+	// maxOffice365CardSize is the limit of a MessageCard, larger cards are split by section.
+	maxOffice365CardSize = 14336
+	// maxAdaptiveCardSize is the limit of a message with an Adaptive Card, posted by a Workflow or a bot.
+	maxAdaptiveCardSize = 28672
+)
+
+var graphsDropped = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "prometheus_msteams_graphs_dropped_total",
+		Help: "Number of alert graphs left out of a card because it exceeded the Teams limits.",
+	},
+	[]string{"route", "tenant"},
+)
+
+// fitGraphs calls render until the card fits into limit, leaving out the graphs of one more alert each time,
+// starting with the last one. render returns the size of the card it rendered with the enrichment results of ctx.
+// The last card is kept if it still does not fit once all graphs are left out.
+func fitGraphs(ctx context.Context, wm webhook.Message, limit int, render func(context.Context) (int, error)) error {
+	for {
+		size, err := render(ctx)
+		if err != nil || size <= limit {
+			return err
+		}
+		var ok bool
+		if ctx, ok = withoutGraph(ctx, wm); !ok {
+			return nil
+		}
+		graphsDropped.WithLabelValues(routeLabels(ctx)...).Inc()
+		trace.SpanFromContext(ctx).AddEvent("graph dropped", trace.WithAttributes(attribute.Int("card.size_bytes", size)))
+	}
+}
+
+// withoutGraph returns a context whose enrichment results leave out the graphs of the last alert having any,
+// false if there is none. Graphs are the image data URIs, e.g. of the prometheus_graph enricher.
+func withoutGraph(ctx context.Context, wm webhook.Message) (context.Context, bool) {
+	extra, ok := card.ExtraFromContext(ctx)
+	if !ok || wm.Data == nil {
+		return ctx, false
+	}
+	for i := len(wm.Alerts) - 1; i >= 0; i-- {
+		fp := wm.Alerts[i].Fingerprint
+		results := map[string]interface{}{}
+		for name, v := range extra[fp] {
+			if s, ok := v.(string); ok && strings.HasPrefix(s, "data:image/") {
+				continue
+			}
+			results[name] = v
+		}
+		if len(results) == len(extra[fp]) {
+			continue
+		}
+
+		e := make(card.Extra, len(extra))
+		for k, v := range extra {
+			e[k] = v
+		}
+		e[fp] = results
+		return card.ContextWithExtra(ctx, e), true
+	}
+	return ctx, false
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func Test_simpleService_Post_graphs(t *testing.T) {
+	wm := webhook.Message{Data: &template.Data{
+		Status: "firing",
+		Alerts: template.Alerts{
+			{Status: "firing", Fingerprint: "a1", Labels: template.KV{"alertname": "HighLoad"}},
+			{Status: "firing", Fingerprint: "a2", Labels: template.KV{"alertname": "HighLoad"}},
+			{Status: "firing", Fingerprint: "a3", Labels: template.KV{"alertname": "HighLoad"}},
+		},
+	}}
+	graph := func(b byte) string {
+		return "data:image/png;base64," + strings.Repeat(string(b), 12*1024)
+	}
+	extra := card.Extra{"a1": {"graph": graph('A'), "value": "4.25"}, "a2": {"graph": graph('B')}, "a3": {"graph": graph('C')}}
+
+	tests := []struct {
+		webhookType WebhookType
+		template    string
+		// want are the graphs kept in the posted cards.
+		want []string
+	}{
+		// A MessageCard is split into a card per section, the Workflow card drops the last graph.
+		{O365, "../../examples/templates/card-with-graph.tmpl", []string{graph('A'), graph('B'), graph('C')}},
+		{Workflow, "../../examples/templates/workflow-card-with-graph.tmpl", []string{graph('A'), graph('B')}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.webhookType), func(t *testing.T) {
+			var posted []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				posted = append(posted, string(b))
+			}))
+			defer srv.Close()
+
+			tmpl, err := card.ParseTemplateFile(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewSimpleService(card.NewTemplatedCardCreator(tmpl, false), srv.Client(), srv.URL, tt.webhookType)
+			if _, err := s.Post(card.ContextWithExtra(context.Background(), extra), wm); err != nil {
+				t.Fatal(err)
+			}
+
+			all := strings.Join(posted, "")
+			limit := maxAdaptiveCardSize
+			if tt.webhookType == O365 {
+				limit = maxOffice365CardSize
+			}
+			for _, p := range posted {
+				if len(p) > limit {
+					t.Errorf("want cards below the limit, got %d bytes", len(p))
+				}
+			}
+			if got := strings.Count(all, "data:image/"); got != len(tt.want) {
+				t.Fatalf("want %d graphs, got %d", len(tt.want), got)
+			}
+			for _, g := range tt.want {
+				if !strings.Contains(all, g) {
+					t.Fatalf("want graph %.30s... kept", g)
+				}
+			}
+		})
+	}
+}
+
+func Test_withoutGraph(t *testing.T) {
+	wm := webhook.Message{Data: &template.Data{Alerts: template.Alerts{{Fingerprint: "a1"}, {Fingerprint: "a2"}}}}
+	extra := card.Extra{"a1": {"graph": "data:image/png;base64,x", "value": "1"}, "a2": {"value": "2"}}
+
+	ctx, ok := withoutGraph(card.ContextWithExtra(context.Background(), extra), wm)
+	if !ok {
+		t.Fatal("want the graph of a1 left out")
+	}
+	got, _ := card.ExtraFromContext(ctx)
+	if _, ok := got["a1"]["graph"]; ok || got["a1"]["value"] != "1" || got["a2"]["value"] != "2" {
+		t.Fatalf("want only the graph left out, got %v", got)
+	}
+	if _, ok := extra["a1"]["graph"]; !ok {
+		t.Fatal("want the enrichment results of the message unchanged")
+	}
+	if _, ok := withoutGraph(ctx, wm); ok {
+		t.Fatal("want no graph left")
+	}
+}
@@ -3,33 +3,47 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
 	"github.com/prometheus/alertmanager/notify/webhook"
 )
 
 // loggingService is a logging middleware for Service.
 type loggingService struct {
 	logger log.Logger
+	opts   card.PayloadLogOptions
 	next   Service
 }
 
-// NewLoggingService creates a loggingService.
-func NewLoggingService(logger log.Logger, next Service) Service {
-	return loggingService{logger, next}
+// NewLoggingService creates a loggingService logging the route and the summary of each message,
+// as described by the options.
+func NewLoggingService(logger log.Logger, opts card.PayloadLogOptions, next Service) Service {
+	return loggingService{logger, opts, next}
 }
 
 func (s loggingService) Post(ctx context.Context, wm webhook.Message) (prs []PostResponse, err error) {
-	defer func() {
+	logger := requestid.Logger(ctx, s.logger)
+	defer func(begin time.Time) {
+		keyvals := append([]interface{}{"route", RouteFromContext(ctx)}, s.opts.Summary(wm)...)
+		keyvals = append(keyvals, "responses", len(prs), "took", time.Since(begin))
+		if err != nil {
+			_ = level.Error(logger).Log(append(keyvals, "err", err)...)
+		} else {
+			_ = level.Info(logger).Log(keyvals...)
+		}
+
 		for _, pr := range prs {
-			level.Debug(s.logger).Log(
+			level.Debug(logger).Log(
 				"response_message", pr.Message,
 				"response_status", pr.Status,
 				"webhook_url", pr.WebhookURL,
 				"err", err,
 			)
 		}
-	}()
+	}(time.Now())
 	return s.next.Post(ctx, wm)
 }
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/route"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	notificationsReceived = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prometheus_msteams_notifications_received_total",
+			Help: "Number of Alertmanager notifications received, by route and notification status.",
+		},
+		[]string{"route", "tenant", "status"},
+	)
+	notificationAlerts = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "prometheus_msteams_notification_alerts",
+			Help:    "Number of alerts per Alertmanager notification.",
+			Buckets: []float64{1, 2, 5, 10, 20, 50, 100, 200},
+		},
+		[]string{"route", "tenant"},
+	)
+	splitMessages = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "prometheus_msteams_split_messages",
+			Help:    "Number of messages a notification is split into by the split mode of the route.",
+			Buckets: []float64{1, 2, 5, 10, 20, 50, 100},
+		},
+		[]string{"route", "tenant"},
+	)
+	cardSplits = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "prometheus_msteams_card_splits",
+			Help:    "Number of cards a message card is split into to stay below the Teams limits.",
+			Buckets: []float64{1, 2, 3, 5, 10},
+		},
+		[]string{"route", "tenant"},
+	)
+	cardSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "prometheus_msteams_card_size_bytes",
+			Help:    "Size of the cards posted to Teams.",
+			Buckets: prometheus.ExponentialBuckets(1024, 2, 8),
+		},
+		[]string{"route", "tenant"},
+	)
+	deliveryAttempts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prometheus_msteams_delivery_attempts_total",
+			Help: "Number of HTTP requests made to deliver cards, including retries.",
+		},
+		[]string{"route", "tenant"},
+	)
+	deliveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prometheus_msteams_deliveries_total",
+			Help: "Number of cards delivered or failed, by route, outcome and Teams status code.",
+		},
+		[]string{"route", "tenant", "outcome", "status_code"},
+	)
+	deliveryRetries = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "prometheus_msteams_delivery_retries",
+			Help:    "Number of retries per delivered or failed card.",
+			Buckets: []float64{0, 1, 2, 3, 5, 10},
+		},
+		[]string{"route", "tenant", "outcome"},
+	)
+)
+
+// ContextWithRoute returns a context whose metrics are labelled with the route,
+// e.g. the request path of a connector.
+func ContextWithRoute(ctx context.Context, r string) context.Context {
+	return route.NewContext(ctx, r)
+}
+
+// RouteFromContext returns the route of the context, empty if none.
+func RouteFromContext(ctx context.Context) string {
+	return route.FromContext(ctx)
+}
+
+// ContextWithTenant returns a context whose metrics are labelled with the tenant of the route.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return route.WithTenant(ctx, tenant)
+}
+
+// TenantFromContext returns the tenant of the context, empty if none.
+func TenantFromContext(ctx context.Context) string {
+	return route.TenantFromContext(ctx)
+}
+
+// routeLabels returns the route and tenant label values of the context followed by the values.
+func routeLabels(ctx context.Context, values ...string) []string {
+	return route.Labels(ctx, values...)
+}
+
+// delivery counts the HTTP attempts of a card delivery.
+type delivery struct {
+	attempts int32
+}
+
+type deliveryKey struct{}
+
+// withDelivery returns a context counting the attempts of its requests, see ObserveAttempt.
+func withDelivery(ctx context.Context) (context.Context, *delivery) {
+	d := &delivery{}
+	return context.WithValue(ctx, deliveryKey{}, d), d
+}
+
+// ObserveAttempt records an HTTP attempt of a request made by a Service, attempt is 0 for the first one.
+// It is meant to be called by the retrying HTTP client before each attempt.
+func ObserveAttempt(req *http.Request, _ int) {
+	ctx := req.Context()
+	deliveryAttempts.WithLabelValues(routeLabels(ctx)...).Inc()
+	if d, ok := ctx.Value(deliveryKey{}).(*delivery); ok {
+		atomic.AddInt32(&d.attempts, 1)
+	}
+}
+
+// observeDelivery records the outcome of a card delivery with the final Teams status code, 0 if none.
+func observeDelivery(ctx context.Context, d *delivery, status int, err error) {
+	outcome := "success"
+	if err != nil || status >= http.StatusBadRequest {
+		outcome = "failure"
+	}
+	code := ""
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	deliveries.WithLabelValues(routeLabels(ctx, outcome, code)...).Inc()
+
+	retries := int(atomic.LoadInt32(&d.attempts)) - 1
+	if retries < 0 {
+		retries = 0
+	}
+	deliveryRetries.WithLabelValues(routeLabels(ctx, outcome)...).Observe(float64(retries))
+}
+
+// routeService labels the metrics of the next services with a route.
+type routeService struct {
+	route string
+	next  Service
+}
+
+// NewRouteService creates a Service labelling the metrics of next with the route.
+// Unlike NewInstrumentingService it does not count the notification, e.g. one rerouted by a schedule.
+func NewRouteService(route string, next Service) Service {
+	return routeService{route, next}
+}
+
+func (s routeService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	return s.next.Post(ContextWithRoute(ctx, s.route), wm)
+}
+
+// instrumentingService labels the metrics of the next services with a route
+// and counts the notifications received.
+type instrumentingService struct {
+	route string
+	next  Service
+}
+
+// NewInstrumentingService creates a Service recording the notifications received by the route,
+// the metrics of the next services are labelled with the route.
+func NewInstrumentingService(route string, next Service) Service {
+	return instrumentingService{route, next}
+}
+
+func (s instrumentingService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	var status string
+	var alerts int
+	if wm.Data != nil {
+		status = wm.Status
+		alerts = len(wm.Alerts)
+	}
+	ctx = ContextWithRoute(ctx, s.route)
+	notificationsReceived.WithLabelValues(routeLabels(ctx, status)...).Inc()
+	notificationAlerts.WithLabelValues(routeLabels(ctx)...).Observe(float64(alerts))
+
+	return s.next.Post(ctx, wm)
+}
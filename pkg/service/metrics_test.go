@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_instrumentingService_Post(t *testing.T) {
+	tmpl, err := card.ParseTemplateFile("../../default-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm, err := testutils.ParseWebhookJSONFromFile("../card/testdata/prom_post_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail the first attempt so the delivery is retried once.
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("1"))
+	}))
+	defer srv.Close()
+
+	client := NewRetryClient(
+		log.NewNopLogger(),
+		RetryPolicy{Max: 3, WaitMin: time.Millisecond, WaitMax: time.Millisecond},
+		http.DefaultClient,
+	)
+
+	const route = "/metrics-test"
+	s := NewInstrumentingService(
+		route,
+		NewSimpleService(card.NewTemplatedCardCreator(tmpl, false), client, srv.URL, O365),
+	)
+	if _, err := s.Post(context.Background(), wm); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(notificationsReceived.WithLabelValues(route, "", wm.Status)); got != 1 {
+		t.Errorf("want 1 notification received, got %v", got)
+	}
+	if got := testutil.ToFloat64(deliveryAttempts.WithLabelValues(route, "")); got != 2 {
+		t.Errorf("want 2 delivery attempts, got %v", got)
+	}
+	if got := testutil.ToFloat64(deliveries.WithLabelValues(route, "", "success", "200")); got != 1 {
+		t.Errorf("want 1 successful delivery, got %v", got)
+	}
+
+	want := `
+# HELP prometheus_msteams_delivery_retries Number of retries per delivered or failed card.
+# TYPE prometheus_msteams_delivery_retries histogram
+prometheus_msteams_delivery_retries_bucket{outcome="success",route="/metrics-test",tenant="",le="0"} 0
+prometheus_msteams_delivery_retries_bucket{outcome="success",route="/metrics-test",tenant="",le="1"} 1
+prometheus_msteams_delivery_retries_bucket{outcome="success",route="/metrics-test",tenant="",le="2"} 1
+prometheus_msteams_delivery_retries_bucket{outcome="success",route="/metrics-test",tenant="",le="3"} 1
+prometheus_msteams_delivery_retries_bucket{outcome="success",route="/metrics-test",tenant="",le="5"} 1
+prometheus_msteams_delivery_retries_bucket{outcome="success",route="/metrics-test",tenant="",le="10"} 1
+prometheus_msteams_delivery_retries_bucket{outcome="success",route="/metrics-test",tenant="",le="+Inf"} 1
+prometheus_msteams_delivery_retries_sum{outcome="success",route="/metrics-test",tenant=""} 1
+prometheus_msteams_delivery_retries_count{outcome="success",route="/metrics-test",tenant=""} 1
+`
+	if err := testutil.CollectAndCompare(
+		deliveryRetries.WithLabelValues(route, "", "success").(prometheus.Histogram),
+		strings.NewReader(want),
+	); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(cardSize); got == 0 {
+		t.Error("want the card size to be observed")
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/relabel"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// relabelService applies a relabel pipeline to the alerts before they are converted.
+type relabelService struct {
+	cfgs []*relabel.Config
+	next Service
+}
+
+// NewRelabelService creates a Service which relabels the alerts of the message and posts it with next.
+// The common labels and annotations are recomputed, the group labels keep the labels still common to all alerts.
+// The labels the alerts were received with are kept in the context, see card.ContextWithOriginalLabels.
+// Nothing is posted if all alerts are dropped.
+func NewRelabelService(cfgs []*relabel.Config, next Service) Service {
+	if len(cfgs) == 0 {
+		return next
+	}
+	return relabelService{cfgs, next}
+}
+
+func (s relabelService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	ctx, span := tracer.Start(ctx, "relabelService.Post")
+	defer span.End()
+
+	if wm.Data == nil {
+		return s.next.Post(ctx, wm)
+	}
+
+	var alerts template.Alerts
+	original := card.OriginalLabels{}
+	for _, a := range wm.Alerts {
+		labels, annotations, keep := relabel.Process(a.Labels, a.Annotations, s.cfgs...)
+		if !keep {
+			continue
+		}
+		if a.Fingerprint != "" {
+			original[a.Fingerprint] = a.Labels
+		}
+		a.Labels, a.Annotations = labels, annotations
+		alerts = append(alerts, a)
+	}
+	if len(alerts) == 0 {
+		return []PostResponse{}, nil
+	}
+
+	m := wm
+	m.Data = subData(wm.Data, alerts)
+	m.GroupLabels = template.KV{}
+	for name := range wm.GroupLabels {
+		if v, ok := m.CommonLabels[name]; ok {
+			m.GroupLabels[name] = v
+		}
+	}
+	return s.next.Post(card.ContextWithOriginalLabels(ctx, original), m)
+}
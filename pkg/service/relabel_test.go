@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/relabel"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func Test_relabelService_Post(t *testing.T) {
+	cfgs := []*relabel.Config{
+		{Action: relabel.Drop, SourceLabels: []string{"instance"}, Regex: relabel.MustNewRegexp("b"), Scope: relabel.Labels},
+		{Action: relabel.LabelDrop, Regex: relabel.MustNewRegexp("instance"), Scope: relabel.Labels},
+	}
+	next := &recordingService{}
+	s := NewRelabelService(cfgs, next)
+
+	wm := testSplitMessage()
+	if _, err := s.Post(context.Background(), wm); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.messages) != 1 {
+		t.Fatalf("want 1 message, got %d", len(next.messages))
+	}
+
+	got := next.messages[0]
+	if len(got.Alerts) != 2 {
+		t.Fatalf("want the alert on instance b dropped, got %d alerts", len(got.Alerts))
+	}
+	if diff := cmp.Diff(template.KV{"alertname": "HighLoad", "team": "db"}, got.CommonLabels); diff != "" {
+		t.Fatalf("common labels mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(testSplitMessage(), wm); diff != "" {
+		t.Fatalf("message was modified (-want +got):\n%s", diff)
+	}
+
+	// Nothing is posted when all alerts are dropped.
+	s = NewRelabelService([]*relabel.Config{
+		{Action: relabel.Keep, SourceLabels: []string{"team"}, Regex: relabel.MustNewRegexp("ops"), Scope: relabel.Labels},
+	}, next)
+	if _, err := s.Post(context.Background(), wm); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.messages) != 1 {
+		t.Fatalf("want no message posted, got %d", len(next.messages)-1)
+	}
+}
+
+// contextService records the context of the last post.
+type contextService struct {
+	ctx context.Context
+}
+
+func (s *contextService) Post(ctx context.Context, _ webhook.Message) ([]PostResponse, error) {
+	s.ctx = ctx
+	return []PostResponse{}, nil
+}
+
+func Test_relabelService_originalLabels(t *testing.T) {
+	next := &contextService{}
+	s := NewRelabelService([]*relabel.Config{
+		{Action: relabel.LabelDrop, Regex: relabel.MustNewRegexp("instance"), Scope: relabel.Labels},
+	}, next)
+
+	wm := webhook.Message{Data: &template.Data{Alerts: template.Alerts{
+		{Fingerprint: "a1", Labels: template.KV{"alertname": "HighLoad", "instance": "a"}},
+		{Labels: template.KV{"alertname": "HighLoad", "instance": "b"}},
+	}}}
+	if _, err := s.Post(context.Background(), wm); err != nil {
+		t.Fatal(err)
+	}
+
+	// The alerts without a fingerprint cannot be matched with their original labels.
+	got, ok := card.OriginalLabelsFromContext(next.ctx)
+	if !ok {
+		t.Fatal("want the original labels in the context")
+	}
+	want := card.OriginalLabels{"a1": {"alertname": "HighLoad", "instance": "a"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("original labels mismatch (-want +got):\n%s", diff)
+	}
+}
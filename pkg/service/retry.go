@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Retry policy defaults.
+const (
+	DefaultRetryMax     = 3
+	DefaultRetryWaitMin = 1 * time.Second
+	DefaultRetryWaitMax = 30 * time.Second
+)
+
+var deliveryRetriesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "prometheus_msteams_retries_total",
+		Help: "Number of delivery retries, by route and reason, i.e. the status code or \"error\".",
+	},
+	[]string{"route", "tenant", "reason"},
+)
+
+// RetryPolicy is how failed deliveries are retried.
+type RetryPolicy struct {
+	// Max is the number of retries after the first attempt.
+	Max int
+	// WaitMin and WaitMax bound the exponential backoff between attempts.
+	WaitMin time.Duration
+	WaitMax time.Duration
+	// Jitter randomizes the backoff between WaitMin and the exponential wait.
+	Jitter bool
+	// IgnoreRetryAfter does not wait for the Retry-After header of 429 and 503 responses.
+	IgnoreRetryAfter bool
+	// RetryOn are the response status codes which are retried, 429 and 5xx but 501 if empty.
+	// Connection errors are always retried.
+	RetryOn []int
+	// Deadline bounds the delivery of a notification including all retries, none if 0.
+	// It should be below the webhook timeout of Alertmanager.
+	Deadline time.Duration
+}
+
+// DefaultRetryPolicy returns the policy of the Teams client if none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Max: DefaultRetryMax, WaitMin: DefaultRetryWaitMin, WaitMax: DefaultRetryWaitMax}
+}
+
+// retryState counts the attempts of a request across retries.
+type retryState struct {
+	attempts int32
+}
+
+type retryStateKey struct{}
+
+// retryTransport gives each request its retryState before it is retried by next.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), retryStateKey{}, &retryState{})
+	return t.next.RoundTrip(req.WithContext(ctx))
+}
+
+// NewRetryClient creates a client retrying the requests of client with the policy.
+// Each retry is logged with its attempt number and reason and counted by route.
+func NewRetryClient(logger log.Logger, p RetryPolicy, client *http.Client) *http.Client {
+	rc := retryablehttp.NewClient()
+	rc.HTTPClient = client
+	rc.Logger = nil
+	rc.RetryMax = p.Max
+	rc.RetryWaitMin = p.WaitMin
+	rc.RetryWaitMax = p.WaitMax
+	rc.CheckRetry = p.checkRetry(logger)
+	rc.Backoff = p.backoff
+	rc.RequestLogHook = func(_ retryablehttp.Logger, req *http.Request, attempt int) {
+		ObserveAttempt(req, attempt)
+	}
+	return &http.Client{Transport: retryTransport{&retryablehttp.RoundTripper{Client: rc}}}
+}
+
+// checkRetry decides whether a response or error is retried and records the retries.
+func (p RetryPolicy) checkRetry(logger log.Logger) retryablehttp.CheckRetry {
+	return func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		retry, checkErr := retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+		if checkErr != nil {
+			return retry, checkErr
+		}
+		if err == nil && len(p.RetryOn) > 0 {
+			retry = p.retryOn(resp.StatusCode)
+		}
+
+		var attempt int32
+		if s, ok := ctx.Value(retryStateKey{}).(*retryState); ok {
+			attempt = atomic.AddInt32(&s.attempts, 1)
+		}
+		// Past the last attempt the client gives up, it is not a retry.
+		if !retry || int(attempt) > p.Max {
+			return retry, nil
+		}
+
+		reason := "error"
+		keyvals := []interface{}{"msg", "retrying delivery", "route", RouteFromContext(ctx), "attempt", attempt + 1}
+		if err != nil {
+			keyvals = append(keyvals, "err", err)
+		} else {
+			reason = strconv.Itoa(resp.StatusCode)
+			keyvals = append(keyvals, "status", resp.StatusCode)
+		}
+		level.Warn(requestid.Logger(ctx, logger)).Log(keyvals...)
+		deliveryRetriesTotal.WithLabelValues(routeLabels(ctx, reason)...).Inc()
+		return true, nil
+	}
+}
+
+func (p RetryPolicy) retryOn(status int) bool {
+	for _, s := range p.RetryOn {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff waits for the Retry-After header of 429 and 503 responses,
+// or exponentially between min and max, with jitter if enabled.
+func (p RetryPolicy) backoff(min, max time.Duration, attempt int, resp *http.Response) time.Duration {
+	if !p.IgnoreRetryAfter && resp != nil &&
+		(resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+
+	wait := retryablehttp.DefaultBackoff(min, max, attempt, nil)
+	if p.Jitter && wait > min {
+		wait = min + rand.N(wait-min+1) //nolint:gosec
+	}
+	return wait
+}
+
+// retryAfter parses a Retry-After header in seconds or as an HTTP date.
+func retryAfter(h string) (time.Duration, bool) {
+	if h == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(h); err == nil {
+		if s < 0 {
+			return 0, false
+		}
+		return time.Duration(s) * time.Second, true
+	}
+	t, err := http.ParseTime(h)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Until(t); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// deadlineService bounds the delivery of a notification.
+type deadlineService struct {
+	deadline time.Duration
+	next     Service
+}
+
+// NewDeadlineService creates a Service cancelling the delivery by next after the deadline,
+// so retries do not outlive the webhook timeout of Alertmanager. It returns next if the deadline is 0.
+func NewDeadlineService(deadline time.Duration, next Service) Service {
+	if deadline <= 0 {
+		return next
+	}
+	return deadlineService{deadline, next}
+}
+
+func (s deadlineService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.deadline)
+	defer cancel()
+	return s.next.Post(ctx, wm)
+}
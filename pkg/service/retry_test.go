@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewRetryClient(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		statuses     []int
+		wantRequests int
+		wantStatus   int
+		wantErr      bool
+	}{
+		{
+			name:         "retries 429 with Retry-After",
+			policy:       RetryPolicy{Max: 3},
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 2,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "does not retry 400",
+			policy:       RetryPolicy{Max: 3},
+			statuses:     []int{http.StatusBadRequest},
+			wantRequests: 1,
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "retries the configured statuses only",
+			policy:       RetryPolicy{Max: 3, RetryOn: []int{http.StatusBadGateway}},
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+			wantRequests: 2,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			name:         "gives up after max retries",
+			policy:       RetryPolicy{Max: 1},
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK},
+			wantRequests: 2,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				status := tt.statuses[requests]
+				requests++
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			tt.policy.WaitMin, tt.policy.WaitMax = time.Millisecond, time.Millisecond
+			client := NewRetryClient(log.NewNopLogger(), tt.policy, http.DefaultClient)
+			resp, err := client.Post(srv.URL, "application/json", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("want status %d, got %d", tt.wantStatus, resp.StatusCode)
+				}
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("want %d requests, got %d", tt.wantRequests, requests)
+			}
+		})
+	}
+}
+
+func TestNewRetryClient_metrics(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	const route = "/retry-test"
+	client := NewRetryClient(
+		log.NewNopLogger(),
+		RetryPolicy{Max: 3, WaitMin: time.Millisecond, WaitMax: time.Millisecond},
+		http.DefaultClient,
+	)
+	req, err := http.NewRequestWithContext(ContextWithRoute(context.Background(), route), http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got := testutil.ToFloat64(deliveryRetriesTotal.WithLabelValues(route, "", "503")); got != 2 {
+		t.Errorf("want 2 retries, got %v", got)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{}
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"7"}}}
+	if got := p.backoff(time.Second, 30*time.Second, 0, resp); got != 7*time.Second {
+		t.Errorf("want the Retry-After wait, got %s", got)
+	}
+	p.IgnoreRetryAfter = true
+	if got := p.backoff(time.Second, 30*time.Second, 2, resp); got != 4*time.Second {
+		t.Errorf("want the exponential wait, got %s", got)
+	}
+
+	p.Jitter = true
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(time.Second, 30*time.Second, 3, nil); got < time.Second || got > 8*time.Second {
+			t.Fatalf("want a wait between 1s and 8s, got %s", got)
+		}
+	}
+}
+
+type blockingService struct{}
+
+func (blockingService) Post(ctx context.Context, _ webhook.Message) ([]PostResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestNewDeadlineService(t *testing.T) {
+	s := NewDeadlineService(10*time.Millisecond, blockingService{})
+	if _, err := s.Post(context.Background(), webhook.Message{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+	if _, ok := NewDeadlineService(0, blockingService{}).(blockingService); !ok {
+		t.Fatal("want the next service without deadline")
+	}
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ScheduleAction is what happens to a message matching a ScheduleRule.
+type ScheduleAction string
+
+// Supported schedule actions.
+const (
+	// ScheduleDrop discards the message.
+	ScheduleDrop ScheduleAction = "drop"
+	// ScheduleDelay posts the message when the time window closes.
+	ScheduleDelay ScheduleAction = "delay"
+	// ScheduleReroute posts the message with the Reroute service instead.
+	ScheduleReroute ScheduleAction = "reroute"
+)
+
+// Limits of the delayed messages, they are kept in memory.
+const (
+	// DefaultScheduleMaxDelay is how long a message is delayed at most if its rule has no MaxDelay.
+	DefaultScheduleMaxDelay = 24 * time.Hour
+	// DefaultScheduleMaxPending is the number of messages a route delays at most, the messages above it are posted at once.
+	DefaultScheduleMaxPending = 1000
+)
+
+var scheduleDecisions = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "prometheus_msteams_schedule_decisions_total",
+		Help: "Number of messages dropped, delayed or rerouted by a schedule rule.",
+	},
+	[]string{"route", "tenant", "rule", "action"},
+)
+
+var scheduleDelayedDropped = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "prometheus_msteams_schedule_delayed_dropped_total",
+		Help: "Number of delayed messages dropped because the server stopped before they were posted.",
+	},
+	[]string{"route", "tenant", "rule"},
+)
+
+// HourRange is a time of day range, e.g. 22:00-07:00. A range ending before it starts spans midnight.
+type HourRange struct {
+	Start, End time.Duration
+}
+
+// ParseHourRange parses a range like "22:00-07:00".
+func ParseHourRange(s string) (HourRange, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return HourRange{}, fmt.Errorf("invalid hour range '%s', must be like '22:00-07:00'", s)
+	}
+	var r HourRange
+	for i, p := range parts {
+		hm := strings.Split(strings.TrimSpace(p), ":")
+		if len(hm) != 2 {
+			return HourRange{}, fmt.Errorf("invalid time '%s' in hour range '%s'", p, s)
+		}
+		h, errH := strconv.Atoi(hm[0])
+		m, errM := strconv.Atoi(hm[1])
+		if errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+			return HourRange{}, fmt.Errorf("invalid time '%s' in hour range '%s'", p, s)
+		}
+		d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+		if i == 0 {
+			r.Start = d
+		} else {
+			r.End = d
+		}
+	}
+	return r, nil
+}
+
+func (r HourRange) contains(sinceMidnight time.Duration) bool {
+	if r.Start <= r.End {
+		return sinceMidnight >= r.Start && sinceMidnight < r.End
+	}
+	return sinceMidnight >= r.Start || sinceMidnight < r.End
+}
+
+// TimeWindow is a recurring time window in a timezone. Empty Weekdays or Hours mean every day or the whole day.
+// The weekday of a range spanning midnight is the day it starts.
+type TimeWindow struct {
+	Location *time.Location
+	Weekdays []time.Weekday
+	Hours    []HourRange
+}
+
+// Contains reports whether t is in the window.
+func (w TimeWindow) Contains(t time.Time) bool {
+	if w.Location != nil {
+		t = t.In(w.Location)
+	}
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	if len(w.Hours) == 0 {
+		return w.onDay(t.Weekday())
+	}
+	for _, r := range w.Hours {
+		day := t.Weekday()
+		if r.Start > r.End && sinceMidnight < r.End {
+			// Early morning part of a range which started the day before.
+			day = (day + 6) % 7
+		}
+		if r.contains(sinceMidnight) && w.onDay(day) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w TimeWindow) onDay(d time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, wd := range w.Weekdays {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// end returns the first minute after t which is outside the window.
+func (w TimeWindow) end(t time.Time) time.Time {
+	end := t.Truncate(time.Minute)
+	for i := 0; i < 8*24*60 && w.Contains(end); i++ {
+		end = end.Add(time.Minute)
+	}
+	return end
+}
+
+// ScheduleRule applies an action to messages matching its labels while its time window is open.
+type ScheduleRule struct {
+	Name   string
+	Window TimeWindow
+	// Matchers are regular expressions matching the whole value of the common labels.
+	Matchers map[string]*regexp.Regexp
+	Action   ScheduleAction
+	// Reroute is the service used by the reroute action.
+	Reroute Service
+	// MaxDelay bounds the delay action, the message is posted after it even if the window is still open.
+	// DefaultScheduleMaxDelay if 0.
+	MaxDelay time.Duration
+}
+
+func (r ScheduleRule) matches(wm webhook.Message) bool {
+	for name, re := range r.Matchers {
+		var v string
+		if wm.Data != nil {
+			v = wm.CommonLabels[name]
+		}
+		if !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// scheduleService applies the first matching schedule rule to the messages.
+type scheduleService struct {
+	logger     log.Logger
+	rules      []ScheduleRule
+	next       Service
+	now        func() time.Time
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[*delayedMessage]struct{}
+}
+
+// delayedMessage is a message waiting for the end of the window of its rule.
+type delayedMessage struct {
+	// labels are the route, tenant and rule label values of the message.
+	labels []string
+	logger log.Logger
+	timer  *time.Timer
+}
+
+// NewScheduleService creates a Service which drops, delays or reroutes the messages
+// matching a rule whose time window is open. Other messages are posted with next.
+// The delayed messages are kept in memory, Flush drops them.
+func NewScheduleService(logger log.Logger, rules []ScheduleRule, next Service) Service {
+	if len(rules) == 0 {
+		return next
+	}
+	return &scheduleService{
+		logger:     logger,
+		rules:      rules,
+		next:       next,
+		now:        time.Now,
+		maxPending: DefaultScheduleMaxPending,
+		pending:    map[*delayedMessage]struct{}{},
+	}
+}
+
+func (s *scheduleService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	ctx, span := tracer.Start(ctx, "scheduleService.Post")
+	defer span.End()
+
+	now := s.now()
+	for _, r := range s.rules {
+		if !r.Window.Contains(now) || !r.matches(wm) {
+			continue
+		}
+
+		scheduleDecisions.WithLabelValues(routeLabels(ctx, r.Name, string(r.Action))...).Inc()
+		logger := log.With(requestid.Logger(ctx, s.logger), "schedule_rule", r.Name, "action", r.Action)
+
+		switch r.Action {
+		case ScheduleDrop:
+			level.Info(logger).Log("msg", "message dropped by schedule")
+			return []PostResponse{}, nil
+		case ScheduleDelay:
+			until := r.Window.end(now)
+			maxDelay := r.MaxDelay
+			if maxDelay <= 0 {
+				maxDelay = DefaultScheduleMaxDelay
+			}
+			if until.Sub(now) > maxDelay {
+				until = now.Add(maxDelay)
+			}
+			if !s.delay(ctx, logger, r.Name, until.Sub(now), wm) {
+				level.Warn(logger).Log("msg", "too many delayed messages, message posted at once", "max_pending", s.maxPending)
+				return s.next.Post(ctx, wm)
+			}
+			level.Info(logger).Log("msg", "message delayed by schedule", "until", until)
+			return []PostResponse{}, nil
+		case ScheduleReroute:
+			level.Info(logger).Log("msg", "message rerouted by schedule")
+			return r.Reroute.Post(ctx, wm)
+		}
+	}
+	return s.next.Post(ctx, wm)
+}
+
+// delay posts the message with next after d, false if the route delays too many messages already.
+func (s *scheduleService) delay(ctx context.Context, logger log.Logger, rule string, d time.Duration, wm webhook.Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) >= s.maxPending {
+		return false
+	}
+
+	dm := &delayedMessage{labels: routeLabels(ctx, rule), logger: logger}
+	delayedCtx := context.WithoutCancel(ctx)
+	dm.timer = time.AfterFunc(d, func() {
+		s.mu.Lock()
+		_, ok := s.pending[dm]
+		delete(s.pending, dm)
+		s.mu.Unlock()
+		if !ok {
+			// Dropped by Flush.
+			return
+		}
+		if _, err := s.next.Post(delayedCtx, wm); err != nil {
+			level.Error(logger).Log("msg", "failed to post delayed message", "err", err)
+		}
+	})
+	s.pending[dm] = struct{}{}
+	return true
+}
+
+// Flush drops the delayed messages when the server stops, each is logged and counted.
+// They are not posted since their window is still open.
+func (s *scheduleService) Flush(context.Context) {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = map[*delayedMessage]struct{}{}
+	s.mu.Unlock()
+
+	for dm := range pending {
+		dm.timer.Stop()
+		scheduleDelayedDropped.WithLabelValues(dm.labels...).Inc()
+		level.Warn(dm.logger).Log("msg", "delayed message dropped at shutdown")
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTimeWindow_Contains(t *testing.T) {
+	nights, err := ParseHourRange("22:00-07:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := TimeWindow{Location: berlin, Weekdays: []time.Weekday{time.Friday}, Hours: []HourRange{nights}}
+
+	tests := []struct {
+		at   string
+		want bool
+	}{
+		{at: "2024-03-08T21:30:00+01:00", want: false}, // Friday evening.
+		{at: "2024-03-08T22:00:00+01:00", want: true},  // Friday night.
+		{at: "2024-03-08T21:30:00Z", want: true},       // Friday 22:30 in Berlin.
+		{at: "2024-03-09T06:59:00+01:00", want: true},  // Saturday morning, the range started on Friday.
+		{at: "2024-03-09T07:00:00+01:00", want: false}, // Saturday 07:00.
+		{at: "2024-03-09T23:00:00+01:00", want: false}, // Saturday night.
+		{at: "2024-03-08T06:00:00+01:00", want: false}, // Friday morning, the range started on Thursday.
+	}
+	for _, tt := range tests {
+		at, err := time.Parse(time.RFC3339, tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Contains(at); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	if end := w.end(mustParseTime(t, "2024-03-08T23:10:30+01:00")); !end.Equal(mustParseTime(t, "2024-03-09T07:00:00+01:00")) {
+		t.Errorf("end = %s, want 07:00 on Saturday", end)
+	}
+}
+
+func TestParseHourRange(t *testing.T) {
+	for _, s := range []string{"22:00", "25:00-07:00", "22:00-07:60", "a:00-07:00"} {
+		if _, err := ParseHourRange(s); err == nil {
+			t.Errorf("ParseHourRange(%q) want error", s)
+		}
+	}
+	r, err := ParseHourRange("00:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Start != 0 || r.End != 24*time.Hour {
+		t.Fatalf("unexpected range %+v", r)
+	}
+}
+
+func Test_scheduleService_Post(t *testing.T) {
+	always := TimeWindow{}
+	severity := map[string]*regexp.Regexp{"severity": regexp.MustCompile("^(?:info|warning)$")}
+
+	info := webhook.Message{Data: &template.Data{CommonLabels: template.KV{"severity": "info"}}}
+	critical := webhook.Message{Data: &template.Data{CommonLabels: template.KV{"severity": "critical"}}}
+
+	tests := []struct {
+		name        string
+		rule        ScheduleRule
+		message     webhook.Message
+		wantNext    int
+		wantReroute int
+	}{
+		{
+			name:     "drop matching",
+			rule:     ScheduleRule{Name: "quiet", Window: always, Matchers: severity, Action: ScheduleDrop},
+			message:  info,
+			wantNext: 0,
+		},
+		{
+			name:     "keep not matching",
+			rule:     ScheduleRule{Name: "quiet", Window: always, Matchers: severity, Action: ScheduleDrop},
+			message:  critical,
+			wantNext: 1,
+		},
+		{
+			name:     "keep outside of window",
+			rule:     ScheduleRule{Name: "quiet", Window: TimeWindow{Weekdays: []time.Weekday{time.Sunday}}, Action: ScheduleDrop},
+			message:  info,
+			wantNext: 1,
+		},
+		{
+			name:        "reroute",
+			rule:        ScheduleRule{Name: "quiet", Window: always, Matchers: severity, Action: ScheduleReroute},
+			message:     info,
+			wantReroute: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			next, reroute := &recordingService{}, &recordingService{}
+			tt.rule.Reroute = reroute
+			s := NewScheduleService(log.NewNopLogger(), []ScheduleRule{tt.rule}, next).(*scheduleService)
+			// A Monday.
+			s.now = func() time.Time { return mustParseTime(t, "2024-03-11T12:00:00Z") }
+
+			if _, err := s.Post(context.Background(), tt.message); err != nil {
+				t.Fatal(err)
+			}
+			if len(next.messages) != tt.wantNext || len(reroute.messages) != tt.wantReroute {
+				t.Fatalf("want %d posted and %d rerouted, got %d and %d",
+					tt.wantNext, tt.wantReroute, len(next.messages), len(reroute.messages))
+			}
+		})
+	}
+}
+
+func Test_scheduleService_delay(t *testing.T) {
+	next := &recordingService{}
+	rule := ScheduleRule{Name: "quiet", Action: ScheduleDelay, MaxDelay: time.Hour}
+	s := NewScheduleService(log.NewNopLogger(), []ScheduleRule{rule}, next).(*scheduleService)
+	s.maxPending = 1
+	msg := webhook.Message{Data: &template.Data{}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Post(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(next.messages) != 1 || len(s.pending) != 1 {
+		t.Fatalf("want 1 message delayed and 1 posted above the limit, got %d delayed and %d posted", len(s.pending), len(next.messages))
+	}
+
+	before := testutil.ToFloat64(scheduleDelayedDropped.WithLabelValues("", "", "quiet"))
+	s.Flush(context.Background())
+	if len(s.pending) != 0 {
+		t.Fatalf("want no delayed message after flush, got %d", len(s.pending))
+	}
+	if got := testutil.ToFloat64(scheduleDelayedDropped.WithLabelValues("", "", "quiet")) - before; got != 1 {
+		t.Fatalf("want 1 dropped message counted, got %v", got)
+	}
+}
+
+func Test_scheduleService_metrics(t *testing.T) {
+	rule := ScheduleRule{Name: "quiet", Action: ScheduleDrop}
+	s := NewInstrumentingService("/schedule-metrics", NewScheduleService(log.NewNopLogger(), []ScheduleRule{rule}, &recordingService{}))
+	ctx := ContextWithTenant(context.Background(), "team-a")
+
+	if _, err := s.Post(ctx, webhook.Message{Data: &template.Data{Status: "firing"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(notificationsReceived.WithLabelValues("/schedule-metrics", "team-a", "firing")); got != 1 {
+		t.Fatalf("want the dropped message counted as received, got %v", got)
+	}
+	if got := testutil.ToFloat64(scheduleDecisions.WithLabelValues("/schedule-metrics", "team-a", "quiet", "drop")); got != 1 {
+		t.Fatalf("want the decision counted by route and tenant, got %v", got)
+	}
+}
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
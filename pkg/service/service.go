@@ -10,18 +10,43 @@ import (
 
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
 	"github.com/prometheus/alertmanager/notify/webhook"
-	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/prometheus-msteams/prometheus-msteams/pkg/service")
+
 // WebhookType represents the type of Microsoft Teams webhook connector.
 type WebhookType string
 
 // Supported webhook types for Microsoft Teams connectors.
 const (
-	O365     WebhookType = "o365"
-	Workflow WebhookType = "microsoft-workflow"
+	O365         WebhookType = "o365"
+	Workflow     WebhookType = "microsoft-workflow"
+	BotFramework WebhookType = "bot-framework"
+)
+
+// Webhook types posting the JSON rendered by the template as is.
+const (
+	Slack      WebhookType = "slack"
+	Mattermost WebhookType = "mattermost"
+	Generic    WebhookType = "generic"
 )
 
+// ParseWebhookType parses the webhook type of a connector posting to a webhook URL.
+func ParseWebhookType(s string) (WebhookType, error) {
+	switch t := WebhookType(s); t {
+	case O365, Workflow, Slack, Mattermost, Generic:
+		return t, nil
+	}
+	return "", fmt.Errorf(
+		"invalid webhook type '%s', must be one of '%s', '%s', '%s', '%s' or '%s'",
+		s, O365, Workflow, Slack, Mattermost, Generic,
+	)
+}
+
 // PostResponse is the prometheus msteams service response.
 type PostResponse struct {
 	WebhookURL string `json:"webhook_url"`
@@ -34,6 +59,12 @@ type Service interface {
 	Post(context.Context, webhook.Message) (resp []PostResponse, err error)
 }
 
+// Flusher is implemented by the services keeping messages in memory, e.g. a digest.
+// Flush handles the pending messages before the server stops, within the deadline of ctx.
+type Flusher interface {
+	Flush(ctx context.Context)
+}
+
 type simpleService struct {
 	converter   card.Converter
 	client      *http.Client
@@ -47,7 +78,9 @@ func NewSimpleService(converter card.Converter, client *http.Client, webhookURL
 }
 
 func (s simpleService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
-	ctx, span := trace.StartSpan(ctx, "simpleService.Post")
+	ctx, span := tracer.Start(ctx, "simpleService.Post",
+		trace.WithAttributes(attribute.String("webhook.type", string(s.webhookType))),
+	)
 	defer span.End()
 
 	switch s.webhookType {
@@ -55,6 +88,8 @@ func (s simpleService) Post(ctx context.Context, wm webhook.Message) ([]PostResp
 		return s.postO365Webhook(ctx, wm)
 	case Workflow:
 		return s.postWorkflowWebhook(ctx, wm)
+	case Slack, Mattermost, Generic:
+		return s.postRawWebhook(ctx, wm)
 	}
 
 	return nil, fmt.Errorf("unhandled webhookType: %s", s.webhookType)
@@ -63,16 +98,23 @@ func (s simpleService) Post(ctx context.Context, wm webhook.Message) ([]PostResp
 func (s simpleService) postO365Webhook(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
 	prs := []PostResponse{}
 
-	c, err := s.converter.Convert(ctx, wm)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse webhook message: %w", err)
-	}
-
-	// Split into multiple messages if necessary.
-	cc, err := splitOffice365Card(c)
+	// Split into multiple messages if necessary, graphs are left out of a section too large to be split.
+	var cc []card.Office365ConnectorCard
+	err := fitGraphs(ctx, wm, maxOffice365CardSize, func(ctx context.Context) (int, error) {
+		c, err := s.converter.Convert(ctx, wm)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse webhook message: %w", err)
+		}
+		if cc, err = splitOffice365Card(c); err != nil {
+			return 0, fmt.Errorf("failed to split Office 365 Card: %w", err)
+		}
+		return maxCardSize(cc)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to split Office 365 Card: %w", err)
+		return nil, err
 	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("card.count", len(cc)))
+	cardSplits.WithLabelValues(routeLabels(ctx)...).Observe(float64(len(cc)))
 
 	// TODO(@bzon): post concurrently.
 	for _, c := range cc {
@@ -88,9 +130,17 @@ func (s simpleService) postO365Webhook(ctx context.Context, wm webhook.Message)
 func (s simpleService) postWorkflowWebhook(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
 	prs := []PostResponse{}
 
-	c, err := s.converter.ConvertWorkflow(ctx, wm)
+	var c card.WorkflowConnectorCard
+	err := fitGraphs(ctx, wm, maxAdaptiveCardSize, func(ctx context.Context) (int, error) {
+		var err error
+		if c, err = s.converter.ConvertWorkflow(ctx, wm); err != nil {
+			return 0, fmt.Errorf("failed to parse webhook message: %w", err)
+		}
+		b, err := json.Marshal(c)
+		return len(b), err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse webhook message: %w", err)
+		return nil, err
 	}
 
 	_, err = s.post(ctx, c, s.webhookURL)
@@ -101,17 +151,33 @@ func (s simpleService) postWorkflowWebhook(ctx context.Context, wm webhook.Messa
 	return prs, nil
 }
 
-func (s simpleService) post(ctx context.Context, c interface{}, url string) (PostResponse, error) {
-	ctx, span := trace.StartSpan(ctx, "simpleService.post")
-	defer span.End()
+// postRawWebhook posts the output of the template as is.
+func (s simpleService) postRawWebhook(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	c, err := s.converter.ConvertRaw(ctx, wm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook message: %w", err)
+	}
+
+	pr, err := s.post(ctx, c, s.webhookURL)
+	return []PostResponse{pr}, err
+}
+
+func (s simpleService) post(ctx context.Context, c interface{}, url string) (pr PostResponse, err error) {
+	ctx, span := tracer.Start(ctx, "simpleService.post")
+	defer func() { endSpan(span, pr.Status, err) }()
 
-	pr := PostResponse{WebhookURL: url}
+	pr = PostResponse{WebhookURL: url}
 
 	b, err := json.Marshal(c)
 	if err != nil {
 		err = fmt.Errorf("failed to decoding JSON card: %w", err)
 		return pr, err
 	}
+	span.SetAttributes(attribute.Int("card.size_bytes", len(b)))
+	cardSize.WithLabelValues(routeLabels(ctx)...).Observe(float64(len(b)))
+
+	ctx, d := withDelivery(ctx)
+	defer func() { observeDelivery(ctx, d, pr.Status, err) }()
 
 	req, err := http.NewRequestWithContext(ctx, "POST", s.webhookURL, bytes.NewBuffer(b))
 	if err != nil {
@@ -140,11 +206,26 @@ func (s simpleService) post(ctx context.Context, c interface{}, url string) (Pos
 	return pr, nil
 }
 
+// endSpan records the response status and the error of a delivery, then ends the span.
+func endSpan(span trace.Span, status int, err error) {
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case status >= http.StatusBadRequest:
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
 // splitOffice365Card splits a single Office365ConnectorCard into multiple Office365ConnectorCard.
 // The purpose of doing this is to prevent getting limited by Microsoft Teams API when sending a large JSON payload.
 func splitOffice365Card(c card.Office365ConnectorCard) ([]card.Office365ConnectorCard, error) {
 	// Maximum message size of 14336 Bytes (14KB)
-	const maxSize = 14336
+	const maxSize = maxOffice365CardSize
 	// Maximum number of sections
 	// ref: https://docs.microsoft.com/en-us/microsoftteams/platform/concepts/cards/cards-reference#notes-on-the-office-365-connector-card
 	const maxCardSections = 10
@@ -175,19 +256,24 @@ func splitOffice365Card(c card.Office365ConnectorCard) ([]card.Office365Connecto
 				continue
 			}
 
-			// marshal cards in order to get the byte size
+			if len(newCard.Sections) >= maxCardSections {
+				break
+			}
+
+			// marshal cards with the section in order to get the byte size
+			sections := newCard.Sections
+			newCard.Sections = append(sections[:len(sections):len(sections)], s)
 			newCardb, err := json.Marshal(newCard)
 			if err != nil {
 				return nil, err
 			}
 
-			// If the max length or size has exceeded the limit,
-			// break the loop so we can create a new card again.
-			if (len(newCard.Sections) >= maxCardSections) || (len(newCardb) >= maxSize) {
+			// If the size would exceed the limit, break the loop so we can create a new card again.
+			// A section too large on its own gets a card of its own.
+			if len(newCardb) >= maxSize && len(sections) > 0 {
+				newCard.Sections = sections
 				break
 			}
-
-			newCard.Sections = append(newCard.Sections, s)
 			indexAdded[i] = true
 		}
 
@@ -196,3 +282,18 @@ func splitOffice365Card(c card.Office365ConnectorCard) ([]card.Office365Connecto
 
 	return cards, nil
 }
+
+// maxCardSize returns the size of the largest card.
+func maxCardSize(cc []card.Office365ConnectorCard) (int, error) {
+	size := 0
+	for _, c := range cc {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return 0, err
+		}
+		if len(b) > size {
+			size = len(b)
+		}
+	}
+	return size, nil
+}
@@ -1,10 +1,19 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/testutils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 const (
@@ -137,3 +146,101 @@ func Test_splitOffice365Card(t *testing.T) {
 		})
 	}
 }
+
+func Test_simpleService_Post_spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	tmpl, err := card.ParseTemplateFile("../../default-message-card.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm, err := testutils.ParseWebhookJSONFromFile("../card/testdata/prom_post_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	s := NewSimpleService(card.NewTemplatedCardCreator(tmpl, false), srv.Client(), srv.URL, O365)
+	if _, err := s.Post(context.Background(), wm); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := map[string]map[attribute.Key]attribute.Value{}
+	for _, span := range recorder.Ended() {
+		attrs[span.Name()] = map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes() {
+			attrs[span.Name()][kv.Key] = kv.Value
+		}
+	}
+	if got := attrs["simpleService.Post"]["webhook.type"].AsString(); got != string(O365) {
+		t.Errorf("want webhook.type %q, got %q", O365, got)
+	}
+	if got := attrs["simpleService.Post"]["card.count"].AsInt64(); got != 1 {
+		t.Errorf("want card.count 1, got %d", got)
+	}
+	if got := attrs["simpleService.post"]["card.size_bytes"].AsInt64(); got == 0 {
+		t.Error("want card.size_bytes")
+	}
+	if got := attrs["simpleService.post"]["http.response.status_code"].AsInt64(); got != http.StatusTooManyRequests {
+		t.Errorf("want http.response.status_code %d, got %d", http.StatusTooManyRequests, got)
+	}
+}
+
+func Test_simpleService_Post_raw(t *testing.T) {
+	wm, err := testutils.ParseWebhookJSONFromFile("../card/testdata/prom_post_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		webhookType WebhookType
+		template    string
+		// field is a top-level member the posted JSON must have.
+		field string
+	}{
+		{Slack, "../../examples/templates/slack-message.tmpl", "blocks"},
+		{Mattermost, "../../examples/templates/mattermost-message.tmpl", "attachments"},
+		{Generic, "../../examples/templates/generic-json.tmpl", "alerts"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.webhookType), func(t *testing.T) {
+			var got map[string]json.RawMessage
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("invalid JSON posted: %v", err)
+				}
+				_, _ = w.Write([]byte("ok"))
+			}))
+			defer srv.Close()
+
+			tmpl, err := card.ParseTemplateFile(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewSimpleService(card.NewTemplatedCardCreator(tmpl, false), srv.Client(), srv.URL, tt.webhookType)
+			prs, err := s.Post(context.Background(), wm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(prs) != 1 || prs[0].Status != http.StatusOK || prs[0].Message != "ok" {
+				t.Fatalf("unexpected responses %+v", prs)
+			}
+			if _, ok := got[tt.field]; !ok {
+				t.Fatalf("want the %s field, got %v", tt.field, got)
+			}
+		})
+	}
+}
+
+func TestParseWebhookType(t *testing.T) {
+	if got, err := ParseWebhookType("slack"); err != nil || got != Slack {
+		t.Fatalf("want %s, got %s, %v", Slack, got, err)
+	}
+	if _, err := ParseWebhookType("bot-framework"); err == nil {
+		t.Fatal("want an error for a type without webhook URL")
+	}
+}
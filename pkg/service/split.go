@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SplitMode decides how many Teams messages are posted for an Alertmanager group.
+type SplitMode string
+
+// Supported split modes, SplitByLabelPrefix is followed by a label name, e.g. "by_label:instance".
+const (
+	SplitGroup         SplitMode = "group"
+	SplitAlert         SplitMode = "alert"
+	SplitByLabelPrefix           = "by_label:"
+)
+
+// ParseSplitMode validates a split mode. An empty string is the "group" mode.
+func ParseSplitMode(s string) (SplitMode, error) {
+	switch m := SplitMode(s); {
+	case s == "":
+		return SplitGroup, nil
+	case m == SplitGroup, m == SplitAlert:
+		return m, nil
+	case strings.HasPrefix(s, SplitByLabelPrefix) && len(s) > len(SplitByLabelPrefix):
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid split_mode '%s', must be 'group', 'alert' or '%s<label>'", s, SplitByLabelPrefix)
+}
+
+// label returns the label name of a "by_label:" mode.
+func (m SplitMode) label() (string, bool) {
+	if !strings.HasPrefix(string(m), SplitByLabelPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(string(m), SplitByLabelPrefix), true
+}
+
+// splittingService posts one message per alert or per label value instead of one per group.
+type splittingService struct {
+	mode SplitMode
+	next Service
+}
+
+// NewSplittingService creates a Service which splits the Alertmanager group into smaller messages
+// and posts each of them with next, so every message is rendered with the alerts of its subset only.
+func NewSplittingService(mode SplitMode, next Service) Service {
+	if mode == SplitGroup || mode == "" {
+		return next
+	}
+	return splittingService{mode, next}
+}
+
+func (s splittingService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	ctx, span := tracer.Start(ctx, "splittingService.Post")
+	defer span.End()
+
+	messages := splitMessage(wm, s.mode)
+	span.SetAttributes(attribute.Int("split.count", len(messages)))
+	splitMessages.WithLabelValues(routeLabels(ctx)...).Observe(float64(len(messages)))
+
+	prs := []PostResponse{}
+	for _, m := range messages {
+		pr, err := s.next.Post(ctx, m)
+		prs = append(prs, pr...)
+		if err != nil {
+			return prs, err
+		}
+	}
+	return prs, nil
+}
+
+// splitMessage partitions the alerts of the message according to the mode,
+// keeping the order in which the alerts or label values first appear.
+func splitMessage(wm webhook.Message, mode SplitMode) []webhook.Message {
+	if wm.Data == nil || len(wm.Alerts) == 0 {
+		return []webhook.Message{wm}
+	}
+
+	var partitions []template.Alerts
+	label, byLabel := mode.label()
+	switch {
+	case mode == SplitAlert:
+		for _, a := range wm.Alerts {
+			partitions = append(partitions, template.Alerts{a})
+		}
+	case byLabel:
+		index := map[string]int{}
+		for _, a := range wm.Alerts {
+			v := a.Labels[label]
+			i, ok := index[v]
+			if !ok {
+				i = len(partitions)
+				index[v] = i
+				partitions = append(partitions, nil)
+			}
+			partitions[i] = append(partitions[i], a)
+		}
+	default:
+		return []webhook.Message{wm}
+	}
+
+	messages := make([]webhook.Message, 0, len(partitions))
+	for _, alerts := range partitions {
+		m := wm
+		m.Data = subData(wm.Data, alerts)
+		if byLabel {
+			m.GroupLabels = copyKV(m.GroupLabels)
+			m.GroupLabels[label] = alerts[0].Labels[label]
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// subData returns the template data of a subset of the alerts
+// with the status, common labels and common annotations of the subset.
+func subData(d *template.Data, alerts template.Alerts) *template.Data {
+	sub := *d
+	sub.Alerts = alerts
+	sub.GroupLabels = copyKV(d.GroupLabels)
+	sub.Status = "resolved"
+	if len(alerts.Firing()) > 0 {
+		sub.Status = "firing"
+	}
+	labels := make([]template.KV, 0, len(alerts))
+	annotations := make([]template.KV, 0, len(alerts))
+	for _, a := range alerts {
+		labels = append(labels, a.Labels)
+		annotations = append(annotations, a.Annotations)
+	}
+	sub.CommonLabels = commonKV(labels)
+	sub.CommonAnnotations = commonKV(annotations)
+	return &sub
+}
+
+// commonKV returns the pairs which all KVs have with the same value.
+func commonKV(kvs []template.KV) template.KV {
+	if len(kvs) == 0 {
+		return template.KV{}
+	}
+	common := copyKV(kvs[0])
+	for _, other := range kvs[1:] {
+		for k, v := range common {
+			if ov, ok := other[k]; !ok || ov != v {
+				delete(common, k)
+			}
+		}
+	}
+	return common
+}
+
+func copyKV(kv template.KV) template.KV {
+	c := make(template.KV, len(kv))
+	for k, v := range kv {
+		c[k] = v
+	}
+	return c
+}
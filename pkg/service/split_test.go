@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+type recordingService struct {
+	messages []webhook.Message
+}
+
+func (s *recordingService) Post(_ context.Context, wm webhook.Message) ([]PostResponse, error) {
+	s.messages = append(s.messages, wm)
+	return []PostResponse{{Status: 200}}, nil
+}
+
+func testSplitMessage() webhook.Message {
+	return webhook.Message{
+		Data: &template.Data{
+			Status:       "firing",
+			GroupLabels:  template.KV{"alertname": "HighLoad"},
+			CommonLabels: template.KV{"alertname": "HighLoad"},
+			Alerts: template.Alerts{
+				{
+					Status:      "firing",
+					Labels:      template.KV{"alertname": "HighLoad", "instance": "a", "team": "db"},
+					Annotations: template.KV{"summary": "load on a"},
+				},
+				{
+					Status:      "resolved",
+					Labels:      template.KV{"alertname": "HighLoad", "instance": "b", "team": "web"},
+					Annotations: template.KV{"summary": "load on b"},
+				},
+				{
+					Status:      "resolved",
+					Labels:      template.KV{"alertname": "HighLoad", "instance": "c", "team": "db"},
+					Annotations: template.KV{"summary": "load on c"},
+				},
+			},
+		},
+		GroupKey: "{}:{alertname=\"HighLoad\"}",
+	}
+}
+
+func Test_splittingService_Post(t *testing.T) {
+	type subset struct {
+		Status            string
+		Instances         []string
+		GroupLabels       template.KV
+		CommonLabels      template.KV
+		CommonAnnotations template.KV
+	}
+	tests := []struct {
+		name string
+		mode SplitMode
+		want []subset
+	}{
+		{
+			name: "group",
+			mode: SplitGroup,
+			want: []subset{
+				{
+					Status:       "firing",
+					Instances:    []string{"a", "b", "c"},
+					GroupLabels:  template.KV{"alertname": "HighLoad"},
+					CommonLabels: template.KV{"alertname": "HighLoad"},
+				},
+			},
+		},
+		{
+			name: "alert",
+			mode: SplitAlert,
+			want: []subset{
+				{
+					Status:            "firing",
+					Instances:         []string{"a"},
+					GroupLabels:       template.KV{"alertname": "HighLoad"},
+					CommonLabels:      template.KV{"alertname": "HighLoad", "instance": "a", "team": "db"},
+					CommonAnnotations: template.KV{"summary": "load on a"},
+				},
+				{
+					Status:            "resolved",
+					Instances:         []string{"b"},
+					GroupLabels:       template.KV{"alertname": "HighLoad"},
+					CommonLabels:      template.KV{"alertname": "HighLoad", "instance": "b", "team": "web"},
+					CommonAnnotations: template.KV{"summary": "load on b"},
+				},
+				{
+					Status:            "resolved",
+					Instances:         []string{"c"},
+					GroupLabels:       template.KV{"alertname": "HighLoad"},
+					CommonLabels:      template.KV{"alertname": "HighLoad", "instance": "c", "team": "db"},
+					CommonAnnotations: template.KV{"summary": "load on c"},
+				},
+			},
+		},
+		{
+			name: "by label",
+			mode: SplitByLabelPrefix + "team",
+			want: []subset{
+				{
+					Status:            "firing",
+					Instances:         []string{"a", "c"},
+					GroupLabels:       template.KV{"alertname": "HighLoad", "team": "db"},
+					CommonLabels:      template.KV{"alertname": "HighLoad", "team": "db"},
+					CommonAnnotations: template.KV{},
+				},
+				{
+					Status:            "resolved",
+					Instances:         []string{"b"},
+					GroupLabels:       template.KV{"alertname": "HighLoad", "team": "web"},
+					CommonLabels:      template.KV{"alertname": "HighLoad", "instance": "b", "team": "web"},
+					CommonAnnotations: template.KV{"summary": "load on b"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			wm := testSplitMessage()
+			next := &recordingService{}
+
+			prs, err := NewSplittingService(tt.mode, next).Post(context.Background(), wm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(prs) != len(tt.want) {
+				t.Fatalf("want %d responses, got %d", len(tt.want), len(prs))
+			}
+
+			var got []subset
+			for _, m := range next.messages {
+				s := subset{
+					Status:            m.Status,
+					GroupLabels:       m.GroupLabels,
+					CommonLabels:      m.CommonLabels,
+					CommonAnnotations: m.CommonAnnotations,
+				}
+				for _, a := range m.Alerts {
+					s.Instances = append(s.Instances, a.Labels["instance"])
+				}
+				got = append(got, s)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("mismatch (-want +got):\n%s", diff)
+			}
+
+			// The original message must not be modified.
+			if diff := cmp.Diff(testSplitMessage(), wm); diff != "" {
+				t.Fatalf("message was modified (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSplitMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SplitMode
+		wantErr bool
+	}{
+		{in: "", want: SplitGroup},
+		{in: "group", want: SplitGroup},
+		{in: "alert", want: SplitAlert},
+		{in: "by_label:instance", want: "by_label:instance"},
+		{in: "by_label:", wantErr: true},
+		{in: "instance", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSplitMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSplitMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSplitMode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
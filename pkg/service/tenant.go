@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned for the notifications above the rate limit of their tenant.
+var ErrRateLimited = errors.New("the rate limit of the tenant is exceeded")
+
+var rateLimited = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "prometheus_msteams_rate_limited_total",
+		Help: "Number of notifications rejected by the rate limit of their tenant.",
+	},
+	[]string{"tenant"},
+)
+
+// tenantService labels the metrics of the routes of a tenant and limits its notifications.
+type tenantService struct {
+	tenant  string
+	limiter *rate.Limiter
+	next    Service
+}
+
+// NewTenantService creates a Service labelling the metrics of next with the tenant.
+// The limiter is shared by the routes of the tenant, the notifications it does not allow
+// fail with ErrRateLimited. A nil limiter does not limit.
+func NewTenantService(tenant string, limiter *rate.Limiter, next Service) Service {
+	return tenantService{tenant, limiter, next}
+}
+
+func (s tenantService) Post(ctx context.Context, wm webhook.Message) ([]PostResponse, error) {
+	if s.limiter != nil && !s.limiter.Allow() {
+		rateLimited.WithLabelValues(s.tenant).Inc()
+		return nil, ErrRateLimited
+	}
+	return s.next.Post(ContextWithTenant(ctx, s.tenant), wm)
+}
@@ -0,0 +1,242 @@
+package silence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	amtemplate "github.com/prometheus/alertmanager/template"
+)
+
+// Path is the request path of the actions endpoint.
+const Path = "/actions/silence"
+
+// DefaultAckDuration is the duration of the silence created by the Ack button when none is configured.
+const DefaultAckDuration = 24 * time.Hour
+
+// createdBy is the author of the silences.
+const createdBy = "prometheus-msteams"
+
+// Actions renders the action URLs of the cards and serves the actions endpoint.
+type Actions struct {
+	logger      log.Logger
+	signer      *Signer
+	client      *Client
+	url         string
+	ackDuration time.Duration
+}
+
+// NewActions creates the silence actions. externalURL is the URL prometheus-msteams is reachable at from Teams,
+// ackDuration is the duration of the Ack silences, DefaultAckDuration if 0.
+func NewActions(logger log.Logger, signer *Signer, client *Client, externalURL string, ackDuration time.Duration) *Actions {
+	if ackDuration <= 0 {
+		ackDuration = DefaultAckDuration
+	}
+	return &Actions{
+		logger:      logger,
+		signer:      signer,
+		client:      client,
+		url:         strings.TrimSuffix(externalURL, "/") + Path,
+		ackDuration: ackDuration,
+	}
+}
+
+// Funcs returns the template functions rendering the action URLs:
+// `silenceActionURL .Labels "1h"` and `ackActionURL .Labels`.
+func (a *Actions) Funcs() amtemplate.FuncMap {
+	return amtemplate.FuncMap{
+		"silenceActionURL": a.silenceActionURL,
+		"ackActionURL":     a.ackActionURL,
+	}
+}
+
+func (a *Actions) silenceActionURL(labels amtemplate.KV, duration string) (string, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return "", err
+	}
+	if d <= 0 {
+		return "", fmt.Errorf("silenceActionURL: the duration must be positive")
+	}
+	return a.actionURL(labels, d, false)
+}
+
+func (a *Actions) ackActionURL(labels amtemplate.KV) (string, error) {
+	return a.actionURL(labels, a.ackDuration, true)
+}
+
+func (a *Actions) actionURL(labels amtemplate.KV, d time.Duration, ack bool) (string, error) {
+	if len(labels) == 0 {
+		return "", fmt.Errorf("a silence needs at least one label")
+	}
+	token, err := a.signer.Sign(labels, d, ack)
+	if err != nil {
+		return "", err
+	}
+	return a.url + "?token=" + url.QueryEscape(token), nil
+}
+
+// ServeHTTP shows a confirmation page on GET and creates the silence on POST.
+// The token is read from the query, a form or a JSON body like {"token": "..."}.
+func (a *Actions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, err := requestToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	action, err := a.signer.Verify(token)
+	if err != nil {
+		a.fail(w, r, action, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.render(w, http.StatusOK, pageData{Action: action, Token: token, Labels: EqualMatchers(action.Matchers)})
+	case http.MethodPost:
+		a.create(w, r, action)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *Actions) create(w http.ResponseWriter, r *http.Request, action Action) {
+	if err := a.signer.Use(action); err != nil {
+		a.fail(w, r, action, err)
+		return
+	}
+
+	comment := "Silenced from Microsoft Teams"
+	if action.Ack {
+		comment = "Acknowledged from Microsoft Teams"
+	}
+	now := time.Now()
+	id, err := a.client.Create(r.Context(), Silence{
+		Matchers:  EqualMatchers(action.Matchers),
+		StartsAt:  now,
+		EndsAt:    now.Add(action.Duration),
+		CreatedBy: createdBy,
+		Comment:   comment,
+	})
+	if err != nil {
+		a.signer.Release(action)
+		a.fail(w, r, action, err)
+		return
+	}
+
+	level.Info(a.logger).Log("msg", "silence created", "silence_id", id, "duration", action.Duration, "ack", action.Ack)
+	message := fmt.Sprintf("Silenced for %s", action.Duration)
+	if action.Ack {
+		message = fmt.Sprintf("Acknowledged for %s", action.Duration)
+	}
+	// Teams shows this header for HttpPOST actions of connector cards.
+	w.Header().Set("CARD-ACTION-STATUS", message)
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]string{"silenceID": id, "message": message})
+		return
+	}
+	a.render(w, http.StatusOK, pageData{Action: action, Labels: EqualMatchers(action.Matchers), SilenceID: id, Message: message})
+}
+
+func (a *Actions) fail(w http.ResponseWriter, r *http.Request, action Action, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrExpiredToken):
+		status = http.StatusGone
+	case errors.Is(err, ErrUsedToken):
+		status = http.StatusConflict
+	}
+	level.Warn(a.logger).Log("msg", "silence action failed", "status", status, "err", err)
+
+	w.Header().Set("CARD-ACTION-STATUS", err.Error())
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	a.render(w, status, pageData{Action: action, Labels: EqualMatchers(action.Matchers), Error: err.Error()})
+}
+
+// requestToken returns the token of the query, the form or the JSON body.
+func requestToken(r *http.Request) (string, error) {
+	if t := r.URL.Query().Get("token"); t != "" {
+		return t, nil
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&body); err == nil && body.Token != "" {
+			return body.Token, nil
+		}
+	} else if t := r.PostFormValue("token"); t != "" {
+		return t, nil
+	}
+	return "", fmt.Errorf("the action token is missing")
+}
+
+// wantsJSON reports whether the request is a JSON or card action rather than a browser.
+func wantsJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type pageData struct {
+	Action    Action
+	Labels    []Matcher
+	Token     string
+	SilenceID string
+	Message   string
+	Error     string
+}
+
+func (a *Actions) render(w http.ResponseWriter, status int, d pageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := page.Execute(w, d); err != nil {
+		level.Error(a.logger).Log("msg", "failed to render the silence page", "err", err)
+	}
+}
+
+var page = template.Must(template.New("silence").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>prometheus-msteams</title></head>
+<body>
+{{- if .Error }}
+<h1>{{ .Error }}</h1>
+{{- else if .SilenceID }}
+<h1>{{ .Message }}</h1>
+<p>Silence {{ .SilenceID }} was created.</p>
+{{- else }}
+<h1>{{ if .Action.Ack }}Acknowledge{{ else }}Silence{{ end }} for {{ .Action.Duration }}?</h1>
+<form method="post">
+<input type="hidden" name="token" value="{{ .Token }}">
+<button type="submit">{{ if .Action.Ack }}Acknowledge{{ else }}Silence{{ end }}</button>
+</form>
+{{- end }}
+{{- with .Labels }}
+<ul>
+{{- range . }}
+<li>{{ .Name }}="{{ .Value }}"</li>
+{{- end }}
+</ul>
+{{- end }}
+</body>
+</html>
+`))
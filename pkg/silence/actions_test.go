@@ -0,0 +1,307 @@
+package silence
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/card"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// fakeAlertmanager records the silences posted to the v2 API.
+type fakeAlertmanager struct {
+	silences []Silence
+	status   int
+}
+
+func (f *fakeAlertmanager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v2/silences" {
+		http.NotFound(w, r)
+		return
+	}
+	if f.status != 0 {
+		http.Error(w, "unavailable", f.status)
+		return
+	}
+	var s Silence
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.silences = append(f.silences, s)
+	_ = json.NewEncoder(w).Encode(map[string]string{"silenceID": "silence-1"})
+}
+
+func newTestActions(t *testing.T) (*Actions, *fakeAlertmanager) {
+	t.Helper()
+	am := &fakeAlertmanager{}
+	srv := httptest.NewServer(am)
+	t.Cleanup(srv.Close)
+
+	signer, err := NewSigner([]byte("0123456789abcdef"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewActions(log.NewNopLogger(), signer, NewClient(srv.Client(), srv.URL), "https://msteams.example.com/", 0)
+	return a, am
+}
+
+func actionToken(t *testing.T, rawURL string) string {
+	t.Helper()
+	if !strings.HasPrefix(rawURL, "https://msteams.example.com"+Path+"?token=") {
+		t.Fatalf("unexpected action url %s", rawURL)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("token")
+}
+
+func TestActionsSilence(t *testing.T) {
+	a, am := newTestActions(t)
+	silenceURL := a.Funcs()["silenceActionURL"].(func(template.KV, string) (string, error))
+
+	u, err := silenceURL(template.KV{"alertname": "HighLoad", "job": "node"}, "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := actionToken(t, u)
+
+	// GET only shows the confirmation page.
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path+"?token="+url.QueryEscape(token), nil))
+	if rec.Code != http.StatusOK || len(am.silences) != 0 {
+		t.Fatalf("unexpected GET response %d with %d silences", rec.Code, len(am.silences))
+	}
+	if !strings.Contains(rec.Body.String(), `name="token"`) {
+		t.Fatalf("the confirmation page has no form:\n%s", rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(`{"token": "`+token+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("CARD-ACTION-STATUS"); got != "Silenced for 1h0m0s" {
+		t.Fatalf("unexpected card action status %q", got)
+	}
+
+	if len(am.silences) != 1 {
+		t.Fatalf("want 1 silence, got %d", len(am.silences))
+	}
+	s := am.silences[0]
+	want := []Matcher{
+		{Name: "alertname", Value: "HighLoad", IsEqual: true},
+		{Name: "job", Value: "node", IsEqual: true},
+	}
+	if diff := cmp.Diff(want, s.Matchers); diff != "" {
+		t.Fatalf("unexpected matchers (-want +got):\n%s", diff)
+	}
+	if s.EndsAt.Sub(s.StartsAt) != time.Hour || s.CreatedBy != createdBy {
+		t.Fatalf("unexpected silence %+v", s)
+	}
+
+	// A token creates one silence only.
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, Path+"?token="+url.QueryEscape(token), nil))
+	if rec.Code != http.StatusConflict || len(am.silences) != 1 {
+		t.Fatalf("want %d for a used token, got %d with %d silences", http.StatusConflict, rec.Code, len(am.silences))
+	}
+}
+
+func TestActionsAck(t *testing.T) {
+	a, am := newTestActions(t)
+	ackURL := a.Funcs()["ackActionURL"].(func(template.KV) (string, error))
+
+	u, err := ackURL(template.KV{"alertname": "HighLoad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{"token": {actionToken(t, u)}}
+	req := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(am.silences) != 1 || am.silences[0].Comment != "Acknowledged from Microsoft Teams" {
+		t.Fatalf("unexpected silences %+v", am.silences)
+	}
+	if d := am.silences[0].EndsAt.Sub(am.silences[0].StartsAt); d != DefaultAckDuration {
+		t.Fatalf("want an ack of %s, got %s", DefaultAckDuration, d)
+	}
+}
+
+func TestActionsErrors(t *testing.T) {
+	a, am := newTestActions(t)
+	silenceURL := a.Funcs()["silenceActionURL"].(func(template.KV, string) (string, error))
+
+	u, err := silenceURL(template.KV{"alertname": "HighLoad"}, "4h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := actionToken(t, u)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"missing token", Path, http.StatusBadRequest},
+		{"forged token", Path + "?token=" + url.QueryEscape(token+"x"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			a.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("want %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+
+	// A failed silence can be retried.
+	am.status = http.StatusServiceUnavailable
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, Path+"?token="+url.QueryEscape(token), nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("want %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+	am.status = 0
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, Path+"?token="+url.QueryEscape(token), nil))
+	if rec.Code != http.StatusOK || len(am.silences) != 1 {
+		t.Fatalf("want a silence after the retry, got %d with %d silences", rec.Code, len(am.silences))
+	}
+
+	if _, err := silenceURL(template.KV{}, "1h"); err == nil {
+		t.Fatal("want an error without labels")
+	}
+	if _, err := silenceURL(template.KV{"a": "b"}, "soon"); err == nil {
+		t.Fatal("want an error for an invalid duration")
+	}
+}
+
+func TestActionsExampleTemplate(t *testing.T) {
+	type button struct {
+		Type  string `json:"type"`
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	}
+	tests := []struct {
+		template string
+		// buttons returns the URL of the buttons posting to the actions endpoint by name.
+		buttons func(t *testing.T, out []byte) map[string]string
+	}{
+		{
+			template: "../../examples/templates/card-with-silence-action.tmpl",
+			buttons: func(t *testing.T, out []byte) map[string]string {
+				var c struct {
+					PotentialAction []struct {
+						Type   string          `json:"@type"`
+						Name   string          `json:"name"`
+						Target json.RawMessage `json:"target"`
+					} `json:"potentialAction"`
+				}
+				if err := json.Unmarshal(out, &c); err != nil {
+					t.Fatalf("invalid card: %v\n%s", err, out)
+				}
+				urls := map[string]string{}
+				for _, pa := range c.PotentialAction {
+					var target string
+					if pa.Type == "HttpPOST" && json.Unmarshal(pa.Target, &target) == nil {
+						urls[pa.Name] = target
+					}
+				}
+				return urls
+			},
+		},
+		{
+			template: "../../examples/templates/workflow-card-with-silence-action.tmpl",
+			buttons: func(t *testing.T, out []byte) map[string]string {
+				var c struct {
+					Attachments []struct {
+						Content struct {
+							Actions []struct {
+								button
+								Fallback button `json:"fallback"`
+							} `json:"actions"`
+						} `json:"content"`
+					} `json:"attachments"`
+				}
+				if err := json.Unmarshal(out, &c); err != nil || len(c.Attachments) != 1 {
+					t.Fatalf("invalid card: %v\n%s", err, out)
+				}
+				urls := map[string]string{}
+				for _, a := range c.Attachments[0].Content.Actions {
+					if a.Type == "Action.Http" {
+						if a.Fallback.URL != a.URL {
+							t.Fatalf("want the fallback of %s to open the same URL", a.Title)
+						}
+						urls[a.Title] = a.URL
+					}
+				}
+				return urls
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			a, am := newTestActions(t)
+			tmpl, err := card.NewTemplateLoader().Funcs(a.Funcs()).Load(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The card shows the relabelled alert, the silences match the labels it was received with.
+			labels := template.KV{"alertname": "HighLoad", "severity": "warning", "instance": "node-1:9100"}
+			relabelled := template.KV{"alertname": "HighLoad", "severity": "warning"}
+			ctx := card.ContextWithOriginalLabels(context.Background(), card.OriginalLabels{"a1": labels})
+			out, err := card.NewTemplatedCardCreator(tmpl, false).ConvertRaw(ctx, webhook.Message{Data: &template.Data{
+				Status:       "firing",
+				Alerts:       template.Alerts{{Status: "firing", Fingerprint: "a1", Labels: relabelled, Annotations: template.KV{}}},
+				CommonLabels: relabelled,
+				ExternalURL:  "http://alertmanager:9093",
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			durations := map[string]time.Duration{"Silence 1h": time.Hour, "Silence 4h": 4 * time.Hour, "Ack": DefaultAckDuration}
+			buttons := tt.buttons(t, []byte(out))
+			if len(buttons) != len(durations) {
+				t.Fatalf("want the buttons %v, got %v", durations, buttons)
+			}
+			for name, u := range buttons {
+				action, err := a.signer.Verify(actionToken(t, u))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if action.Duration != durations[name] || !cmp.Equal(map[string]string(labels), action.Matchers) {
+					t.Fatalf("unexpected action of %s: %+v", name, action)
+				}
+			}
+
+			// The buttons post an empty JSON body, the token is in the URL.
+			req := httptest.NewRequest(http.MethodPost, buttons["Ack"], strings.NewReader("{}"))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			a.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || len(am.silences) != 1 {
+				t.Fatalf("want a silence, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package silence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Matcher is a matcher of the Alertmanager v2 API.
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// Silence is a silence of the Alertmanager v2 API.
+type Silence struct {
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+}
+
+// EqualMatchers returns the matchers of the label values, sorted by name.
+func EqualMatchers(labels map[string]string) []Matcher {
+	ms := make([]Matcher, 0, len(labels))
+	for k, v := range labels {
+		ms = append(ms, Matcher{Name: k, Value: v, IsEqual: true})
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Name < ms[j].Name })
+	return ms
+}
+
+// Client creates silences with the Alertmanager v2 API.
+type Client struct {
+	client *http.Client
+	url    string
+}
+
+// NewClient creates a Client for the Alertmanager at url, e.g. "http://alertmanager:9093".
+func NewClient(client *http.Client, url string) *Client {
+	return &Client{client: client, url: strings.TrimSuffix(url, "/")}
+}
+
+// Create creates the silence and returns its ID.
+func (c *Client) Create(ctx context.Context, s Silence) (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/api/v2/silences", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("alertmanager returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var created struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		return "", err
+	}
+	return created.SilenceID, nil
+}
@@ -0,0 +1,136 @@
+// Package silence creates Alertmanager silences from the action buttons of Teams cards.
+//
+// The buttons carry a signed token holding the matchers and the duration of the silence,
+// so the actions endpoint only creates the silences the cards offer.
+package silence
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenTTL is how long a token is valid when no TTL is configured.
+const DefaultTokenTTL = 24 * time.Hour
+
+// Errors returned by Signer.Verify.
+var (
+	ErrInvalidToken = errors.New("invalid action token")
+	ErrExpiredToken = errors.New("the action token has expired")
+	ErrUsedToken    = errors.New("the action token has already been used")
+)
+
+// Action is the silence a token asks for.
+type Action struct {
+	// Matchers are the label values the silence matches.
+	Matchers map[string]string `json:"m"`
+	Duration time.Duration     `json:"d"`
+	// Ack marks the silence as an acknowledgement.
+	Ack     bool   `json:"a,omitempty"`
+	Expires int64  `json:"exp"`
+	Nonce   string `json:"n"`
+}
+
+// Signer creates and verifies action tokens with a HMAC-SHA256 signature.
+// A token can be used once, see Use. The used tokens are only kept in memory until they expire,
+// so a token can be used again after a restart or on another replica.
+type Signer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewSigner creates a Signer with the secret key. Its tokens expire after ttl, DefaultTokenTTL if 0.
+func NewSigner(key []byte, ttl time.Duration) (*Signer, error) {
+	if len(key) < 16 {
+		return nil, fmt.Errorf("the signing key must have at least 16 bytes")
+	}
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	return &Signer{key: key, ttl: ttl, now: time.Now, used: map[string]time.Time{}}, nil
+}
+
+// Sign returns the token of a silence of the labels for the duration.
+func (s *Signer) Sign(matchers map[string]string, d time.Duration, ack bool) (string, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	a := Action{
+		Matchers: matchers,
+		Duration: d,
+		Ack:      ack,
+		Expires:  s.now().Add(s.ttl).Unix(),
+		Nonce:    hex.EncodeToString(nonce),
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + s.signature(payload), nil
+}
+
+// Verify checks the signature and the expiry of the token and returns its action.
+func (s *Signer) Verify(token string) (Action, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.signature(payload))) {
+		return Action{}, ErrInvalidToken
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Action{}, ErrInvalidToken
+	}
+	var a Action
+	if err := json.Unmarshal(b, &a); err != nil || len(a.Matchers) == 0 || a.Duration <= 0 {
+		return Action{}, ErrInvalidToken
+	}
+	if !s.now().Before(time.Unix(a.Expires, 0)) {
+		return Action{}, ErrExpiredToken
+	}
+	return a, nil
+}
+
+// Use marks the action as used and fails if it was used before,
+// so clicking a button twice does not create two silences.
+func (s *Signer) Use(a Action) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for n, exp := range s.used {
+		if !now.Before(exp) {
+			delete(s.used, n)
+		}
+	}
+	if _, ok := s.used[a.Nonce]; ok {
+		return ErrUsedToken
+	}
+	s.used[a.Nonce] = time.Unix(a.Expires, 0)
+	return nil
+}
+
+// Release forgets that the action was used, e.g. when creating its silence failed.
+func (s *Signer) Release(a Action) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.used, a.Nonce)
+}
+
+func (s *Signer) signature(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,68 @@
+package silence
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, err := NewSigner([]byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+
+	token, err := s.Sign(map[string]string{"alertname": "HighLoad", "job": "node"}, 4*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := s.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"alertname": "HighLoad", "job": "node"}
+	if diff := cmp.Diff(want, a.Matchers); diff != "" {
+		t.Fatalf("unexpected matchers (-want +got):\n%s", diff)
+	}
+	if a.Duration != 4*time.Hour || !a.Ack {
+		t.Fatalf("unexpected action %+v", a)
+	}
+
+	if err := s.Use(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Use(a); !errors.Is(err, ErrUsedToken) {
+		t.Fatalf("want %v, got %v", ErrUsedToken, err)
+	}
+	s.Release(a)
+	if err := s.Use(a); err != nil {
+		t.Fatalf("a released token must be usable, got %v", err)
+	}
+
+	other, err := NewSigner([]byte("fedcba9876543210"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("want %v for another key, got %v", ErrInvalidToken, err)
+	}
+	if _, err := s.Verify("x" + token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("want %v for a modified token, got %v", ErrInvalidToken, err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := s.Verify(token); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("want %v, got %v", ErrExpiredToken, err)
+	}
+}
+
+func TestNewSignerShortKey(t *testing.T) {
+	if _, err := NewSigner([]byte("short"), 0); err == nil {
+		t.Fatal("want an error for a short key")
+	}
+}
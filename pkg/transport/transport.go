@@ -2,26 +2,36 @@
 package transport
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	"github.com/prometheus/alertmanager/notify/webhook"
 	"go.opencensus.io/plugin/ochttp"
-	"go.opencensus.io/trace"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/decode"
+	"github.com/prometheus-msteams/prometheus-msteams/pkg/requestid"
 	"github.com/prometheus-msteams/prometheus-msteams/pkg/service"
 )
 
+var tracer = otel.Tracer("github.com/prometheus-msteams/prometheus-msteams/pkg/transport")
+
 // Route holds the Service implementation and the Request path to serve the Service.
 type Route struct {
 	Service     service.Service
 	RequestPath string
+	// Decoder decodes the requests, the Alertmanager decoder if nil.
+	Decoder decode.Decoder
 }
 
 // DynamicRoute holds the Request path to generate the service based on request (e.g. path)
@@ -38,7 +48,7 @@ func NewServer(logger log.Logger, routes []Route, dRoutes []DynamicRoute) *echo.
 	e := echo.New()
 	for _, r := range routes {
 		level.Debug(logger).Log("request_path_added", r.RequestPath)
-		addRoute(e, r.RequestPath, r.Service, logger)
+		addRoute(e, r, logger)
 	}
 	for _, r := range dRoutes {
 		level.Debug(logger).Log("request_path_added", r.RequestPath)
@@ -48,6 +58,7 @@ func NewServer(logger log.Logger, routes []Route, dRoutes []DynamicRoute) *echo.
 	return e
 }
 
+// opencensusMiddleware records the HTTP server views, traces are created by otelMiddleware.
 func opencensusMiddleware() echo.MiddlewareFunc {
 	return echo.WrapMiddleware(func(h http.Handler) http.Handler {
 		return &ochttp.Handler{
@@ -58,13 +69,34 @@ func opencensusMiddleware() echo.MiddlewareFunc {
 	})
 }
 
+// otelMiddleware starts the server span of a route, continuing the trace of a W3C traceparent header.
+func otelMiddleware(route string) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(func(h http.Handler) http.Handler {
+		return otelhttp.NewHandler(h, route)
+	})
+}
+
+// RequestIDMiddleware takes the request ID from the request or generates one,
+// adds it to the request context and returns it in the response.
+func RequestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := requestid.FromRequest(req)
+			c.SetRequest(req.WithContext(requestid.NewContext(req.Context(), id)))
+			c.Response().Header().Set(requestid.Header, id)
+			return next(c)
+		}
+	}
+}
+
 func kitLoggerMiddleware(logger log.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			defer func(begin time.Time) {
 				res := c.Response()
 				req := c.Request()
-				logger.Log(
+				requestid.Logger(req.Context(), logger).Log(
 					"method", req.Method,
 					"uri", req.RequestURI,
 					"host", req.Host,
@@ -77,16 +109,77 @@ func kitLoggerMiddleware(logger log.Logger) echo.MiddlewareFunc {
 	}
 }
 
-func addRoute(e *echo.Echo, p string, s service.Service, logger log.Logger) {
+func addRoute(e *echo.Echo, r Route, logger log.Logger) {
+	d := r.Decoder
+	if d == nil {
+		d, _ = decode.New(nil)
+	}
+	p := r.RequestPath
 	e.POST(p, func(c echo.Context) error {
-		return handleRoute(c, s, logger)
+		return handleRoute(c, r.Service, d, logger)
 	},
+		RequestIDMiddleware(),
 		kitLoggerMiddleware(logger),
 		opencensusMiddleware(),
+		otelMiddleware(p),
+	)
+}
+
+// RouteTable holds the routes which are added, replaced and removed at runtime, see AddRouteTable.
+type RouteTable struct {
+	mu     sync.RWMutex
+	routes map[string]Route
+}
+
+// NewRouteTable creates an empty RouteTable.
+func NewRouteTable() *RouteTable {
+	return &RouteTable{routes: map[string]Route{}}
+}
+
+// Set adds the route, or replaces the route of its request path.
+func (t *RouteTable) Set(r Route) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes[r.RequestPath] = r
+}
+
+// Delete removes the route of the request path.
+func (t *RouteTable) Delete(requestPath string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.routes, requestPath)
+}
+
+// Get returns the route of the request path.
+func (t *RouteTable) Get(requestPath string) (Route, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	r, ok := t.routes[requestPath]
+	return r, ok
+}
+
+// AddRouteTable serves the routes of the table for the POST requests not matching another route.
+func AddRouteTable(e *echo.Echo, t *RouteTable, logger log.Logger) {
+	d, _ := decode.New(nil)
+	e.POST("/*", func(c echo.Context) error {
+		r, ok := t.Get(c.Request().URL.Path)
+		if !ok {
+			return echo.ErrNotFound
+		}
+		if r.Decoder != nil {
+			return handleRoute(c, r.Service, r.Decoder, logger)
+		}
+		return handleRoute(c, r.Service, d, logger)
+	},
+		RequestIDMiddleware(),
+		kitLoggerMiddleware(logger),
+		opencensusMiddleware(),
+		otelMiddleware("/*"),
 	)
 }
 
 func addContextAwareRoute(e *echo.Echo, p string, w ServiceGenerator, logger log.Logger) {
+	d, _ := decode.New(nil)
 	e.POST(p, func(c echo.Context) error {
 		s, err := w(c)
 		if err != nil {
@@ -95,46 +188,55 @@ func addContextAwareRoute(e *echo.Echo, p string, w ServiceGenerator, logger log
 		if s == nil {
 			return fmt.Errorf("invalid request. No service was returned")
 		}
-		return handleRoute(c, s, logger)
+		return handleRoute(c, s, d, logger)
 	},
+		RequestIDMiddleware(),
 		kitLoggerMiddleware(logger),
 		opencensusMiddleware(),
+		otelMiddleware(p),
 	)
 }
 
-func handleRoute(c echo.Context, s service.Service, logger log.Logger) error {
-	ctx, span := trace.StartSpan(c.Request().Context(), "alertmanager-handler")
+func handleRoute(c echo.Context, s service.Service, d decode.Decoder, logger log.Logger) error {
+	ctx, span := tracer.Start(c.Request().Context(), "alertmanager-handler",
+		trace.WithAttributes(attribute.String("http.route", c.Path())),
+	)
 	defer span.End()
+	logger = requestid.Logger(ctx, logger)
 
 	b, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		logger.Log("err", err)
-		span.SetStatus(trace.Status{Code: 500, Message: err.Error()})
-		return c.String(500, err.Error())
+		return handleError(c, span, logger, err)
 	}
 
-	span.AddAttributes(trace.StringAttribute("alert", string(b)))
-
-	var wm webhook.Message
-	if err := json.Unmarshal(b, &wm); err != nil {
-		logger.Log("err", err)
-		span.SetStatus(trace.Status{Code: 500, Message: err.Error()})
-		return c.String(500, err.Error())
+	wm, err := d.Decode(b)
+	if err != nil {
+		return handleError(c, span, logger, err)
 	}
 
-	if wm.Data == nil || wm.Version == "" || wm.GroupKey == "" {
-		err = fmt.Errorf("the webhook message does not seem to be a valid Prometheus Alertmanager webhook. More information see https://prometheus.io/docs/alerting/latest/configuration/#webhook_config")
-		logger.Log("err", err)
-		span.SetStatus(trace.Status{Code: 500, Message: err.Error()})
-		return c.String(500, err.Error())
-	}
+	// The payload is not recorded since labels and annotations may be sensitive.
+	span.SetAttributes(
+		attribute.Int("alert.count", len(wm.Alerts)),
+		attribute.String("alert.status", wm.Status),
+		attribute.Int("http.request.body.size", len(b)),
+	)
 
 	prs, err := s.Post(ctx, wm)
 	if err != nil {
-		logger.Log("err", err)
-		span.SetStatus(trace.Status{Code: 500, Message: err.Error()})
-		return c.String(500, err.Error())
+		return handleError(c, span, logger, err)
 	}
 
 	return c.JSON(200, prs)
 }
+
+// handleError logs the error, records it on the span and responds with it,
+// with 429 if the tenant is rate limited so the sender retries later.
+func handleError(c echo.Context, span trace.Span, logger log.Logger, err error) error {
+	logger.Log("err", err)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	if errors.Is(err, service.ErrRateLimited) {
+		return c.String(http.StatusTooManyRequests, err.Error())
+	}
+	return c.String(500, err.Error())
+}